@@ -0,0 +1,1285 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/mailer"
+	"github.com/PavelVaavra/http-server/internal/metrics"
+	"github.com/PavelVaavra/http-server/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	testPolkaKey         = "PolkaKey"
+	testPreviousPolkaKey = "PreviousPolkaKey"
+	testAdminKey         = "AdminKeyAdminKeyAdminKeyAdminKey"
+)
+
+// newTestServer serves the whole API backed by the in-memory store.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	_, srv := newTestAPI(t)
+	return srv
+}
+
+// newTestAPI is newTestServer for tests which also call apiConfig directly.
+func newTestAPI(t *testing.T) (*apiConfig, *httptest.Server) {
+	t.Helper()
+	cfg := &apiConfig{
+		metrics:       metrics.New(nil),
+		store:         store.NewMemory(),
+		platform:      "dev",
+		jwtKeys:       auth.NewKeySet("AllYourBase"),
+		polkaKeys:     []string{testPolkaKey, testPreviousPolkaKey},
+		adminKey:      testAdminKey,
+		webhookClient: newWebhookClient(true),
+		mailer:        &testMailer{},
+		tokenSecret:   "AllYourBaseAreBelongToUsAllYourBase",
+	}
+	srv := httptest.NewServer(cfg.routes("."))
+	t.Cleanup(srv.Close)
+	return cfg, srv
+}
+
+// testMailer records the emails instead of sending them.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *testMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// lastToken returns the line of the last email to the recipient which is a token, or "" if there is none.
+func (m *testMailer) lastToken(to string, isToken func(line string) bool) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != to {
+			continue
+		}
+		for _, line := range strings.Split(m.sent[i].Body, "\n") {
+			if isToken(line) {
+				return line
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+func (m *testMailer) count(to string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, msg := range m.sent {
+		if msg.To == to {
+			n++
+		}
+	}
+	return n
+}
+
+// doRequest sends body as JSON with an optional bearer token and decodes the JSON response into out.
+func doRequest(t *testing.T, srv *httptest.Server, method, path, token string, body, out any) *http.Response {
+	t.Helper()
+	var reader *bytes.Reader
+	if body != nil {
+		dat, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(dat)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequest(method, srv.URL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		err = json.NewDecoder(resp.Body).Decode(out)
+		if err != nil {
+			t.Fatalf("%v %v: could not decode response: %v", method, path, err)
+		}
+	}
+	return resp
+}
+
+type loginResponse struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func createUserAndLogin(t *testing.T, srv *httptest.Server, email string) loginResponse {
+	t.Helper()
+	params := userParams{Email: email, Password: "04234-secret"}
+	resp := doRequest(t, srv, "POST", "/api/users", "", params, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /api/users: %v != %v", resp.StatusCode, http.StatusCreated)
+	}
+	login := loginResponse{}
+	resp = doRequest(t, srv, "POST", "/api/login", "", params, &login)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /api/login: %v != %v", resp.StatusCode, http.StatusOK)
+	}
+	return login
+}
+
+func TestChirpLifecycle(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	other := createUserAndLogin(t, srv, "other@example.com")
+
+	chirp := Chirp{}
+	resp := doRequest(t, srv, "POST", "/api/chirps", lane.Token, map[string]string{"body": "I had a kerfuffle"}, &chirp)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("POST /api/chirps: %v != %v", resp.StatusCode, http.StatusCreated)
+	}
+	if chirp.Body != "I had a ****" || chirp.UserId != lane.ID {
+		t.Errorf("unexpected chirp %+v", chirp)
+	}
+
+	resp = doRequest(t, srv, "PUT", "/api/chirps/"+chirp.ID.String(), other.Token, map[string]string{"body": "hijacked"}, nil)
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("PUT by another user: %v != %v", resp.StatusCode, http.StatusForbidden)
+	}
+
+	edited := Chirp{}
+	resp = doRequest(t, srv, "PUT", "/api/chirps/"+chirp.ID.String(), lane.Token, map[string]string{"body": "I had a fornax"}, &edited)
+	if resp.StatusCode != http.StatusOK || edited.Body != "I had a ****" {
+		t.Errorf("PUT /api/chirps: %v, %+v", resp.StatusCode, edited)
+	}
+
+	revisions := []ChirpRevision{}
+	doRequest(t, srv, "GET", "/api/chirps/"+chirp.ID.String()+"/revisions", "", nil, &revisions)
+	if len(revisions) != 1 || revisions[0].Body != chirp.Body {
+		t.Errorf("unexpected revisions %+v", revisions)
+	}
+
+	reply := Chirp{}
+	doRequest(t, srv, "POST", "/api/chirps", other.Token, map[string]any{"body": "reply", "in_reply_to": chirp.ID}, &reply)
+	resp = doRequest(t, srv, "DELETE", "/api/chirps/"+chirp.ID.String(), lane.Token, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("DELETE /api/chirps: %v != %v", resp.StatusCode, http.StatusNoContent)
+	}
+
+	thread := chirpThread{}
+	doRequest(t, srv, "GET", "/api/chirps/"+reply.ID.String()+"/thread", "", nil, &thread)
+	if len(thread.Ancestors) != 1 || !thread.Ancestors[0].Deleted || thread.Ancestors[0].Body != "" {
+		t.Errorf("deleted parent isn't a tombstone: %+v", thread.Ancestors)
+	}
+}
+
+func TestChirpsPagination(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+
+	for i := 0; i < 5; i++ {
+		doRequest(t, srv, "POST", "/api/chirps", lane.Token, map[string]string{"body": "chirp"}, nil)
+	}
+
+	seen := 0
+	path := "/api/chirps?sort=desc&limit=2"
+	for path != "" {
+		page := chirpsPage{}
+		resp := doRequest(t, srv, "GET", path, "", nil, &page)
+		seen += len(page.Chirps)
+		path = ""
+		if page.NextCursor != "" {
+			link := resp.Header.Get("Link")
+			if link == "" {
+				t.Fatalf("next_cursor without Link header")
+			}
+			path = link[1:strings.Index(link, ">")]
+		}
+	}
+	if seen != 5 {
+		t.Errorf("%v != %v", seen, 5)
+	}
+}
+
+func TestRequireAuth(t *testing.T) {
+	srv := newTestServer(t)
+
+	resp := doRequest(t, srv, "POST", "/api/chirps", "", map[string]string{"body": "chirp"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized || resp.Header.Get("WWW-Authenticate") == "" {
+		t.Errorf("no token: %v, WWW-Authenticate %q", resp.StatusCode, resp.Header.Get("WWW-Authenticate"))
+	}
+
+	resp = doRequest(t, srv, "GET", "/api/timeline", "not.a.token", nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("invalid token: %v != %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestFollowTimeline(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	other := createUserAndLogin(t, srv, "other@example.com")
+
+	doRequest(t, srv, "POST", "/api/chirps", other.Token, map[string]string{"body": "hello followers"}, nil)
+
+	resp := doRequest(t, srv, "POST", "/api/users/"+other.ID.String()+"/follow", lane.Token, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("POST follow: %v != %v", resp.StatusCode, http.StatusNoContent)
+	}
+
+	timeline := chirpsPage{}
+	doRequest(t, srv, "GET", "/api/timeline", lane.Token, nil, &timeline)
+	if len(timeline.Chirps) != 1 || timeline.Chirps[0].UserId != other.ID {
+		t.Errorf("unexpected timeline %+v", timeline)
+	}
+
+	followers := followsPage{}
+	doRequest(t, srv, "GET", "/api/users/"+other.ID.String()+"/followers", "", nil, &followers)
+	if len(followers.Users) != 1 || followers.Users[0].UserId != lane.ID {
+		t.Errorf("unexpected followers %+v", followers)
+	}
+}
+
+func TestRefreshTokenRotation(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+
+	type refreshResponse struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	rotated := refreshResponse{}
+	resp := doRequest(t, srv, "POST", "/api/refresh", lane.RefreshToken, nil, &rotated)
+	if resp.StatusCode != http.StatusOK || rotated.RefreshToken == "" || rotated.RefreshToken == lane.RefreshToken {
+		t.Fatalf("POST /api/refresh: %v, %+v", resp.StatusCode, rotated)
+	}
+
+	// Presenting the old token again revokes the whole family, including the rotated token.
+	resp = doRequest(t, srv, "POST", "/api/refresh", lane.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("reused token: %v != %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+	resp = doRequest(t, srv, "POST", "/api/refresh", rotated.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("token of a revoked family: %v != %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	doRequest(t, srv, "POST", "/api/login", "", userParams{Email: "lane@example.com", Password: "wrong"}, nil)
+	doRequest(t, srv, "POST", "/api/chirps", lane.Token, map[string]string{"body": "chirp"}, nil)
+	doRequest(t, srv, "GET", "/app/", "", nil, nil)
+
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	dat, _ := io.ReadAll(resp.Body)
+	for _, series := range []string{
+		`chirpy_chirps_created_total 1`,
+		`chirpy_logins_total{result="failed"} 1`,
+		`chirpy_logins_total{result="succeeded"} 1`,
+		`chirpy_fileserver_hits_total 1`,
+		`chirpy_http_requests_total{code="201",route="POST /api/chirps"} 1`,
+		`chirpy_http_request_duration_seconds_count{code="401",route="POST /api/login"} 1`,
+	} {
+		if !strings.Contains(string(dat), series) {
+			t.Errorf("GET /metrics doesn't contain %v", series)
+		}
+	}
+
+	resp, err = srv.Client().Get(srv.URL + "/admin/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	dat, _ = io.ReadAll(resp.Body)
+	if !strings.Contains(string(dat), "Chirpy has been visited 1 times!") {
+		t.Errorf("unexpected /admin/metrics page %v", string(dat))
+	}
+}
+
+func TestResponseRecorder(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /stream", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(*metrics.ResponseRecorder); !ok {
+			t.Errorf("%T isn't the shared recorder", w)
+		}
+		if _, ok := w.(*metrics.ResponseRecorder).ResponseWriter.(*metrics.ResponseRecorder); ok {
+			t.Errorf("response is recorded twice")
+		}
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "chunk")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("flush: %v", err)
+		}
+	})
+	m := metrics.New(nil)
+
+	recorder := httptest.NewRecorder()
+	logRequests(m.Middleware(mux)).ServeHTTP(recorder, httptest.NewRequest("GET", "/stream", nil))
+	if !recorder.Flushed {
+		t.Errorf("response wasn't flushed")
+	}
+	if recorder.Code != http.StatusAccepted {
+		t.Errorf("%v != %v", recorder.Code, http.StatusAccepted)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	srv := newTestServer(t)
+
+	logs := bytes.Buffer{}
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	cases := []struct {
+		header  string
+		echoed  bool
+		comment string
+	}{
+		{"req-1234", true, "valid id is honoured"},
+		{"", false, "missing id is generated"},
+		{"bad id with \"quotes\"", false, "invalid id is replaced"},
+	}
+
+	for _, c := range cases {
+		logs.Reset()
+		req, _ := http.NewRequest("GET", srv.URL+"/api/chirps/not-a-uuid/revisions", nil)
+		if c.header != "" {
+			req.Header.Set("X-Request-ID", c.header)
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body := map[string]string{}
+		json.NewDecoder(resp.Body).Decode(&body)
+		resp.Body.Close()
+
+		id := resp.Header.Get("X-Request-ID")
+		if id == "" || (id == c.header) != c.echoed {
+			t.Errorf("%v: X-Request-ID %q", c.comment, id)
+		}
+		if body["request_id"] != id {
+			t.Errorf("%v: %v != %v", c.comment, body["request_id"], id)
+		}
+		if !strings.Contains(logs.String(), `"msg":"request"`) || strings.Count(logs.String(), `"request_id":"`+id+`"`) != 2 {
+			t.Errorf("%v: error and access log lines don't carry the request id:\n%v", c.comment, logs.String())
+		}
+	}
+}
+
+func TestProblemDetails(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	other := createUserAndLogin(t, srv, "other@example.com")
+	chirp := Chirp{}
+	doRequest(t, srv, "POST", "/api/chirps", lane.Token, map[string]string{"body": "chirp"}, &chirp)
+
+	cases := []struct {
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+		code   string
+		field  string
+	}{
+		{"POST", "/api/chirps", lane.Token, "not an object", http.StatusBadRequest, "invalid_json", ""},
+		{"POST", "/api/chirps", lane.Token, map[string]string{"body": strings.Repeat("a", 141)}, http.StatusBadRequest, "chirp_too_long", "body"},
+		{"GET", "/api/chirps?limit=0", "", nil, http.StatusBadRequest, "invalid_parameter", "limit"},
+		{"GET", "/api/chirps/not-a-uuid", "", nil, http.StatusBadRequest, "invalid_parameter", "chirpID"},
+		{"PUT", "/api/chirps/" + chirp.ID.String(), other.Token, map[string]string{"body": "hijacked"}, http.StatusForbidden, "not_chirp_author", ""},
+		{"GET", "/api/timeline", "", nil, http.StatusUnauthorized, "unauthenticated", ""},
+		{"POST", "/api/polka/webhooks", "", map[string]string{"event": "user.upgraded"}, http.StatusUnauthorized, "invalid_signature", ""},
+		{"POST", "/api/users", "", userParams{Email: "other@example.com", Password: "04234-secret"}, http.StatusConflict, "email_taken", "email"},
+		{"PUT", "/api/users", lane.Token, userParams{Email: "other@example.com", Password: "04234-secret"}, http.StatusConflict, "email_taken", "email"},
+	}
+
+	for _, c := range cases {
+		p := problem{}
+		resp := doRequest(t, srv, c.method, c.path, c.token, c.body, &p)
+		if resp.StatusCode != c.status || p.Status != c.status || p.Code != c.code || p.Type != problemTypeBase+c.code {
+			t.Errorf("%v %v: %v, %+v", c.method, c.path, resp.StatusCode, p)
+		}
+		if contentType := resp.Header.Get("Content-Type"); contentType != "application/problem+json" {
+			t.Errorf("%v %v: %v != %v", c.method, c.path, contentType, "application/problem+json")
+		}
+		if c.field != "" && (len(p.Errors) != 1 || p.Errors[0].Field != c.field) {
+			t.Errorf("%v %v: %+v doesn't point to %v", c.method, c.path, p.Errors, c.field)
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+
+	cases := []struct {
+		comment     string
+		path        string
+		token       string
+		contentType string
+		body        string
+		status      int
+		code        string
+		fields      []string
+	}{
+		{"wrong content type", "/api/users", "", "text/plain", `{"email":"a@example.com","password":"04234-secret"}`, http.StatusUnsupportedMediaType, "unsupported_media_type", nil},
+		{"content type with charset", "/api/users", "", "application/json; charset=utf-8", `{"email":"a@example.com","password":"04234-secret"}`, http.StatusCreated, "", nil},
+		{"unknown field", "/api/users", "", "application/json", `{"email":"b@example.com","password":"04234-secret","admin":true}`, http.StatusBadRequest, "validation_failed", []string{"admin"}},
+		{"trailing data", "/api/users", "", "application/json", `{"email":"c@example.com","password":"04234-secret"} {}`, http.StatusBadRequest, "invalid_json", nil},
+		{"empty body", "/api/users", "", "application/json", ``, http.StatusBadRequest, "invalid_json", nil},
+		{"wrong field type", "/api/users", "", "application/json", `{"email":1,"password":"04234-secret"}`, http.StatusBadRequest, "validation_failed", []string{"email"}},
+		{"bad email and short password", "/api/users", "", "application/json", `{"email":"not an email","password":"short"}`, http.StatusBadRequest, "validation_failed", []string{"email", "password"}},
+		{"missing fields", "/api/users", "", "application/json", `{}`, http.StatusBadRequest, "validation_failed", []string{"email", "password"}},
+		{"body too large", "/api/users", "", "application/json", `{"email":"` + strings.Repeat("a", maxBodyBytes) + `"}`, http.StatusRequestEntityTooLarge, "body_too_large", nil},
+		{"login without password", "/api/login", "", "application/json", `{"email":"lane@example.com"}`, http.StatusBadRequest, "validation_failed", []string{"password"}},
+		{"blank chirp", "/api/chirps", lane.Token, "application/json", `{"body":"  "}`, http.StatusBadRequest, "validation_failed", []string{"body"}},
+		{"webhook without user", "/api/polka/webhooks", "", "application/json", `{"id":"evt_1","event":"user.upgraded","data":{}}`, http.StatusBadRequest, "validation_failed", []string{"data.user_id"}},
+		{"webhook with unknown fields", "/api/polka/webhooks", "", "application/json", `{"id":"evt_2","event":"user.deleted","data":{},"sent_at":"now"}`, http.StatusNoContent, "", nil},
+	}
+
+	for _, c := range cases {
+		req, err := http.NewRequest("POST", srv.URL+c.path, strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Content-Type", c.contentType)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		if c.path == "/api/polka/webhooks" {
+			req.Header.Set(polkaSignatureHeader, auth.SignWebhook(testPolkaKey, time.Now(), []byte(c.body)))
+		}
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := problem{}
+		json.NewDecoder(resp.Body).Decode(&p)
+		resp.Body.Close()
+
+		if resp.StatusCode != c.status || p.Code != c.code {
+			t.Errorf("%v: %v %v != %v %v", c.comment, resp.StatusCode, p.Code, c.status, c.code)
+		}
+		fields := []string{}
+		for _, field := range p.Errors {
+			fields = append(fields, field.Field)
+		}
+		if strings.Join(fields, ",") != strings.Join(c.fields, ",") {
+			t.Errorf("%v: %v != %v", c.comment, fields, c.fields)
+		}
+	}
+}
+
+func TestPolkaWebhooks(t *testing.T) {
+	srv := newTestServer(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	upgrade := func(id string, userId uuid.UUID) string {
+		return `{"id":"` + id + `","event":"user.upgraded","data":{"user_id":"` + userId.String() + `"}}`
+	}
+
+	cases := []struct {
+		comment   string
+		body      string
+		signature string
+		status    int
+		code      string
+	}{
+		{"valid", upgrade("evt_1", lane.ID), auth.SignWebhook(testPolkaKey, time.Now(), []byte(upgrade("evt_1", lane.ID))), http.StatusNoContent, ""},
+		{"replayed", upgrade("evt_1", lane.ID), auth.SignWebhook(testPolkaKey, time.Now(), []byte(upgrade("evt_1", lane.ID))), http.StatusNoContent, ""},
+		{"signed with the previous key", upgrade("evt_2", lane.ID), auth.SignWebhook(testPreviousPolkaKey, time.Now(), []byte(upgrade("evt_2", lane.ID))), http.StatusNoContent, ""},
+		{"unsigned", upgrade("evt_3", lane.ID), "", http.StatusUnauthorized, "invalid_signature"},
+		{"signed with an unknown key", upgrade("evt_3", lane.ID), auth.SignWebhook("UnknownKey", time.Now(), []byte(upgrade("evt_3", lane.ID))), http.StatusUnauthorized, "invalid_signature"},
+		{"signature of another body", upgrade("evt_3", lane.ID), auth.SignWebhook(testPolkaKey, time.Now(), []byte(upgrade("evt_4", lane.ID))), http.StatusUnauthorized, "invalid_signature"},
+		{"expired", upgrade("evt_3", lane.ID), auth.SignWebhook(testPolkaKey, time.Now().Add(-polkaSignatureTolerance-time.Minute), []byte(upgrade("evt_3", lane.ID))), http.StatusUnauthorized, "invalid_signature"},
+	}
+
+	for _, c := range cases {
+		p := problem{}
+		resp := doPolkaWebhook(t, srv, c.body, c.signature, &p)
+		if resp.StatusCode != c.status || p.Code != c.code {
+			t.Errorf("%v: %v %v != %v %v", c.comment, resp.StatusCode, p.Code, c.status, c.code)
+		}
+	}
+
+	login := loginResponse{}
+	doRequest(t, srv, "POST", "/api/login", "", userParams{Email: "lane@example.com", Password: "04234-secret"}, &login)
+	if !login.IsChirpyRed {
+		t.Errorf("%v != %v", login.IsChirpyRed, true)
+	}
+}
+
+func doPolkaWebhook(t *testing.T, srv *httptest.Server, body, signature string, out any) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest("POST", srv.URL+"/api/polka/webhooks", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set(polkaSignatureHeader, signature)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	json.NewDecoder(resp.Body).Decode(out)
+	return resp
+}
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	cfg, srv := newTestAPI(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	eventCount := 0
+	send := func(event string) {
+		t.Helper()
+		eventCount++
+		body := `{"id":"evt_` + strconv.Itoa(eventCount) + `","event":"` + event + `","data":{"user_id":"` + lane.ID.String() + `"}}`
+		resp := doPolkaWebhook(t, srv, body, auth.SignWebhook(testPolkaKey, time.Now(), []byte(body)), nil)
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("%v: %v != %v", event, resp.StatusCode, http.StatusNoContent)
+		}
+	}
+	check := func(step, status string, periods int, isChirpyRed bool) Subscription {
+		t.Helper()
+		subscription := Subscription{}
+		resp := doRequest(t, srv, "GET", "/api/users/me/subscription", lane.Token, nil, &subscription)
+		if resp.StatusCode != http.StatusOK || subscription.Status != status {
+			t.Errorf("%v: %v %v != %v %v", step, resp.StatusCode, subscription.Status, http.StatusOK, status)
+		}
+		if length := subscription.CurrentPeriodEnd.Sub(subscription.CurrentPeriodStart); periods > 0 && length != redPeriod {
+			t.Errorf("%v: period is %v long", step, length)
+		}
+		login := loginResponse{}
+		doRequest(t, srv, "POST", "/api/login", "", userParams{Email: "lane@example.com", Password: "04234-secret"}, &login)
+		if login.IsChirpyRed != isChirpyRed {
+			t.Errorf("%v: is_chirpy_red %v != %v", step, login.IsChirpyRed, isChirpyRed)
+		}
+		return subscription
+	}
+
+	p := problem{}
+	resp := doRequest(t, srv, "GET", "/api/users/me/subscription", lane.Token, nil, &p)
+	if resp.StatusCode != http.StatusNotFound || p.Code != "subscription_not_found" {
+		t.Errorf("%v %v != %v %v", resp.StatusCode, p.Code, http.StatusNotFound, "subscription_not_found")
+	}
+
+	send(eventUserUpgraded)
+	upgraded := check("upgraded", "active", 1, true)
+	send(eventUserUpgraded)
+	if again := check("upgraded twice", "active", 1, true); again.ID != upgraded.ID || !again.CurrentPeriodEnd.Equal(upgraded.CurrentPeriodEnd) {
+		t.Errorf("a second user.upgraded changes the subscription %+v", again)
+	}
+	send(eventUserRenewed)
+	renewed := check("renewed", "active", 1, true)
+	if !renewed.CurrentPeriodStart.Equal(upgraded.CurrentPeriodEnd) {
+		t.Errorf("renewed period starts at %v, not at the end of the last one %v", renewed.CurrentPeriodStart, upgraded.CurrentPeriodEnd)
+	}
+	send(eventUserPaymentFailed)
+	check("payment failed", "past_due", 1, true)
+
+	// Within the grace period nothing expires.
+	expired, err := cfg.expireSubscriptions(context.Background(), renewed.GracePeriodEnd.Add(-time.Minute))
+	if err != nil || expired != 0 {
+		t.Errorf("expireSubscriptions in the grace period returns %v, %v", expired, err)
+	}
+	check("in grace period", "past_due", 1, true)
+	expired, err = cfg.expireSubscriptions(context.Background(), renewed.GracePeriodEnd.Add(time.Minute))
+	if err != nil || expired != 1 {
+		t.Errorf("expireSubscriptions after the grace period returns %v, %v", expired, err)
+	}
+	check("expired", "expired", 1, false)
+
+	send(eventUserRenewed)
+	resubscribed := check("renewed after expiry", "active", 1, true)
+	if resubscribed.ID == upgraded.ID {
+		t.Errorf("renewal after expiry reopens the expired subscription")
+	}
+	send(eventUserDowngraded)
+	if canceled := check("downgraded", "canceled", 1, false); canceled.EndedAt == nil {
+		t.Errorf("canceled subscription has no ended_at")
+	}
+}
+
+func TestWebhookInbox(t *testing.T) {
+	cfg, srv := newTestAPI(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	listFailed := func() []WebhookEvent {
+		t.Helper()
+		page := webhookEventsPage{}
+		resp := doRequest(t, srv, "GET", "/admin/webhooks/events", testAdminKey, nil, &page)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("GET /admin/webhooks/events: %v != %v", resp.StatusCode, http.StatusOK)
+		}
+		return page.Events
+	}
+
+	// Polka retries an event which fails, every attempt is counted.
+	unknownUser := `{"id":"evt_1","event":"user.upgraded","data":{"user_id":"` + uuid.NewString() + `"}}`
+	for i := 0; i < 2; i++ {
+		resp := doPolkaWebhook(t, srv, unknownUser, auth.SignWebhook(testPolkaKey, time.Now(), []byte(unknownUser)), nil)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("attempt %v: %v != %v", i, resp.StatusCode, http.StatusNotFound)
+		}
+	}
+	failed := listFailed()
+	if len(failed) != 1 || failed[0].EventID != "evt_1" || failed[0].Attempts != 2 || failed[0].LastError == nil || string(failed[0].Payload) != unknownUser {
+		t.Fatalf("failed events %+v", failed)
+	}
+
+	replayed := WebhookEvent{}
+	resp := doRequest(t, srv, "POST", "/admin/webhooks/events/"+failed[0].ID.String()+"/replay", testAdminKey, nil, &replayed)
+	if resp.StatusCode != http.StatusOK || replayed.Status != webhookEventFailed || replayed.Attempts != 3 {
+		t.Errorf("replay of a failing event: %v, %+v", resp.StatusCode, replayed)
+	}
+
+	// An event which was stored but never processed, like after a crash, can be replayed too.
+	pending, err := cfg.store.CreateWebhookEvent(context.Background(), database.CreateWebhookEventParams{
+		EventID: "evt_2",
+		Event:   eventUserUpgraded,
+		Payload: `{"id":"evt_2","event":"user.upgraded","data":{"user_id":"` + lane.ID.String() + `"}}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = doRequest(t, srv, "POST", "/admin/webhooks/events/"+pending.ID.String()+"/replay", testAdminKey, nil, &replayed)
+	if resp.StatusCode != http.StatusOK || replayed.Status != webhookEventProcessed || replayed.ProcessedAt == nil {
+		t.Errorf("replay of a pending event: %v, %+v", resp.StatusCode, replayed)
+	}
+	subscription := Subscription{}
+	doRequest(t, srv, "GET", "/api/users/me/subscription", lane.Token, nil, &subscription)
+	if subscription.Status != "active" {
+		t.Errorf("%v != %v", subscription.Status, "active")
+	}
+
+	cases := []struct {
+		comment string
+		method  string
+		path    string
+		token   string
+		status  int
+		code    string
+	}{
+		{"replay of a processed event", "POST", "/admin/webhooks/events/" + pending.ID.String() + "/replay", testAdminKey, http.StatusConflict, "webhook_event_processed"},
+		{"replay of an unknown event", "POST", "/admin/webhooks/events/" + uuid.NewString() + "/replay", testAdminKey, http.StatusNotFound, "webhook_event_not_found"},
+		{"unknown status", "GET", "/admin/webhooks/events?status=lost", testAdminKey, http.StatusBadRequest, "invalid_parameter"},
+		{"no admin key", "GET", "/admin/webhooks/events", "", http.StatusUnauthorized, "invalid_admin_key"},
+		{"user token", "GET", "/admin/webhooks/events", lane.Token, http.StatusUnauthorized, "invalid_admin_key"},
+	}
+	for _, c := range cases {
+		p := problem{}
+		resp := doRequest(t, srv, c.method, c.path, c.token, nil, &p)
+		if resp.StatusCode != c.status || p.Code != c.code {
+			t.Errorf("%v: %v %v != %v %v", c.comment, resp.StatusCode, p.Code, c.status, c.code)
+		}
+	}
+}
+
+// webhookReceiver records the webhooks it gets and responds with status.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func (wr *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.requests = append(wr.requests, receivedWebhook{header: r.Header, body: body})
+	w.WriteHeader(wr.status)
+}
+
+func (wr *webhookReceiver) respondWith(status int) {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	wr.status = status
+}
+
+func (wr *webhookReceiver) received() []receivedWebhook {
+	wr.mu.Lock()
+	defer wr.mu.Unlock()
+	return slices.Clone(wr.requests)
+}
+
+func TestOutboundWebhooks(t *testing.T) {
+	cfg, srv := newTestAPI(t)
+	ctx := context.Background()
+	receiver := &webhookReceiver{status: http.StatusOK}
+	receiverSrv := httptest.NewServer(receiver)
+	t.Cleanup(receiverSrv.Close)
+
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	saul := createUserAndLogin(t, srv, "saul@example.com")
+
+	endpoint := WebhookEndpoint{}
+	resp := doRequest(t, srv, "POST", "/api/webhooks/endpoints", lane.Token, webhookEndpointParams{Url: receiverSrv.URL, Events: []string{eventChirpCreated}}, &endpoint)
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(endpoint.Secret, "whsec_") {
+		t.Fatalf("POST /api/webhooks/endpoints: %v, %+v", resp.StatusCode, endpoint)
+	}
+	adminEndpoint := WebhookEndpoint{}
+	doRequest(t, srv, "POST", "/admin/webhooks/endpoints", testAdminKey, webhookEndpointParams{Url: receiverSrv.URL, Events: []string{eventChirpDeleted}}, &adminEndpoint)
+
+	// The chirps of saul don't go to the endpoint of lane.
+	doRequest(t, srv, "POST", "/api/chirps", saul.Token, chirpParams{Body: "Not for lane"}, nil)
+	chirp := Chirp{}
+	doRequest(t, srv, "POST", "/api/chirps", lane.Token, chirpParams{Body: "Hello hooks"}, &chirp)
+	sent, err := cfg.deliverWebhooks(ctx, time.Now())
+	if err != nil || sent != 1 {
+		t.Fatalf("deliverWebhooks: %v, %v != 1", err, sent)
+	}
+	got := receiver.received()
+	if len(got) != 1 {
+		t.Fatalf("%v != %v", len(got), 1)
+	}
+	err = auth.VerifyWebhook(got[0].header.Get(chirpySignatureHeader), got[0].body, []string{endpoint.Secret}, time.Now(), time.Minute)
+	if err != nil {
+		t.Errorf("signature: %v", err)
+	}
+	event := struct {
+		ID    uuid.UUID `json:"id"`
+		Event string    `json:"event"`
+		Data  Chirp     `json:"data"`
+	}{}
+	json.Unmarshal(got[0].body, &event)
+	if event.Event != eventChirpCreated || got[0].header.Get(chirpyEventHeader) != eventChirpCreated || event.Data.ID != chirp.ID || event.ID == uuid.Nil {
+		t.Errorf("received %v %s", got[0].header, got[0].body)
+	}
+
+	// A failed delivery waits for its backoff, then it is sent again.
+	receiver.respondWith(http.StatusInternalServerError)
+	doRequest(t, srv, "POST", "/api/chirps", lane.Token, chirpParams{Body: "Retry me"}, nil)
+	now := time.Now()
+	cfg.deliverWebhooks(ctx, now)
+	sent, _ = cfg.deliverWebhooks(ctx, now.Add(webhookBackoff(1)-time.Second))
+	if sent != 0 {
+		t.Errorf("sent before the backoff: %v != 0", sent)
+	}
+	receiver.respondWith(http.StatusNoContent)
+	sent, _ = cfg.deliverWebhooks(ctx, now.Add(webhookBackoff(1)))
+	if sent != 1 {
+		t.Errorf("sent after the backoff: %v != 1", sent)
+	}
+
+	page := webhookDeliveriesPage{}
+	path := "/api/webhooks/endpoints/" + endpoint.ID.String() + "/deliveries"
+	doRequest(t, srv, "GET", path, lane.Token, nil, &page)
+	if len(page.Deliveries) != 2 || page.Deliveries[0].Status != webhookDeliverySucceeded || page.Deliveries[0].Attempts != 2 {
+		t.Fatalf("deliveries %+v", page.Deliveries)
+	}
+	delivery := WebhookDelivery{}
+	doRequest(t, srv, "GET", "/api/webhooks/deliveries/"+page.Deliveries[0].ID.String(), lane.Token, nil, &delivery)
+	log := delivery.AttemptLog
+	if len(log) != 2 || log[0].StatusCode == nil || *log[0].StatusCode != 500 || log[0].Error == nil || *log[1].StatusCode != 204 || log[1].Error != nil {
+		t.Errorf("attempt log %+v", log)
+	}
+
+	// A delivery which fails every attempt ends up dead.
+	receiver.respondWith(http.StatusGone)
+	doRequest(t, srv, "POST", "/api/chirps", lane.Token, chirpParams{Body: "Dead letter"}, nil)
+	for i := 0; i < webhookMaxAttempts+1; i++ {
+		cfg.deliverWebhooks(ctx, now.Add(time.Duration(i)*webhookRetryMax))
+	}
+	doRequest(t, srv, "GET", path, lane.Token, nil, &page)
+	if page.Deliveries[0].Status != webhookDeliveryDead || page.Deliveries[0].Attempts != webhookMaxAttempts || page.Deliveries[0].NextAttemptAt != nil {
+		t.Errorf("dead delivery %+v", page.Deliveries[0])
+	}
+
+	// Admin endpoints get the events of every user.
+	receiver.respondWith(http.StatusOK)
+	doRequest(t, srv, "DELETE", "/api/chirps/"+chirp.ID.String(), lane.Token, nil, nil)
+	cfg.deliverWebhooks(ctx, time.Now())
+	adminPage := webhookDeliveriesPage{}
+	doRequest(t, srv, "GET", "/admin/webhooks/endpoints/"+adminEndpoint.ID.String()+"/deliveries", testAdminKey, nil, &adminPage)
+	if len(adminPage.Deliveries) != 1 || adminPage.Deliveries[0].Event != eventChirpDeleted || adminPage.Deliveries[0].Status != webhookDeliverySucceeded {
+		t.Errorf("admin deliveries %+v", adminPage.Deliveries)
+	}
+
+	cases := []struct {
+		comment string
+		method  string
+		path    string
+		token   string
+		body    any
+		status  int
+		code    string
+	}{
+		{"not an https URL", "POST", "/api/webhooks/endpoints", lane.Token, webhookEndpointParams{Url: "ftp://example.com", Events: []string{eventChirpCreated}}, http.StatusBadRequest, "validation_failed"},
+		{"unknown event", "POST", "/api/webhooks/endpoints", lane.Token, webhookEndpointParams{Url: "https://example.com", Events: []string{"chirp.liked"}}, http.StatusBadRequest, "validation_failed"},
+		{"deliveries of another user", "GET", path, saul.Token, nil, http.StatusNotFound, "webhook_endpoint_not_found"},
+		{"delivery of another user", "GET", "/api/webhooks/deliveries/" + delivery.ID.String(), saul.Token, nil, http.StatusNotFound, "webhook_delivery_not_found"},
+		{"delete endpoint of another user", "DELETE", "/api/webhooks/endpoints/" + endpoint.ID.String(), saul.Token, nil, http.StatusNotFound, "webhook_endpoint_not_found"},
+		{"unknown delivery", "GET", "/api/webhooks/deliveries/" + uuid.NewString(), lane.Token, nil, http.StatusNotFound, "webhook_delivery_not_found"},
+		{"no token", "GET", "/api/webhooks/endpoints", "", nil, http.StatusUnauthorized, "unauthenticated"},
+	}
+	for _, c := range cases {
+		p := problem{}
+		resp := doRequest(t, srv, c.method, c.path, c.token, c.body, &p)
+		if resp.StatusCode != c.status || p.Code != c.code {
+			t.Errorf("%v: %v %v != %v %v", c.comment, resp.StatusCode, p.Code, c.status, c.code)
+		}
+	}
+
+	endpoints := []WebhookEndpoint{}
+	doRequest(t, srv, "GET", "/api/webhooks/endpoints", lane.Token, nil, &endpoints)
+	if len(endpoints) != 1 || endpoints[0].ID != endpoint.ID || endpoints[0].Secret != "" {
+		t.Errorf("endpoints %+v", endpoints)
+	}
+	resp = doRequest(t, srv, "DELETE", "/api/webhooks/endpoints/"+endpoint.ID.String(), lane.Token, nil, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("%v != %v", resp.StatusCode, http.StatusNoContent)
+	}
+	p := problem{}
+	doRequest(t, srv, "GET", path, lane.Token, nil, &p)
+	if p.Code != "webhook_endpoint_not_found" {
+		t.Errorf("%v != %v", p.Code, "webhook_endpoint_not_found")
+	}
+}
+
+func TestWebhookPrivateAddresses(t *testing.T) {
+	cfg, srv := newTestAPI(t)
+	ctx := context.Background()
+	receiver := &webhookReceiver{status: http.StatusOK}
+	receiverSrv := httptest.NewServer(receiver)
+	t.Cleanup(receiverSrv.Close)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+
+	// The receiver is on 127.0.0.1, which only the dev platform may register.
+	endpoint := WebhookEndpoint{}
+	doRequest(t, srv, "POST", "/api/webhooks/endpoints", lane.Token, webhookEndpointParams{Url: receiverSrv.URL, Events: []string{eventChirpCreated}}, &endpoint)
+	cfg.platform = "production"
+	cfg.webhookClient = newWebhookClient(false)
+
+	blocked := []string{
+		"https://127.0.0.1/hook",
+		"https://localhost:8443/hook",
+		"https://10.0.0.7/hook",
+		"https://169.254.169.254/latest/meta-data",
+		"https://[::1]/hook",
+		"https://0.0.0.0/hook",
+		"https://0.1.2.3/hook",
+		"https://100.64.0.1/hook",
+		"https://192.0.0.8/hook",
+		"https://198.18.0.1/hook",
+		"https://240.0.0.1/hook",
+		"https://255.255.255.255/hook",
+		"https://[::ffff:10.0.0.1]/hook",
+		"https://[64:ff9b::a00:1]/hook",
+		"https://[2002:a00:1::]/hook",
+		"https://[fd00::1]/hook",
+	}
+	for _, u := range blocked {
+		p := problem{}
+		resp := doRequest(t, srv, "POST", "/api/webhooks/endpoints", lane.Token, webhookEndpointParams{Url: u, Events: []string{eventChirpCreated}}, &p)
+		if resp.StatusCode != http.StatusBadRequest || p.Code != "validation_failed" {
+			t.Errorf("%v: %v %v", u, resp.StatusCode, p.Code)
+		}
+	}
+
+	// An endpoint whose host resolves to a private address later isn't connected to either.
+	doRequest(t, srv, "POST", "/api/chirps", lane.Token, chirpParams{Body: "Stay inside"}, nil)
+	sent, err := cfg.deliverWebhooks(ctx, time.Now())
+	if err != nil || sent != 1 || len(receiver.received()) != 0 {
+		t.Fatalf("deliverWebhooks: %v, %v sent, %v received", err, sent, len(receiver.received()))
+	}
+	delivery := WebhookDelivery{}
+	page := webhookDeliveriesPage{}
+	doRequest(t, srv, "GET", "/api/webhooks/endpoints/"+endpoint.ID.String()+"/deliveries", lane.Token, nil, &page)
+	doRequest(t, srv, "GET", "/api/webhooks/deliveries/"+page.Deliveries[0].ID.String(), lane.Token, nil, &delivery)
+	log := delivery.AttemptLog
+	if len(log) != 1 || log[0].StatusCode != nil || log[0].Error == nil || !strings.Contains(*log[0].Error, errWebhookAddressBlocked.Error()) {
+		t.Errorf("attempt log %+v", log)
+	}
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cases := []struct {
+		attempt int32
+		backoff time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{5, 8 * time.Minute},
+		{10, 4*time.Hour + 16*time.Minute},
+		{11, webhookRetryMax},
+		{100, webhookRetryMax},
+	}
+	for _, c := range cases {
+		if backoff := webhookBackoff(c.attempt); backoff != c.backoff {
+			t.Errorf("attempt %v: %v != %v", c.attempt, backoff, c.backoff)
+		}
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	cases := []struct {
+		ip     string
+		public bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:4700::1111", true},
+		{"::ffff:93.184.215.14", true},
+		{"100.127.255.255", false},
+		{"::ffff:192.168.1.1", false},
+		{"64:ff9b::7f00:1", false},
+		{"2001::1", false},
+		{"fe80::1%eth0", false},
+	}
+	for _, c := range cases {
+		if public := isPublicIP(netip.MustParseAddr(c.ip)); public != c.public {
+			t.Errorf("%v: %v != %v", c.ip, public, c.public)
+		}
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	cfg, srv := newTestAPI(t)
+	mail := cfg.mailer.(*testMailer)
+	verificationToken := func(email string) string {
+		return mail.lastToken(email, func(line string) bool {
+			_, err := auth.VerificationTokenUser(line)
+			return err == nil
+		})
+	}
+
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	token := verificationToken("lane@example.com")
+	if lane.EmailVerified || token == "" {
+		t.Fatalf("new user: verified %v, token %q", lane.EmailVerified, token)
+	}
+
+	cfg.requireVerified = true
+	p := problem{}
+	resp := doRequest(t, srv, "POST", "/api/chirps", lane.Token, chirpParams{Body: "Too early"}, &p)
+	if resp.StatusCode != http.StatusForbidden || p.Code != "email_not_verified" {
+		t.Errorf("chirp before verification: %v %v", resp.StatusCode, p.Code)
+	}
+
+	resp = doRequest(t, srv, "POST", "/api/users/verify/resend", lane.Token, nil, &p)
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("Retry-After") == "" || mail.count("lane@example.com") != 1 {
+		t.Errorf("resend right after sign up: %v, %v emails", resp.StatusCode, mail.count("lane@example.com"))
+	}
+
+	verified := User{}
+	resp = doRequest(t, srv, "POST", "/api/users/verify", "", verifyEmailParams{Token: token}, &verified)
+	if resp.StatusCode != http.StatusOK || !verified.EmailVerified {
+		t.Fatalf("POST /api/users/verify: %v, %+v", resp.StatusCode, verified)
+	}
+	resp = doRequest(t, srv, "POST", "/api/chirps", lane.Token, chirpParams{Body: "Verified"}, nil)
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("chirp after verification: %v != %v", resp.StatusCode, http.StatusCreated)
+	}
+
+	// A new email has to be verified again, tokens for the old one don't count.
+	updated := User{}
+	doRequest(t, srv, "PUT", "/api/users", lane.Token, userParams{Email: "lane@chirpy.example", Password: "04234-secret"}, &updated)
+	newToken := verificationToken("lane@chirpy.example")
+	if updated.EmailVerified || newToken == "" {
+		t.Errorf("email change: verified %v, token %q", updated.EmailVerified, newToken)
+	}
+
+	saul := createUserAndLogin(t, srv, "saul@example.com")
+	cases := []struct {
+		comment string
+		path    string
+		token   string
+		body    any
+		status  int
+		code    string
+	}{
+		{"token of the old email", "/api/users/verify", "", verifyEmailParams{Token: token}, http.StatusBadRequest, "invalid_verification_token"},
+		{"garbage token", "/api/users/verify", "", verifyEmailParams{Token: "garbage"}, http.StatusBadRequest, "invalid_verification_token"},
+		{"expired token", "/api/users/verify", "", verifyEmailParams{Token: auth.MakeVerificationToken(cfg.tokenSecret, saul.ID, "saul@example.com", time.Now().Add(-time.Second))}, http.StatusBadRequest, "invalid_verification_token"},
+		{"forged token", "/api/users/verify", "", verifyEmailParams{Token: auth.MakeVerificationToken("OtherSecretOtherSecretOtherSecret", saul.ID, "saul@example.com", time.Now().Add(time.Hour))}, http.StatusBadRequest, "invalid_verification_token"},
+		{"no token", "/api/users/verify", "", verifyEmailParams{}, http.StatusBadRequest, "validation_failed"},
+		{"resend when verified", "/api/users/verify/resend", saul.Token, nil, http.StatusConflict, "email_already_verified"},
+	}
+	doRequest(t, srv, "POST", "/api/users/verify", "", verifyEmailParams{Token: verificationToken("saul@example.com")}, nil)
+	for _, c := range cases {
+		p := problem{}
+		resp := doRequest(t, srv, "POST", c.path, c.token, c.body, &p)
+		if resp.StatusCode != c.status || p.Code != c.code {
+			t.Errorf("%v: %v %v != %v %v", c.comment, resp.StatusCode, p.Code, c.status, c.code)
+		}
+	}
+
+	resp = doRequest(t, srv, "POST", "/api/users/verify", "", verifyEmailParams{Token: newToken}, &verified)
+	if resp.StatusCode != http.StatusOK || !verified.EmailVerified || verified.Email != "lane@chirpy.example" {
+		t.Errorf("verify new email: %v, %+v", resp.StatusCode, verified)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	cfg, srv := newTestAPI(t)
+	mail := cfg.mailer.(*testMailer)
+	resetToken := func() string {
+		return mail.lastToken("lane@example.com", func(line string) bool {
+			return len(line) == 64 && strings.Trim(line, "0123456789abcdef") == ""
+		})
+	}
+
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	sent := mail.count("lane@example.com")
+
+	// Unknown emails get the same response, and no email.
+	for _, email := range []string{"lane@example.com", "nobody@example.com"} {
+		resp := doRequest(t, srv, "POST", "/api/password/forgot", "", forgotPasswordParams{Email: email}, nil)
+		if resp.StatusCode != http.StatusAccepted {
+			t.Errorf("forgot %v: %v != %v", email, resp.StatusCode, http.StatusAccepted)
+		}
+	}
+	// The emails are sent after the response.
+	cfg.background.Wait()
+	token := resetToken()
+	if token == "" || mail.count("lane@example.com") != sent+1 || mail.count("nobody@example.com") != 0 {
+		t.Fatalf("reset emails: token %q, %v emails", token, mail.count("lane@example.com"))
+	}
+
+	// A second request right away is throttled, silently.
+	resp := doRequest(t, srv, "POST", "/api/password/forgot", "", forgotPasswordParams{Email: "lane@example.com"}, nil)
+	cfg.background.Wait()
+	if resp.StatusCode != http.StatusAccepted || mail.count("lane@example.com") != sent+1 {
+		t.Errorf("forgot again: %v, %v emails", resp.StatusCode, mail.count("lane@example.com"))
+	}
+
+	cases := []struct {
+		comment string
+		body    resetPasswordParams
+		status  int
+		code    string
+	}{
+		{"weak password", resetPasswordParams{Token: token, Password: "short"}, http.StatusBadRequest, "validation_failed"},
+		{"unknown token", resetPasswordParams{Token: strings.Repeat("0", 64), Password: "new-secret-42"}, http.StatusBadRequest, "invalid_reset_token"},
+		{"valid token", resetPasswordParams{Token: token, Password: "new-secret-42"}, http.StatusNoContent, ""},
+		{"used token", resetPasswordParams{Token: token, Password: "other-secret-42"}, http.StatusBadRequest, "invalid_reset_token"},
+	}
+	for _, c := range cases {
+		p := problem{}
+		var out any = &p
+		if c.status == http.StatusNoContent {
+			out = nil
+		}
+		resp := doRequest(t, srv, "POST", "/api/password/reset", "", c.body, out)
+		if resp.StatusCode != c.status || p.Code != c.code {
+			t.Errorf("%v: %v %v != %v %v", c.comment, resp.StatusCode, p.Code, c.status, c.code)
+		}
+	}
+
+	resp = doRequest(t, srv, "POST", "/api/refresh", lane.RefreshToken, nil, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("refresh token after reset: %v != %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+	resp = doRequest(t, srv, "POST", "/api/login", "", userParams{Email: "lane@example.com", Password: "04234-secret"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("login with the old password: %v != %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+	resp = doRequest(t, srv, "POST", "/api/login", "", userParams{Email: "lane@example.com", Password: "new-secret-42"}, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("login with the new password: %v != %v", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestTOTPLogin(t *testing.T) {
+	_, srv := newTestAPI(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	credentials := userParams{Email: "lane@example.com", Password: "04234-secret"}
+	// Every accepted TOTP code has to be of a later step than the last one. The next step is accepted too, so the
+	// codes stay valid if the clock moves on during the test.
+	step := auth.TOTPStep(time.Now())
+	nextCode := func(secret string) string {
+		code, _ := auth.TOTPCode(secret, step)
+		step++
+		return code
+	}
+
+	enrollment := TOTPEnrollment{}
+	resp := doRequest(t, srv, "POST", "/api/mfa/totp", lane.Token, nil, &enrollment)
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(enrollment.OtpauthURI, "otpauth://totp/Chirpy:lane@example.com?") {
+		t.Fatalf("POST /api/mfa/totp: %v, %+v", resp.StatusCode, enrollment)
+	}
+
+	// TOTP isn't enabled before the first code.
+	resp = doRequest(t, srv, "POST", "/api/login", "", credentials, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("login before confirming: %v != %v", resp.StatusCode, http.StatusOK)
+	}
+
+	p := problem{}
+	resp = doRequest(t, srv, "POST", "/api/mfa/totp/confirm", lane.Token, totpCodeParams{Code: "000000"}, &p)
+	if resp.StatusCode != http.StatusUnauthorized || p.Code != "invalid_mfa_code" {
+		t.Errorf("confirm with a wrong code: %v %v", resp.StatusCode, p.Code)
+	}
+	codes := recoveryCodesResponse{}
+	resp = doRequest(t, srv, "POST", "/api/mfa/totp/confirm", lane.Token, totpCodeParams{Code: nextCode(enrollment.Secret)}, &codes)
+	if resp.StatusCode != http.StatusOK || len(codes.RecoveryCodes) != recoveryCodeCount {
+		t.Fatalf("POST /api/mfa/totp/confirm: %v, %+v", resp.StatusCode, codes)
+	}
+	resp = doRequest(t, srv, "POST", "/api/mfa/totp", lane.Token, nil, &p)
+	if resp.StatusCode != http.StatusConflict || p.Code != "mfa_already_enabled" {
+		t.Errorf("enroll when enabled: %v %v", resp.StatusCode, p.Code)
+	}
+
+	login := func() mfaChallenge {
+		t.Helper()
+		challenge := mfaChallenge{}
+		resp := doRequest(t, srv, "POST", "/api/login", "", credentials, &challenge)
+		if resp.StatusCode != http.StatusOK || !challenge.MFARequired || challenge.MFAToken == "" {
+			t.Fatalf("login with TOTP: %v, %+v", resp.StatusCode, challenge)
+		}
+		return challenge
+	}
+	challenge := login()
+
+	// The MFA token isn't an access token.
+	resp = doRequest(t, srv, "POST", "/api/chirps", challenge.MFAToken, chirpParams{Body: "Sneaky"}, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("MFA token as access token: %v != %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	code := nextCode(enrollment.Secret)
+	tokens := loginResponse{}
+	resp = doRequest(t, srv, "POST", "/api/login/mfa", "", loginMFAParams{MFAToken: challenge.MFAToken, Code: code}, &tokens)
+	if resp.StatusCode != http.StatusOK || tokens.Token == "" || tokens.RefreshToken == "" {
+		t.Fatalf("POST /api/login/mfa: %v, %+v", resp.StatusCode, tokens)
+	}
+
+	cases := []struct {
+		comment string
+		params  loginMFAParams
+		status  int
+		code    string
+	}{
+		{"code used already", loginMFAParams{MFAToken: challenge.MFAToken, Code: code}, http.StatusUnauthorized, "invalid_mfa_code"},
+		{"forged token", loginMFAParams{MFAToken: auth.MakeMFAToken("OtherSecretOtherSecretOtherSecret", lane.ID, "", time.Now().Add(time.Minute)), Code: code}, http.StatusUnauthorized, "invalid_mfa_token"},
+		{"garbage token", loginMFAParams{MFAToken: "garbage", Code: code}, http.StatusUnauthorized, "invalid_mfa_token"},
+		{"no code", loginMFAParams{MFAToken: challenge.MFAToken}, http.StatusBadRequest, "validation_failed"},
+	}
+	for _, c := range cases {
+		p := problem{}
+		resp := doRequest(t, srv, "POST", "/api/login/mfa", "", c.params, &p)
+		if resp.StatusCode != c.status || p.Code != c.code {
+			t.Errorf("%v: %v %v != %v %v", c.comment, resp.StatusCode, p.Code, c.status, c.code)
+		}
+	}
+
+	// A recovery code works once, typed in upper case or not.
+	recovery := loginMFAParams{MFAToken: login().MFAToken, Code: strings.ToUpper(codes.RecoveryCodes[0])}
+	resp = doRequest(t, srv, "POST", "/api/login/mfa", "", recovery, nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("login with a recovery code: %v != %v", resp.StatusCode, http.StatusOK)
+	}
+	resp = doRequest(t, srv, "POST", "/api/login/mfa", "", recovery, nil)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("recovery code used again: %v != %v", resp.StatusCode, http.StatusUnauthorized)
+	}
+
+	// Disabling needs the password and a code.
+	resp = doRequest(t, srv, "POST", "/api/mfa/totp/disable", tokens.Token, disableTOTPParams{Password: "wrong", Code: codes.RecoveryCodes[1]}, &p)
+	if resp.StatusCode != http.StatusUnauthorized || p.Code != "invalid_credentials" {
+		t.Errorf("disable with a wrong password: %v %v", resp.StatusCode, p.Code)
+	}
+	resp = doRequest(t, srv, "POST", "/api/mfa/totp/disable", tokens.Token, disableTOTPParams{Password: credentials.Password, Code: codes.RecoveryCodes[1]}, nil)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("POST /api/mfa/totp/disable: %v != %v", resp.StatusCode, http.StatusNoContent)
+	}
+	resp = doRequest(t, srv, "POST", "/api/login", "", credentials, &tokens)
+	if resp.StatusCode != http.StatusOK || tokens.Token == "" {
+		t.Errorf("login after disabling: %v, %+v", resp.StatusCode, tokens)
+	}
+}
+
+func TestTOTPLockout(t *testing.T) {
+	_, srv := newTestAPI(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	enrollment := TOTPEnrollment{}
+	doRequest(t, srv, "POST", "/api/mfa/totp", lane.Token, nil, &enrollment)
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	doRequest(t, srv, "POST", "/api/mfa/totp/confirm", lane.Token, totpCodeParams{Code: code}, nil)
+
+	challenge := mfaChallenge{}
+	doRequest(t, srv, "POST", "/api/login", "", userParams{Email: "lane@example.com", Password: "04234-secret"}, &challenge)
+	for i := 0; i < totpMaxAttempts; i++ {
+		doRequest(t, srv, "POST", "/api/login/mfa", "", loginMFAParams{MFAToken: challenge.MFAToken, Code: "wrong"}, nil)
+	}
+
+	// Even the right code is refused while the second factor is locked.
+	code, _ = auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now())+1)
+	p := problem{}
+	resp := doRequest(t, srv, "POST", "/api/login/mfa", "", loginMFAParams{MFAToken: challenge.MFAToken, Code: code}, &p)
+	if resp.StatusCode != http.StatusTooManyRequests || p.Code != "mfa_locked" || resp.Header.Get("Retry-After") == "" {
+		t.Errorf("login when locked: %v %v, Retry-After %q", resp.StatusCode, p.Code, resp.Header.Get("Retry-After"))
+	}
+}
+
+func TestTOTPLockoutConcurrent(t *testing.T) {
+	_, srv := newTestAPI(t)
+	lane := createUserAndLogin(t, srv, "lane@example.com")
+	enrollment := TOTPEnrollment{}
+	doRequest(t, srv, "POST", "/api/mfa/totp", lane.Token, nil, &enrollment)
+	code, _ := auth.TOTPCode(enrollment.Secret, auth.TOTPStep(time.Now()))
+	doRequest(t, srv, "POST", "/api/mfa/totp/confirm", lane.Token, totpCodeParams{Code: code}, nil)
+
+	challenge := mfaChallenge{}
+	doRequest(t, srv, "POST", "/api/login", "", userParams{Email: "lane@example.com", Password: "04234-secret"}, &challenge)
+
+	// However the requests interleave, only totpMaxAttempts codes are checked, the others find the second factor locked.
+	const requests = 4 * totpMaxAttempts
+	statuses := make(chan int, requests)
+	wg := sync.WaitGroup{}
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := doRequest(t, srv, "POST", "/api/login/mfa", "", loginMFAParams{MFAToken: challenge.MFAToken, Code: "wrong"}, nil)
+			statuses <- resp.StatusCode
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	counts := map[int]int{}
+	for status := range statuses {
+		counts[status]++
+	}
+	if counts[http.StatusUnauthorized] > totpMaxAttempts || counts[http.StatusUnauthorized]+counts[http.StatusTooManyRequests] != requests {
+		t.Errorf("%v codes checked of %v requests: %v", counts[http.StatusUnauthorized], requests, counts)
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/google/uuid"
+)
+
+type contextKey int
+
+const (
+	authInfoKey contextKey = iota
+	requestInfoKey
+)
+
+// authInfo is what requireAuth knows about the caller. It is stored in the request context.
+type authInfo struct {
+	UserId uuid.UUID
+}
+
+// requireAuth validates the access token in the Authorization header before calling next. Handlers behind it read the
+// caller with userIdFromContext. On failure it responds with 401 and a WWW-Authenticate header (RFC 6750).
+func (cfg *apiConfig) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		jwtToken, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+			respondWithProblem(w, r, problemUnauthenticated, "User isn't logged in, no JWT token available", err)
+			return
+		}
+		userId, err := cfg.jwtKeys.ValidateJWT(jwtToken)
+		if err != nil {
+			msg := jwtErrorMessage(err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="invalid_token", error_description="`+msg+`"`)
+			problem := problemInvalidToken
+			if errors.Is(err, auth.ErrTokenExpired) {
+				problem = problemTokenExpired
+			}
+			respondWithProblem(w, r, problem, msg, err)
+			return
+		}
+
+		if info := requestInfoFromContext(r.Context()); info != nil {
+			info.UserId = userId
+		}
+		ctx := context.WithValue(r.Context(), authInfoKey, authInfo{UserId: userId})
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// requireAdmin checks the Authorization header is `Bearer <ADMIN_KEY>` before calling next.
+func (cfg *apiConfig) requireAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, err := auth.GetBearerToken(r.Header)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy-admin"`)
+			respondWithProblem(w, r, problemInvalidAdminKey, "Admin key is missing", err)
+			return
+		}
+		if cfg.adminKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(cfg.adminKey)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy-admin", error="invalid_token"`)
+			respondWithProblem(w, r, problemInvalidAdminKey, "Admin key is wrong or ADMIN_KEY isn't configured", nil)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// userIdFromContext returns the id of the logged in user. It is only set for handlers wrapped in requireAuth.
+func userIdFromContext(ctx context.Context) (uuid.UUID, bool) {
+	info, ok := ctx.Value(authInfoKey).(authInfo)
+	return info.UserId, ok
+}
+
+// jwtErrorMessage tells the client why its access token was rejected. An expired token can be refreshed,
+// anything else means the token isn't ours or was tampered with.
+func jwtErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrTokenExpired):
+		return "JWT expired, use the refresh token to get a new one"
+	case errors.Is(err, auth.ErrTokenNotValidYet):
+		return "JWT isn't valid yet"
+	default:
+		return "JWT isn't validated"
+	}
+}
@@ -1,73 +1,117 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/PavelVaavra/http-server/internal/auth"
 	"github.com/PavelVaavra/http-server/internal/database"
 	"github.com/google/uuid"
 )
 
 type Chirp struct {
-	ID        uuid.UUID `json:"id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Body      string    `json:"body"`
-	UserId    uuid.UUID `json:"user_id"`
+	ID        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Body      string     `json:"body"`
+	UserId    uuid.UUID  `json:"user_id"`
+	InReplyTo *uuid.UUID `json:"in_reply_to"`
+	Deleted   bool       `json:"deleted,omitempty"`
 }
 
-func (cfg *apiConfig) createChirps(w http.ResponseWriter, r *http.Request) {
-	const validLength = 140
+// newChirp converts a chirp row to its JSON representation. Deleted chirps are tombstones which only keep their place in a thread.
+func newChirp(chirp database.Chirp) Chirp {
+	c := Chirp{
+		ID:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserId:    chirp.UserID,
+		Deleted:   chirp.DeletedAt.Valid,
+	}
+	if chirp.InReplyTo.Valid {
+		c.InReplyTo = &chirp.InReplyTo.UUID
+	}
+	return c
+}
 
-	type chirpParams struct {
-		Body string `json:"body"`
+const validChirpLength = 140
+
+var errChirpTooLong = errors.New("chirp is too long")
+
+type chirpParams struct {
+	Body string `json:"body"`
+}
+
+// validate only requires a body, its length is checked by cleanChirpBody, which has its own problem type.
+func (p chirpParams) validate() []fieldError {
+	if strings.TrimSpace(p.Body) == "" {
+		return []fieldError{{Field: "body", Message: "is required"}}
 	}
+	return nil
+}
 
-	jwtToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User isn't logged in, no JWT token available", err)
-		return
+func (cfg *apiConfig) createChirps(w http.ResponseWriter, r *http.Request) {
+	type createChirpParams struct {
+		chirpParams
+		InReplyTo *uuid.UUID `json:"in_reply_to"`
 	}
-	userId, err := auth.ValidateJWT(jwtToken, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User isn't logged in, JWT isn't validated", err)
+
+	userId, _ := userIdFromContext(r.Context())
+	if !cfg.requireVerifiedEmail(w, r, userId) {
 		return
 	}
 
-	decoder := json.NewDecoder(r.Body)
-	params := chirpParams{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not decode JSON", err)
+	params := createChirpParams{}
+	if !decodeJSON(w, r, &params) {
 		return
 	}
 
-	if len(params.Body) > validLength {
-		respondWithError(w, http.StatusBadRequest, "Chirp is too long", nil)
+	cleanedBody, err := cleanChirpBody(params.Body)
+	if err != nil {
+		respondWithProblem(w, r, problemChirpTooLong, "Chirp is too long", err, fieldError{Field: "body", Message: "has to be at most " + strconv.Itoa(validChirpLength) + " characters"})
 		return
 	}
 
-	cleanedBody := replaceProfaneWords(params.Body)
+	inReplyTo := uuid.NullUUID{}
+	if params.InReplyTo != nil {
+		parent, err := cfg.store.GetChirp(r.Context(), *params.InReplyTo)
+		if err != nil {
+			respondWithProblem(w, r, problemReplyToMissing, "Chirp you reply to doesn't exist", err, fieldError{Field: "in_reply_to", Message: "chirp doesn't exist"})
+			return
+		}
+		inReplyTo = uuid.NullUUID{UUID: parent.ID, Valid: true}
+	}
 
-	chirp, err := cfg.dbQueries.CreateChirp(r.Context(), database.CreateChirpParams{
-		Body:   cleanedBody,
-		UserID: userId,
+	var chirp database.Chirp
+	err = cfg.store.InTx(r.Context(), func(q database.Querier) error {
+		chirp, err = q.CreateChirp(r.Context(), database.CreateChirpParams{
+			Body:      cleanedBody,
+			UserID:    userId,
+			InReplyTo: inReplyTo,
+		})
+		if err != nil {
+			return err
+		}
+		return queueEvent(r.Context(), q, eventChirpCreated, userId, newChirp(chirp))
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not create chirp", err)
+		respondWithProblem(w, r, problemInternal, "Could not create chirp", err)
 		return
 	}
 
-	respondWithJson(w, http.StatusCreated, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserId:    chirp.UserID,
-	})
+	cfg.metrics.ChirpsCreated.Inc()
+	respondWithJson(w, http.StatusCreated, newChirp(chirp))
+}
+
+// cleanChirpBody is the pipeline every chirp body goes through before it is stored, both on create and on edit.
+func cleanChirpBody(body string) (string, error) {
+	if len(body) > validChirpLength {
+		return "", errChirpTooLong
+	}
+	return replaceProfaneWords(body), nil
 }
 
 func replaceProfaneWords(s string) string {
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxBodyBytes is far more than any request body of the API needs.
+	maxBodyBytes      = 64 << 10
+	maxEmailLength    = 254
+	minPasswordLength = 8
+	maxPasswordLength = 128
+)
+
+var errTrailingData = errors.New("data after the JSON value")
+
+// validator is implemented by request bodies which check their own fields after decoding.
+type validator interface {
+	validate() []fieldError
+}
+
+// decodeJSON decodes the JSON body of r into dst and validates it if dst is a validator. The body has to be a single
+// JSON object of at most maxBodyBytes without unknown fields. If anything is wrong, the problem response is already
+// written and ok is false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst any) (ok bool) {
+	return decodeBody(w, r, dst, false)
+}
+
+// decodeExternalJSON is decodeJSON for payloads of third parties, which may add fields at any time.
+func decodeExternalJSON(w http.ResponseWriter, r *http.Request, dst any) (ok bool) {
+	return decodeBody(w, r, dst, true)
+}
+
+func decodeBody(w http.ResponseWriter, r *http.Request, dst any, allowUnknownFields bool) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		respondWithProblem(w, r, problemUnsupportedMediaType, "Content-Type has to be application/json", err)
+		return false
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	decoder := json.NewDecoder(r.Body)
+	if !allowUnknownFields {
+		decoder.DisallowUnknownFields()
+	}
+	err = decoder.Decode(dst)
+	if err == nil && !errors.Is(decoder.Decode(&struct{}{}), io.EOF) {
+		err = errTrailingData
+	}
+	if err != nil {
+		respondWithDecodeError(w, r, err)
+		return false
+	}
+
+	if v, ok := dst.(validator); ok {
+		if fields := v.validate(); len(fields) > 0 {
+			respondWithProblem(w, r, problemValidation, "Request body has invalid fields", nil, fields...)
+			return false
+		}
+	}
+	return true
+}
+
+func respondWithDecodeError(w http.ResponseWriter, r *http.Request, err error) {
+	var maxBytesErr *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesErr):
+		respondWithProblem(w, r, problemBodyTooLarge, "Request body is larger than "+strconv.FormatInt(maxBytesErr.Limit, 10)+" bytes", err)
+	case errors.Is(err, errTrailingData):
+		respondWithProblem(w, r, problemInvalidJSON, "Request body has data after the JSON object", err)
+	case errors.Is(err, io.EOF):
+		respondWithProblem(w, r, problemInvalidJSON, "Request body is empty", err)
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		respondWithProblem(w, r, problemValidation, "Request body has invalid fields", err,
+			fieldError{Field: typeErr.Field, Message: "has to be a JSON " + typeErr.Value + " value of type " + typeErr.Type.String()})
+	case errors.As(err, &typeErr):
+		respondWithProblem(w, r, problemInvalidJSON, "Request body has to be a JSON object", err)
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		// encoding/json has no error type for unknown fields.
+		field := strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`)
+		respondWithProblem(w, r, problemValidation, "Request body has invalid fields", err, fieldError{Field: field, Message: "is unknown"})
+	default:
+		respondWithProblem(w, r, problemInvalidJSON, "Could not decode JSON: "+err.Error(), err)
+	}
+}
+
+// validateEmail returns what is wrong with email, or "".
+func validateEmail(email string) string {
+	if email == "" {
+		return "is required"
+	}
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || len(email) > maxEmailLength {
+		return "isn't a valid email address"
+	}
+	return ""
+}
+
+// validatePassword checks the password policy for new passwords. Logins accept any non-empty password, so a policy
+// change doesn't lock out old accounts.
+func validatePassword(password string) string {
+	length := utf8.RuneCountInString(password)
+	switch {
+	case password == "":
+		return "is required"
+	case length < minPasswordLength:
+		return "has to be at least " + strconv.Itoa(minPasswordLength) + " characters long"
+	case length > maxPasswordLength:
+		return "has to be at most " + strconv.Itoa(maxPasswordLength) + " characters long"
+	case strings.TrimSpace(password) == "":
+		return "can't be only whitespace"
+	}
+	return ""
+}
+
+// fieldErrors collects the fields whose message isn't empty.
+func fieldErrors(fields ...fieldError) []fieldError {
+	errs := []fieldError{}
+	for _, field := range fields {
+		if field.Message != "" {
+			errs = append(errs, field)
+		}
+	}
+	return errs
+}
@@ -1,9 +1,10 @@
 package main
 
 import (
+	"context"
 	"net/http"
 
-	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
 	"github.com/google/uuid"
 )
 
@@ -12,40 +13,71 @@ import (
 // - If they are not, return a 403 status code.
 // 2. If the chirp is deleted successfully, return a 204 status code.
 // 3. If the chirp is not found, return a 404 status code.
+// A chirp which has replies is not removed, it becomes a tombstone (empty body, deleted_at set, revisions dropped) so that the
+// thread below it stays connected.
 func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, r *http.Request) {
-	jwtToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User isn't logged in, no JWT token available", err)
+	chirp, ok := cfg.getOwnedChirp(w, r)
+	if !ok {
 		return
 	}
-	userId, err := auth.ValidateJWT(jwtToken, cfg.tokenSecret)
+
+	err := cfg.store.InTx(r.Context(), func(q database.Querier) error {
+		// The delete only happens if the chirp has no replies, checked in the same statement, so a reply can't sneak
+		// in between the check and the delete.
+		deleted, err := q.DeleteChirp(r.Context(), chirp.ID)
+		if err != nil {
+			return err
+		}
+		if deleted == 0 {
+			err = tombstoneChirp(r.Context(), q, chirp.ID)
+			if err != nil {
+				return err
+			}
+		}
+
+		// The body isn't sent, receivers should forget it.
+		return queueEvent(r.Context(), q, eventChirpDeleted, chirp.UserID, struct {
+			ID     uuid.UUID `json:"id"`
+			UserId uuid.UUID `json:"user_id"`
+		}{chirp.ID, chirp.UserID})
+	})
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User isn't logged in, JWT isn't validated", err)
+		respondWithProblem(w, r, problemInternal, "Chirp could not be deleted", err)
 		return
 	}
 
-	id, err := uuid.Parse(r.PathValue("chirpID"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func tombstoneChirp(ctx context.Context, q database.Querier, id uuid.UUID) error {
+	err := q.DeleteChirpRevisions(ctx, id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Invalid chirp UUID.", err)
-		return
+		return err
 	}
+	return q.TombstoneChirp(ctx, id)
+}
+
+// getOwnedChirp loads the chirp from the {chirpID} path value and checks that the logged in user is its author. It has to run behind requireAuth.
+// If anything fails, the error response is already written and ok is false.
+func (cfg *apiConfig) getOwnedChirp(w http.ResponseWriter, r *http.Request) (chirp database.Chirp, ok bool) {
+	userId, _ := userIdFromContext(r.Context())
 
-	chirp, err := cfg.dbQueries.GetChirp(r.Context(), id)
+	id, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Could not get chirp", err)
-		return
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid chirp UUID", err, fieldError{Field: "chirpID", Message: "isn't a UUID"})
+		return database.Chirp{}, false
 	}
 
-	if chirp.UserID != userId {
-		respondWithError(w, http.StatusForbidden, "Chirp wasn't created by the user who tries to delete it", err)
-		return
+	chirp, err = cfg.store.GetChirp(r.Context(), id)
+	if err != nil {
+		respondWithProblem(w, r, problemChirpNotFound, "Could not get chirp", err)
+		return database.Chirp{}, false
 	}
 
-	err = cfg.dbQueries.DeleteChirp(r.Context(), id)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Chirp could not be deleted", err)
-		return
+	if chirp.UserID != userId {
+		respondWithProblem(w, r, problemNotChirpAuthor, "Chirp wasn't created by the user who tries to change it", err)
+		return database.Chirp{}, false
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	return chirp, true
 }
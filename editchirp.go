@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+type ChirpRevision struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	ChirpId   uuid.UUID `json:"chirp_id"`
+	Body      string    `json:"body"`
+}
+
+// PUT /api/chirps/{chirpID} lets the author change the body of a chirp. The new body goes through the same checks as a new chirp.
+// The previous body is stored in chirp_revisions in the same transaction, so no edit is ever lost.
+func (cfg *apiConfig) updateChirp(w http.ResponseWriter, r *http.Request) {
+	chirp, ok := cfg.getOwnedChirp(w, r)
+	if !ok {
+		return
+	}
+
+	params := chirpParams{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	cleanedBody, err := cleanChirpBody(params.Body)
+	if err != nil {
+		respondWithProblem(w, r, problemChirpTooLong, "Chirp is too long", err, fieldError{Field: "body", Message: "has to be at most " + strconv.Itoa(validChirpLength) + " characters"})
+		return
+	}
+
+	err = cfg.store.InTx(r.Context(), func(q database.Querier) error {
+		// The revision is the body in the transaction, not the one getOwnedChirp read, so an edit in between isn't lost.
+		_, err := q.CreateChirpRevision(r.Context(), chirp.ID)
+		if err != nil {
+			return err
+		}
+
+		chirp, err = q.UpdateChirp(r.Context(), database.UpdateChirpParams{
+			Body: cleanedBody,
+			ID:   chirp.ID,
+		})
+		return err
+	})
+	// The chirp was deleted after getOwnedChirp.
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemChirpNotFound, "Could not get chirp", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not update chirp", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, newChirp(chirp))
+}
+
+// GET /api/chirps/{chirpID}/revisions returns the previous bodies of a chirp, oldest first.
+func (cfg *apiConfig) getChirpRevisions(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid chirp UUID", err, fieldError{Field: "chirpID", Message: "isn't a UUID"})
+		return
+	}
+
+	_, err = cfg.store.GetChirp(r.Context(), id)
+	if err != nil {
+		respondWithProblem(w, r, problemChirpNotFound, "Could not get chirp", err)
+		return
+	}
+
+	revisions, err := cfg.store.ListChirpRevisions(r.Context(), id)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list chirp revisions.", err)
+		return
+	}
+
+	payload := []ChirpRevision{}
+
+	for _, revision := range revisions {
+		payload = append(payload, ChirpRevision{
+			ID:        revision.ID,
+			CreatedAt: revision.CreatedAt,
+			ChirpId:   revision.ChirpID,
+			Body:      revision.Body,
+		})
+	}
+
+	respondWithJson(w, http.StatusOK, payload)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/pagination"
+	"github.com/google/uuid"
+)
+
+type Follow struct {
+	UserId     uuid.UUID `json:"user_id"`
+	FollowedAt time.Time `json:"followed_at"`
+}
+
+type followsPage struct {
+	Users      []Follow `json:"users"`
+	NextCursor string   `json:"next_cursor,omitempty"`
+}
+
+// POST /api/users/{userID}/follow makes the logged in user follow userID. Following somebody twice is not an error.
+func (cfg *apiConfig) followUser(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	followeeId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid user UUID", err, fieldError{Field: "userID", Message: "isn't a UUID"})
+		return
+	}
+	if followeeId == userId {
+		respondWithProblem(w, r, problemFollowSelf, "User can't follow themselves", nil)
+		return
+	}
+
+	_, err = cfg.store.GetUserById(r.Context(), followeeId)
+	if err != nil {
+		respondWithProblem(w, r, problemUserNotFound, "User not found", err)
+		return
+	}
+
+	err = cfg.store.FollowUser(r.Context(), database.FollowUserParams{
+		FollowerID: userId,
+		FolloweeID: followeeId,
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not follow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DELETE /api/users/{userID}/follow makes the logged in user stop following userID.
+func (cfg *apiConfig) unfollowUser(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	followeeId, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid user UUID", err, fieldError{Field: "userID", Message: "isn't a UUID"})
+		return
+	}
+
+	err = cfg.store.UnfollowUser(r.Context(), database.UnfollowUserParams{
+		FollowerID: userId,
+		FolloweeID: followeeId,
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not unfollow user", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/users/{userID}/followers?limit=...&cursor=... lists the users who follow userID, in the order they followed.
+func (cfg *apiConfig) getFollowers(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid user UUID", err, fieldError{Field: "userID", Message: "isn't a UUID"})
+		return
+	}
+
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.store.ListFollowers(r.Context(), database.ListFollowersParams{
+		FolloweeID:     id,
+		Limit:          p.fetchLimit(),
+		AfterCreatedAt: p.cursorCreatedAt(),
+		AfterID:        p.cursorID(),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list followers.", err)
+		return
+	}
+
+	follows := []Follow{}
+	for _, row := range rows {
+		follows = append(follows, Follow{
+			UserId:     row.UserID,
+			FollowedAt: row.CreatedAt,
+		})
+	}
+	respondWithFollowsPage(w, r, follows, p.limit)
+}
+
+// GET /api/users/{userID}/following?limit=...&cursor=... lists the users userID follows, in the order they were followed.
+func (cfg *apiConfig) getFollowing(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid user UUID", err, fieldError{Field: "userID", Message: "isn't a UUID"})
+		return
+	}
+
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.store.ListFollowing(r.Context(), database.ListFollowingParams{
+		FollowerID:     id,
+		Limit:          p.fetchLimit(),
+		AfterCreatedAt: p.cursorCreatedAt(),
+		AfterID:        p.cursorID(),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list followed users.", err)
+		return
+	}
+
+	follows := []Follow{}
+	for _, row := range rows {
+		follows = append(follows, Follow{
+			UserId:     row.UserID,
+			FollowedAt: row.CreatedAt,
+		})
+	}
+	respondWithFollowsPage(w, r, follows, p.limit)
+}
+
+func respondWithFollowsPage(w http.ResponseWriter, r *http.Request, follows []Follow, limit int) {
+	payload := followsPage{
+		Users: follows,
+	}
+
+	if len(follows) > limit {
+		payload.Users = follows[:limit]
+		last := payload.Users[limit-1]
+		payload.NextCursor = pagination.Cursor{CreatedAt: last.FollowedAt, ID: last.UserId}.Encode()
+		setNextLink(w, r, payload.NextCursor, limit)
+	}
+
+	respondWithJson(w, http.StatusOK, payload)
+}
+
+// GET /api/timeline?limit=...&cursor=... returns chirps of the users the logged in user follows, newest first.
+// The timeline is read from the chirps table on every request (fan-out-on-read), walking the (user_id, created_at, id) index.
+func (cfg *apiConfig) getTimeline(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	chirps, err := cfg.store.ListTimeline(r.Context(), database.ListTimelineParams{
+		FollowerID:      userId,
+		Limit:           p.fetchLimit(),
+		BeforeCreatedAt: p.cursorCreatedAt(),
+		BeforeID:        p.cursorID(),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list timeline.", err)
+		return
+	}
+
+	respondWithChirpsPage(w, r, chirps, p.limit)
+}
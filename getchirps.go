@@ -2,46 +2,81 @@ package main
 
 import (
 	"net/http"
-	"sort"
 
 	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/pagination"
 	"github.com/google/uuid"
 )
 
+type chirpsPage struct {
+	Chirps     []Chirp `json:"chirps"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+// GET /api/chirps?author_id=...&sort=asc|desc&limit=...&cursor=...
+// Chirps are ordered by (created_at, id) in SQL and returned one page at a time. If there are more chirps, the response contains
+// next_cursor and a Link header with rel="next" pointing at the following page.
 func (cfg *apiConfig) getAllChirps(w http.ResponseWriter, r *http.Request) {
-	s := r.URL.Query().Get("author_id")
+	query := r.URL.Query()
+
+	s := query.Get("author_id")
 	id, err := uuid.Parse(s)
 	if err != nil && s != "" {
-		respondWithError(w, http.StatusBadRequest, "Invalid author id", err)
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid author id", err, fieldError{Field: "author_id", Message: "isn't a UUID"})
+		return
+	}
+	authorId := uuid.NullUUID{UUID: id, Valid: s != ""}
+
+	sortQuery := query.Get("sort")
+	if sortQuery != "" && sortQuery != "asc" && sortQuery != "desc" {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid sort, use asc or desc", nil, fieldError{Field: "sort", Message: "has to be asc or desc"})
+		return
+	}
+
+	p, ok := parsePage(w, r)
+	if !ok {
 		return
 	}
 
 	var chirps []database.Chirp
-	if s != "" {
-		chirps, err = cfg.dbQueries.ListChirpsByUserId(r.Context(), id)
+	if sortQuery == "desc" {
+		chirps, err = cfg.store.ListChirpsDesc(r.Context(), database.ListChirpsDescParams{
+			Limit:           p.fetchLimit(),
+			UserID:          authorId,
+			BeforeCreatedAt: p.cursorCreatedAt(),
+			BeforeID:        p.cursorID(),
+		})
 	} else {
-		chirps, err = cfg.dbQueries.ListChirps(r.Context())
+		chirps, err = cfg.store.ListChirpsAsc(r.Context(), database.ListChirpsAscParams{
+			Limit:          p.fetchLimit(),
+			UserID:         authorId,
+			AfterCreatedAt: p.cursorCreatedAt(),
+			AfterID:        p.cursorID(),
+		})
 	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not list chirps.", err)
+		respondWithProblem(w, r, problemInternal, "Could not list chirps.", err)
 		return
 	}
 
-	sortQuery := r.URL.Query().Get("sort")
-	if sortQuery != "" && sortQuery == "desc" {
-		sort.Slice(chirps, func(i, j int) bool { return chirps[i].CreatedAt.After(chirps[j].CreatedAt) })
+	respondWithChirpsPage(w, r, chirps, p.limit)
+}
+
+// respondWithChirpsPage writes at most limit chirps and, if the query returned more, the cursor of the next page.
+func respondWithChirpsPage(w http.ResponseWriter, r *http.Request, chirps []database.Chirp, limit int) {
+	payload := chirpsPage{
+		Chirps: []Chirp{},
 	}
 
-	payload := []Chirp{}
+	if len(chirps) > limit {
+		chirps = chirps[:limit]
+		last := chirps[len(chirps)-1]
+		payload.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+		setNextLink(w, r, payload.NextCursor, limit)
+	}
 
 	for _, chirp := range chirps {
-		payload = append(payload, Chirp{
-			ID:        chirp.ID,
-			CreatedAt: chirp.CreatedAt,
-			UpdatedAt: chirp.UpdatedAt,
-			Body:      chirp.Body,
-			UserId:    chirp.UserID,
-		})
+		payload.Chirps = append(payload.Chirps, newChirp(chirp))
 	}
 
 	respondWithJson(w, http.StatusOK, payload)
@@ -50,21 +85,15 @@ func (cfg *apiConfig) getAllChirps(w http.ResponseWriter, r *http.Request) {
 func (cfg *apiConfig) getChirp(w http.ResponseWriter, r *http.Request) {
 	id, err := uuid.Parse(r.PathValue("chirpID"))
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Invalid chirp UUID.", err)
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid chirp UUID", err, fieldError{Field: "chirpID", Message: "isn't a UUID"})
 		return
 	}
 
-	chirp, err := cfg.dbQueries.GetChirp(r.Context(), id)
+	chirp, err := cfg.store.GetChirp(r.Context(), id)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, "Could not get chirp.", err)
+		respondWithProblem(w, r, problemChirpNotFound, "Could not get chirp", err)
 		return
 	}
 
-	respondWithJson(w, http.StatusOK, Chirp{
-		ID:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserId:    chirp.UserID,
-	})
+	respondWithJson(w, http.StatusOK, newChirp(chirp))
 }
@@ -18,37 +18,32 @@ import (
 // Set ExpiresAt to the current time plus the expiration time (expiresIn)
 // Set the Subject to a stringified version of the user's id
 // Use token.SignedString to sign the token with the secret key.
+// It is KeySet.MakeJWT of a KeySet without keys, with the DefaultValidator's issuer and audiences.
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
-	now := time.Now().UTC()
-	claims := &jwt.RegisteredClaims{
-		Issuer:    "chirpy",
-		IssuedAt:  jwt.NewNumericDate(now),
-		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
-		Subject:   userID.String(),
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	ss, err := token.SignedString([]byte(tokenSecret))
-	if err != nil {
-		return "", err
-	}
-	return ss, nil
+	return NewKeySet(tokenSecret).MakeJWT(userID, expiresIn)
 }
 
 // Use the jwt.ParseWithClaims function to validate the signature of the JWT and extract the claims into a *jwt.Token struct.
 // An error will be returned if the token is invalid or has expired.
 // If all is well with the token, use the token.Claims interface to get access to the user's id from the claims
 // (which should be stored in the Subject field). Return the id as a uuid.UUID.
+// It is KeySet.ValidateJWT of a KeySet without keys, so it checks the claims of the DefaultValidator and its errors
+// wrap the ErrToken... errors.
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
-	claims := jwt.RegisteredClaims{}
+	return NewKeySet(tokenSecret).ValidateJWT(tokenString)
+}
 
-	token, err := jwt.ParseWithClaims(tokenString, &claims, func(token *jwt.Token) (any, error) {
-		return []byte(tokenSecret), nil
-	})
-	if err != nil {
-		return uuid.Nil, err
+func newClaims(userID uuid.UUID, expiresIn time.Duration) *jwt.RegisteredClaims {
+	now := time.Now().UTC()
+	return &jwt.RegisteredClaims{
+		Issuer:    "chirpy",
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiresIn)),
+		Subject:   userID.String(),
 	}
+}
 
+func subjectUUID(token *jwt.Token) (uuid.UUID, error) {
 	idString, err := token.Claims.GetSubject()
 	if err != nil {
 		return uuid.Nil, err
@@ -78,17 +73,3 @@ func GetBearerToken(headers http.Header) (string, error) {
 	}
 	return parts[1], nil
 }
-
-// Authorization: ApiKey THE_KEY_HERE
-func GetAPIKey(headers http.Header) (string, error) {
-	rawValue := headers.Get("Authorization")
-	if rawValue == "" {
-		return "", fmt.Errorf("no authorization header")
-	}
-	rawValue = strings.TrimSpace(rawValue)
-	parts := strings.SplitN(rawValue, " ", 2)
-	if len(parts) != 2 || parts[0] != "ApiKey" {
-		return "", fmt.Errorf("header value not in format \"ApiKey THE_KEY_HERE\"")
-	}
-	return parts[1], nil
-}
@@ -1,6 +1,7 @@
 package auth
 
 import (
+	"errors"
 	"net/http"
 	"testing"
 	"time"
@@ -60,6 +61,27 @@ func TestMakeJWTValidateJWT(t *testing.T) {
 	}
 }
 
+func TestValidateJWTErrors(t *testing.T) {
+	id := uuid.New()
+	valid, _ := MakeJWT(id, "AllYourBase", time.Hour)
+	expired, _ := MakeJWT(id, "AllYourBase", -time.Hour)
+	cases := []struct {
+		token  string
+		secret string
+		err    error
+	}{
+		{valid, "allYourBase", ErrTokenSignature},
+		{expired, "AllYourBase", ErrTokenExpired},
+		{"not a token", "AllYourBase", ErrTokenMalformed},
+	}
+	for _, c := range cases {
+		_, err := ValidateJWT(c.token, c.secret)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%v != %v", err, c.err)
+		}
+	}
+}
+
 func TestBearerHeader(t *testing.T) {
 	cases := []struct {
 		headers           http.Header
@@ -0,0 +1,299 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// KeySet signs JWTs with one asymmetric key (RS256 or EdDSA) and verifies them with any of its keys. Every key is identified by
+// its kid, the RFC 7638 thumbprint of the public key, which is written into the JWT header.
+// To rotate, load the new key as the signing key and keep the old one as a verification key until the last token signed by it expires.
+// If no signing key is loaded, the KeySet falls back to HS256 with the token secret, the way MakeJWT and ValidateJWT work.
+// Once one is loaded, HS256 tokens are rejected unless AcceptHS256 allows them while the last of them expire.
+type KeySet struct {
+	hmacSecret  []byte
+	acceptHS256 bool
+	signingKey  *jwk
+	keys        map[string]*jwk
+	validator   Validator
+}
+
+type jwk struct {
+	kid        string
+	method     jwt.SigningMethod
+	privateKey crypto.Signer
+	publicKey  crypto.PublicKey
+}
+
+// JWK is the JSON Web Key representation of a public key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func NewKeySet(tokenSecret string) *KeySet {
+	return &KeySet{
+		hmacSecret: []byte(tokenSecret),
+		keys:       make(map[string]*jwk),
+		validator:  DefaultValidator(),
+	}
+}
+
+// SetValidator replaces DefaultValidator. The issuer and audiences are also used for new tokens. It returns an error
+// and keeps the old validator if RequiredClaims names a claim which isn't registered.
+func (ks *KeySet) SetValidator(v Validator) error {
+	err := v.validate()
+	if err != nil {
+		return err
+	}
+	ks.validator = v
+	return nil
+}
+
+// AcceptHS256 keeps accepting HS256 tokens signed with the token secret after a signing key is loaded. It is meant for
+// the switch to a signing key only: whoever has the token secret can make such tokens, and the token secret also signs
+// other tokens, so it can't be retired.
+func (ks *KeySet) AcceptHS256(accept bool) {
+	ks.acceptHS256 = accept
+}
+
+// LoadSigningKey reads a PEM encoded RSA or Ed25519 private key (PKCS #8, or PKCS #1 for RSA) and signs all new tokens with it.
+func (ks *KeySet) LoadSigningKey(path string) error {
+	key, err := readPEMKey(path)
+	if err != nil {
+		return err
+	}
+	if key.privateKey == nil {
+		return fmt.Errorf("%v: signing key has to be a private key", path)
+	}
+	ks.keys[key.kid] = key
+	ks.signingKey = key
+	return nil
+}
+
+// LoadVerificationKey reads a PEM encoded RSA or Ed25519 public (or private) key which is only used to verify tokens.
+func (ks *KeySet) LoadVerificationKey(path string) error {
+	key, err := readPEMKey(path)
+	if err != nil {
+		return err
+	}
+	key.privateKey = nil
+	if _, ok := ks.keys[key.kid]; !ok {
+		ks.keys[key.kid] = key
+	}
+	return nil
+}
+
+// MakeJWT creates an access token with the issuer and audiences of the validator, signed with the signing key
+// (or HS256 with the token secret if there is none).
+func (ks *KeySet) MakeJWT(userID uuid.UUID, expiresIn time.Duration) (string, error) {
+	claims := newClaims(userID, expiresIn)
+	claims.Issuer = ks.validator.Issuer
+	claims.Audience = ks.validator.Audiences
+
+	if ks.signingKey == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(ks.hmacSecret)
+	}
+
+	token := jwt.NewWithClaims(ks.signingKey.method, claims)
+	token.Header["kid"] = ks.signingKey.kid
+	ss, err := token.SignedString(ks.signingKey.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return ss, nil
+}
+
+// ValidateJWT checks the signature with the key the kid header points at, then the claims according to the validator,
+// and returns the user's id. The algorithm is pinned to the key, so a token can't pick a different one (e.g. HS256 with
+// the public key as the secret). Errors wrap one of the ErrToken... errors.
+func (ks *KeySet) ValidateJWT(tokenString string) (uuid.UUID, error) {
+	claims := jwt.RegisteredClaims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, &claims, ks.keyfunc, ks.validator.parserOptions()...)
+	if err != nil {
+		return uuid.Nil, classifyError(err)
+	}
+
+	err = ks.validator.checkRequiredClaims(&claims)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	id, err := subjectUUID(token)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%w: %v", ErrTokenMalformed, err)
+	}
+	return id, nil
+}
+
+func (ks *KeySet) keyfunc(token *jwt.Token) (any, error) {
+	err := ks.validator.checkAlgorithm(token)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		// Tokens without kid were signed with the token secret.
+		if len(ks.hmacSecret) == 0 || token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("token has no kid")
+		}
+		if ks.signingKey != nil && !ks.acceptHS256 {
+			return nil, fmt.Errorf("token has no kid, HS256 tokens aren't accepted once a signing key is loaded")
+		}
+		return ks.hmacSecret, nil
+	}
+
+	key, ok := ks.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("kid %q doesn't use algorithm %v", kid, token.Method.Alg())
+	}
+	return key.publicKey, nil
+}
+
+// JWKS returns the public part of every key, so other services can verify our tokens.
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{
+		Keys: []JWK{},
+	}
+	for _, key := range ks.keys {
+		jwks.Keys = append(jwks.Keys, key.jwk())
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool { return jwks.Keys[i].Kid < jwks.Keys[j].Kid })
+	return jwks
+}
+
+func (k *jwk) jwk() JWK {
+	out := JWK{
+		Kid: k.kid,
+		Use: "sig",
+		Alg: k.method.Alg(),
+	}
+	switch pub := k.publicKey.(type) {
+	case *rsa.PublicKey:
+		out.Kty = "RSA"
+		out.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		out.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		out.Kty = "OKP"
+		out.Crv = "Ed25519"
+		out.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return out
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, the required members in lexicographic order.
+func thumbprint(publicKey crypto.PublicKey) (string, error) {
+	var members any
+	switch pub := publicKey.(type) {
+	case *rsa.PublicKey:
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		}
+	case ed25519.PublicKey:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{
+			Crv: "Ed25519",
+			Kty: "OKP",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}
+	default:
+		return "", fmt.Errorf("unsupported key type %T", publicKey)
+	}
+	dat, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(dat)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func readPEMKey(path string) (*jwk, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(dat)
+	if block == nil {
+		return nil, fmt.Errorf("%v: no PEM block found", path)
+	}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PUBLIC KEY":
+		parsed, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%v: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	key := &jwk{}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.privateKey, key.publicKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.publicKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.privateKey, key.publicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.publicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("%v: unsupported key type %T, use RSA or Ed25519", path, parsed)
+	}
+	if pub, ok := key.publicKey.(*rsa.PublicKey); ok && pub.N.BitLen() < 2048 {
+		return nil, fmt.Errorf("%v: RSA key has to be at least 2048 bits", path)
+	}
+
+	key.kid, err = thumbprint(key.publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return key, nil
+}
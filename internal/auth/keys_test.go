@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func writeRSAKey(t *testing.T, dir, name string) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	dat := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(path, dat, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func writeEd25519Key(t *testing.T, dir, name string) (privatePath, publicPath string) {
+	t.Helper()
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privDer, _ := x509.MarshalPKCS8PrivateKey(priv)
+	pubDer, _ := x509.MarshalPKIXPublicKey(pub)
+	privatePath = filepath.Join(dir, name)
+	publicPath = filepath.Join(dir, name+".pub")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return privatePath, publicPath
+}
+
+func TestKeySetSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	rsaPath := writeRSAKey(t, dir, "rsa.pem")
+	edPath, _ := writeEd25519Key(t, dir, "ed25519.pem")
+
+	for _, path := range []string{rsaPath, edPath} {
+		ks := NewKeySet("")
+		if err := ks.LoadSigningKey(path); err != nil {
+			t.Fatalf("LoadSigningKey(%v) returns an error %v", path, err.Error())
+		}
+		id := uuid.New()
+		tokenString, err := ks.MakeJWT(id, time.Hour)
+		if err != nil {
+			t.Fatalf("MakeJWT(%v) returns an error %v", id, err.Error())
+		}
+		validatedId, err := ks.ValidateJWT(tokenString)
+		if err != nil {
+			t.Errorf("ValidateJWT(%v) returns an error %v", tokenString, err.Error())
+		}
+		if validatedId != id {
+			t.Errorf("%v != %v", validatedId, id)
+		}
+
+		expired, _ := ks.MakeJWT(id, -time.Hour)
+		if _, err := ks.ValidateJWT(expired); err == nil {
+			t.Errorf("ValidateJWT(%v) accepts an expired token", expired)
+		}
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, oldPublicPath := writeEd25519Key(t, dir, "old.pem")
+	newPath := writeRSAKey(t, dir, "new.pem")
+
+	oldKs := NewKeySet("")
+	if err := oldKs.LoadSigningKey(oldPath); err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	oldToken, _ := oldKs.MakeJWT(id, time.Hour)
+
+	rotatedKs := NewKeySet("")
+	if err := rotatedKs.LoadSigningKey(newPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotatedKs.ValidateJWT(oldToken); err == nil {
+		t.Errorf("ValidateJWT accepts a token signed by an unknown key")
+	}
+	if err := rotatedKs.LoadVerificationKey(oldPublicPath); err != nil {
+		t.Fatal(err)
+	}
+	validatedId, err := rotatedKs.ValidateJWT(oldToken)
+	if err != nil {
+		t.Errorf("ValidateJWT(%v) returns an error %v", oldToken, err.Error())
+	}
+	if validatedId != id {
+		t.Errorf("%v != %v", validatedId, id)
+	}
+
+	jwks := rotatedKs.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Errorf("%v != %v", len(jwks.Keys), 2)
+	}
+	for _, key := range jwks.Keys {
+		if key.Kid == "" || (key.Kty == "RSA" && key.Alg != "RS256") || (key.Kty == "OKP" && key.Alg != "EdDSA") {
+			t.Errorf("unexpected JWK %+v", key)
+		}
+	}
+}
+
+func TestKeySetRejectsAlgorithmConfusion(t *testing.T) {
+	dir := t.TempDir()
+	rsaPath := writeRSAKey(t, dir, "rsa.pem")
+
+	ks := NewKeySet("AllYourBase")
+	if err := ks.LoadSigningKey(rsaPath); err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+
+	// Tokens signed with the token secret stop being valid once the key is configured, unless AcceptHS256 allows
+	// them while they expire.
+	hmacToken, _ := NewKeySet("AllYourBase").MakeJWT(id, time.Hour)
+	if _, err := ks.ValidateJWT(hmacToken); err == nil {
+		t.Errorf("ValidateJWT(%v) accepts an HS256 token after LoadSigningKey", hmacToken)
+	}
+	ks.AcceptHS256(true)
+	if _, err := ks.ValidateJWT(hmacToken); err != nil {
+		t.Errorf("ValidateJWT(%v) returns an error %v", hmacToken, err.Error())
+	}
+
+	forged, _ := NewKeySet("allYourBase").MakeJWT(id, time.Hour)
+	if _, err := ks.ValidateJWT(forged); err == nil {
+		t.Errorf("ValidateJWT(%v) accepts a token signed with a wrong secret", forged)
+	}
+}
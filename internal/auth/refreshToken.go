@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -10,3 +11,10 @@ func MakeRefreshToken() (string, error) {
 	rand.Read(refreshToken)
 	return hex.EncodeToString(refreshToken), nil
 }
+
+// Only the SHA-256 digest of a refresh token is stored in the database, so a leaked table can't be used to replay sessions.
+// Refresh tokens are 32 random bytes, there is nothing to brute force, so a plain (unsalted) hash is enough and keeps lookups by digest possible.
+func HashRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])
+}
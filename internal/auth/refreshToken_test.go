@@ -0,0 +1,33 @@
+package auth
+
+import (
+	"testing"
+)
+
+func TestHashRefreshToken(t *testing.T) {
+	cases := []struct {
+		input    string
+		expected string
+	}{
+		{
+			input:    "",
+			expected: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		},
+		{
+			input:    "abc",
+			expected: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad",
+		},
+	}
+
+	for _, c := range cases {
+		actual := HashRefreshToken(c.input)
+		if actual != c.expected {
+			t.Errorf("%v != %v", actual, c.expected)
+		}
+	}
+
+	refreshToken, _ := MakeRefreshToken()
+	if HashRefreshToken(refreshToken) == refreshToken {
+		t.Errorf("HashRefreshToken(\"%v\") returns the token itself", refreshToken)
+	}
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// signedToken is a kind of stateless token for a user: the base64url user id and expiry, a dot, and the base64url
+// HMAC-SHA256 of the purpose, them and a binding with a secret. The binding isn't in the token, it is a value of the
+// user the token is only valid with, so the token stops being valid when that value changes. The purpose keeps one
+// kind of token from being accepted as another, even with the same secret.
+type signedToken struct {
+	purpose    string
+	errInvalid error
+	errExpired error
+}
+
+func (k signedToken) make(secret string, userID uuid.UUID, binding string, expiresAt time.Time) string {
+	payload := make([]byte, 0, 24)
+	payload = append(payload, userID[:]...)
+	payload = binary.BigEndian.AppendUint64(payload, uint64(expiresAt.Unix()))
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(k.mac(secret, payload, binding))
+}
+
+// user returns the user id of token without checking it, so the caller can look up the binding.
+func (k signedToken) user(token string) (uuid.UUID, error) {
+	payload, _, err := k.split(token)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.UUID(payload[:16]), nil
+}
+
+func (k signedToken) validate(secret, token, binding string, now time.Time) error {
+	payload, mac, err := k.split(token)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal(mac, k.mac(secret, payload, binding)) {
+		return k.errInvalid
+	}
+	expiresAt := time.Unix(int64(binary.BigEndian.Uint64(payload[16:])), 0)
+	if !now.Before(expiresAt) {
+		return k.errExpired
+	}
+	return nil
+}
+
+func (k signedToken) split(token string) (payload, mac []byte, err error) {
+	encodedPayload, encodedMAC, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, nil, k.errInvalid
+	}
+	payload, err = base64.RawURLEncoding.DecodeString(encodedPayload)
+	if err != nil || len(payload) != 24 {
+		return nil, nil, k.errInvalid
+	}
+	mac, err = base64.RawURLEncoding.DecodeString(encodedMAC)
+	if err != nil {
+		return nil, nil, k.errInvalid
+	}
+	return payload, mac, nil
+}
+
+func (k signedToken) mac(secret string, payload []byte, binding string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(k.purpose))
+	mac.Write([]byte{0})
+	mac.Write(payload)
+	mac.Write([]byte(binding))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrTOTPSecretInvalid = errors.New("TOTP secret isn't base32")
+	ErrTOTPCodeInvalid   = errors.New("TOTP code doesn't match")
+
+	ErrMFATokenInvalid = errors.New("MFA token is malformed or its signature doesn't match")
+	ErrMFATokenExpired = errors.New("MFA token expired")
+)
+
+// TOTP parameters of RFC 6238 which every authenticator app supports: HMAC-SHA1, 6 digits, 30 second steps.
+const (
+	TOTPDigits = 6
+	TOTPPeriod = 30 * time.Second
+	// totpSkew is how many steps before and after the current one are accepted, for clocks which are a bit off.
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// MakeTOTPSecret returns a new TOTP secret, 20 random bytes (the size of an HMAC-SHA1 key) in unpadded base32 as
+// authenticator apps expect it.
+func MakeTOTPSecret() string {
+	secret := make([]byte, 20)
+	rand.Read(secret)
+	return totpEncoding.EncodeToString(secret)
+}
+
+// TOTPURI returns the otpauth:// URI for secret, which authenticator apps read from a QR code. account names the
+// user in the app, issuer the service.
+func TOTPURI(secret, issuer, account string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TOTPDigits))
+	query.Set("period", fmt.Sprint(int(TOTPPeriod.Seconds())))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: query.Encode(),
+	}
+	return u.String()
+}
+
+// TOTPStep returns the RFC 6238 time step of t, the counter the code is computed from.
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod.Seconds())
+}
+
+// TOTPCode returns the code for secret at step, the RFC 4226 HOTP of the step truncated to TOTPDigits digits.
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return "", ErrTOTPSecretInvalid
+	}
+	mac := hmac.New(sha1.New, key)
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(step)))
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	modulo := uint32(1)
+	for range TOTPDigits {
+		modulo *= 10
+	}
+	return fmt.Sprintf("%0*d", TOTPDigits, value%modulo), nil
+}
+
+// ValidateTOTP checks code for secret at now, accepting totpSkew steps either side. It returns the step the code
+// belongs to, so the caller can refuse a code which was used already.
+func ValidateTOTP(secret, code string, now time.Time) (int64, error) {
+	current := TOTPStep(now)
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		expected, err := TOTPCode(secret, step)
+		if err != nil {
+			return 0, err
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, nil
+		}
+	}
+	return 0, ErrTOTPCodeInvalid
+}
+
+// MakeRecoveryCodes returns n new recovery codes like "k3mz-q7ta-x2vn-8wbe", 80 random bits each, for when the
+// authenticator app is lost.
+func MakeRecoveryCodes(n int) []string {
+	codes := make([]string, n)
+	for i := range codes {
+		raw := make([]byte, 10)
+		rand.Read(raw)
+		code := strings.ToLower(totpEncoding.EncodeToString(raw))
+		codes[i] = code[0:4] + "-" + code[4:8] + "-" + code[8:12] + "-" + code[12:16]
+	}
+	return codes
+}
+
+// HashRecoveryCode returns the SHA-256 digest a recovery code is stored as. Like refresh tokens the codes are random,
+// so a plain hash is enough. Case, dashes and spaces don't matter, so a code typed from paper still matches.
+func HashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(normalized))
+	return hex.EncodeToString(sum[:])
+}
+
+var mfaToken = signedToken{
+	purpose:    "chirpy-mfa-pending",
+	errInvalid: ErrMFATokenInvalid,
+	errExpired: ErrMFATokenExpired,
+}
+
+// MakeMFAToken returns the token of a login which checked the password and waits for the second factor. It is bound
+// to the password hash, so it stops being valid when the password changes, and it isn't an access token.
+func MakeMFAToken(secret string, userID uuid.UUID, passwordHash string, expiresAt time.Time) string {
+	return mfaToken.make(secret, userID, passwordHash, expiresAt)
+}
+
+// MFATokenUser returns the user id of a token made by MakeMFAToken without checking it, so the caller can look up
+// the password hash ValidateMFAToken needs.
+func MFATokenUser(token string) (uuid.UUID, error) {
+	return mfaToken.user(token)
+}
+
+// ValidateMFAToken checks that token was made by MakeMFAToken with secret for passwordHash and hasn't expired at now.
+func ValidateMFAToken(secret, token, passwordHash string, now time.Time) error {
+	return mfaToken.validate(secret, token, passwordHash, now)
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// rfc6238Secret is the SHA1 key of the RFC 6238 test vectors, "12345678901234567890", in base32.
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// The RFC 6238 appendix B codes are 8 digits, these are their last 6.
+	cases := []struct {
+		unix     int64
+		expected string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, c := range cases {
+		actual, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(c.unix, 0)))
+		if err != nil || actual != c.expected {
+			t.Errorf("%v: %v != %v (%v)", c.unix, actual, c.expected, err)
+		}
+	}
+
+	_, err := TOTPCode("not base32!", 1)
+	if !errors.Is(err, ErrTOTPSecretInvalid) {
+		t.Errorf("%v != %v", err, ErrTOTPSecretInvalid)
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := TOTPStep(now)
+	code := func(step int64) string {
+		c, _ := TOTPCode(rfc6238Secret, step)
+		return c
+	}
+
+	cases := []struct {
+		comment string
+		code    string
+		step    int64
+		err     error
+	}{
+		{"current step", code(step), step, nil},
+		{"previous step", code(step - 1), step - 1, nil},
+		{"next step", code(step + 1), step + 1, nil},
+		{"two steps ago", code(step - 2), 0, ErrTOTPCodeInvalid},
+		{"wrong code", "000000", 0, ErrTOTPCodeInvalid},
+		{"empty", "", 0, ErrTOTPCodeInvalid},
+	}
+
+	for _, c := range cases {
+		step, err := ValidateTOTP(rfc6238Secret, c.code, now)
+		if step != c.step || !errors.Is(err, c.err) {
+			t.Errorf("%v: %v, %v != %v, %v", c.comment, step, err, c.step, c.err)
+		}
+	}
+}
+
+func TestTOTPSecretAndURI(t *testing.T) {
+	secret := MakeTOTPSecret()
+	if len(secret) != 32 || secret == MakeTOTPSecret() {
+		t.Errorf("unexpected secret %v", secret)
+	}
+	_, err := TOTPCode(secret, 1)
+	if err != nil {
+		t.Errorf("TOTPCode of a new secret: %v", err)
+	}
+
+	u, err := url.Parse(TOTPURI(secret, "Chirpy", "lane@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Chirpy:lane@example.com" {
+		t.Errorf("unexpected URI %v", u)
+	}
+	if u.Query().Get("secret") != secret || u.Query().Get("issuer") != "Chirpy" || u.Query().Get("digits") != "6" {
+		t.Errorf("unexpected query %v", u.Query())
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes := MakeRecoveryCodes(10)
+	seen := map[string]bool{}
+	for _, code := range codes {
+		if len(code) != 19 || strings.Count(code, "-") != 3 || seen[code] {
+			t.Errorf("unexpected code %v", code)
+		}
+		seen[code] = true
+	}
+
+	hash := HashRecoveryCode(codes[0])
+	for _, typed := range []string{strings.ToUpper(codes[0]), strings.ReplaceAll(codes[0], "-", " "), strings.ReplaceAll(codes[0], "-", "")} {
+		if HashRecoveryCode(typed) != hash {
+			t.Errorf("%v doesn't match %v", typed, codes[0])
+		}
+	}
+	if HashRecoveryCode(codes[1]) == hash {
+		t.Errorf("%v matches %v", codes[1], codes[0])
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := "AllYourBaseAreBelongToUsAllYourBase"
+	userID := uuid.New()
+	token := MakeMFAToken(secret, userID, "hash", now.Add(time.Minute))
+
+	id, err := MFATokenUser(token)
+	if err != nil || id != userID {
+		t.Errorf("MFATokenUser returns %v, %v", id, err)
+	}
+
+	cases := []struct {
+		comment string
+		token   string
+		hash    string
+		now     time.Time
+		err     error
+	}{
+		{"valid", token, "hash", now, nil},
+		{"expired", token, "hash", now.Add(time.Minute), ErrMFATokenExpired},
+		{"password changed", token, "other hash", now, ErrMFATokenInvalid},
+		{"verification token", MakeVerificationToken(secret, userID, "hash", now.Add(time.Minute)), "hash", now, ErrMFATokenInvalid},
+	}
+
+	for _, c := range cases {
+		err := ValidateMFAToken(secret, c.token, c.hash, c.now)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%v: %v != %v", c.comment, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Errors returned by KeySet.ValidateJWT. Every error wraps exactly one of them, use errors.Is to tell them apart,
+// e.g. an expired token should make the client refresh, a forged one shouldn't.
+var (
+	ErrTokenMalformed    = errors.New("token is malformed")
+	ErrTokenSignature    = errors.New("token signature is invalid")
+	ErrTokenAlgorithm    = errors.New("token algorithm is not allowed")
+	ErrTokenExpired      = errors.New("token is expired")
+	ErrTokenNotValidYet  = errors.New("token is not valid yet")
+	ErrTokenIssuer       = errors.New("token has invalid issuer")
+	ErrTokenAudience     = errors.New("token has invalid audience")
+	ErrTokenClaimMissing = errors.New("token is missing required claim")
+)
+
+// Validator configures which tokens KeySet.ValidateJWT accepts.
+type Validator struct {
+	// Issuer is written into the iss claim of new tokens and has to match on validation.
+	Issuer string
+	// Audiences are written into the aud claim of new tokens, a token has to contain at least one of them.
+	Audiences []string
+	// Algorithms lists the accepted alg headers, on top of the algorithm being pinned to the key.
+	Algorithms []string
+	// Leeway is the allowed clock skew for exp, nbf and iat.
+	Leeway time.Duration
+	// RequiredClaims lists registered claims (exp, iat, nbf, iss, aud, sub, jti) which have to be present.
+	RequiredClaims []string
+}
+
+func DefaultValidator() Validator {
+	return Validator{
+		Issuer:         "chirpy",
+		Audiences:      []string{"chirpy"},
+		Algorithms:     []string{jwt.SigningMethodHS256.Alg(), jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()},
+		Leeway:         30 * time.Second,
+		RequiredClaims: []string{"exp", "iat", "iss", "aud", "sub"},
+	}
+}
+
+func (v Validator) parserOptions() []jwt.ParserOption {
+	options := []jwt.ParserOption{
+		jwt.WithLeeway(v.Leeway),
+		jwt.WithIssuedAt(),
+	}
+	if v.Issuer != "" {
+		options = append(options, jwt.WithIssuer(v.Issuer))
+	}
+	if len(v.Audiences) > 0 {
+		options = append(options, jwt.WithAudience(v.Audiences...))
+	}
+	if slices.Contains(v.RequiredClaims, "exp") {
+		options = append(options, jwt.WithExpirationRequired())
+	}
+	return options
+}
+
+func (v Validator) checkAlgorithm(token *jwt.Token) error {
+	if !slices.Contains(v.Algorithms, token.Method.Alg()) {
+		return fmt.Errorf("%w: %v", ErrTokenAlgorithm, token.Method.Alg())
+	}
+	return nil
+}
+
+// registeredClaims are the claims RequiredClaims may name, with whether a token has them.
+var registeredClaims = map[string]func(claims *jwt.RegisteredClaims) bool{
+	"exp": func(c *jwt.RegisteredClaims) bool { return c.ExpiresAt != nil },
+	"iat": func(c *jwt.RegisteredClaims) bool { return c.IssuedAt != nil },
+	"nbf": func(c *jwt.RegisteredClaims) bool { return c.NotBefore != nil },
+	"iss": func(c *jwt.RegisteredClaims) bool { return c.Issuer != "" },
+	"aud": func(c *jwt.RegisteredClaims) bool { return len(c.Audience) > 0 },
+	"sub": func(c *jwt.RegisteredClaims) bool { return c.Subject != "" },
+	"jti": func(c *jwt.RegisteredClaims) bool { return c.ID != "" },
+}
+
+// validate rejects a configuration ValidateJWT can't apply, so a mistake shows up when the validator is set instead
+// of as an error of every token.
+func (v Validator) validate() error {
+	for _, claim := range v.RequiredClaims {
+		if _, ok := registeredClaims[claim]; !ok {
+			return fmt.Errorf("unknown required claim %q", claim)
+		}
+	}
+	if v.Leeway < 0 {
+		return fmt.Errorf("leeway %v is negative", v.Leeway)
+	}
+	return nil
+}
+
+func (v Validator) checkRequiredClaims(claims *jwt.RegisteredClaims) error {
+	for _, claim := range v.RequiredClaims {
+		if !registeredClaims[claim](claims) {
+			return fmt.Errorf("%w: %v", ErrTokenClaimMissing, claim)
+		}
+	}
+	return nil
+}
+
+// classifyError maps the errors of the jwt package to the errors above.
+func classifyError(err error) error {
+	var kind error
+	switch {
+	case errors.Is(err, ErrTokenAlgorithm):
+		return err
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		kind = ErrTokenMalformed
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		kind = ErrTokenSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		kind = ErrTokenExpired
+	case errors.Is(err, jwt.ErrTokenNotValidYet), errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		kind = ErrTokenNotValidYet
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		kind = ErrTokenIssuer
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		kind = ErrTokenAudience
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		kind = ErrTokenClaimMissing
+	default:
+		kind = ErrTokenMalformed
+	}
+	return fmt.Errorf("%w: %v", kind, err)
+}
@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestKeySetValidateJWTErrors(t *testing.T) {
+	const secret = "AllYourBase"
+	now := time.Now()
+	validClaims := func() jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Issuer:    "chirpy",
+			Audience:  jwt.ClaimStrings{"chirpy"},
+			Subject:   uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}
+	}
+	sign := func(method jwt.SigningMethod, claims jwt.RegisteredClaims, key any) string {
+		ss, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ss
+	}
+
+	cases := []struct {
+		name          string
+		token         string
+		errorExpected error
+	}{
+		{
+			name:          "valid",
+			token:         sign(jwt.SigningMethodHS256, validClaims(), []byte(secret)),
+			errorExpected: nil,
+		},
+		{
+			name: "expired within leeway",
+			token: func() string {
+				c := validClaims()
+				c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+				return sign(jwt.SigningMethodHS256, c, []byte(secret))
+			}(),
+			errorExpected: nil,
+		},
+		{
+			name: "expired",
+			token: func() string {
+				c := validClaims()
+				c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Hour))
+				return sign(jwt.SigningMethodHS256, c, []byte(secret))
+			}(),
+			errorExpected: ErrTokenExpired,
+		},
+		{
+			name:          "wrong secret",
+			token:         sign(jwt.SigningMethodHS256, validClaims(), []byte("allYourBase")),
+			errorExpected: ErrTokenSignature,
+		},
+		{
+			name:          "algorithm none",
+			token:         sign(jwt.SigningMethodNone, validClaims(), jwt.UnsafeAllowNoneSignatureType),
+			errorExpected: ErrTokenAlgorithm,
+		},
+		{
+			name:          "algorithm not allowed",
+			token:         sign(jwt.SigningMethodHS512, validClaims(), []byte(secret)),
+			errorExpected: ErrTokenAlgorithm,
+		},
+		{
+			name: "wrong issuer",
+			token: func() string {
+				c := validClaims()
+				c.Issuer = "somebody"
+				return sign(jwt.SigningMethodHS256, c, []byte(secret))
+			}(),
+			errorExpected: ErrTokenIssuer,
+		},
+		{
+			name: "wrong audience",
+			token: func() string {
+				c := validClaims()
+				c.Audience = jwt.ClaimStrings{"somebody"}
+				return sign(jwt.SigningMethodHS256, c, []byte(secret))
+			}(),
+			errorExpected: ErrTokenAudience,
+		},
+		{
+			name: "issued in the future",
+			token: func() string {
+				c := validClaims()
+				c.IssuedAt = jwt.NewNumericDate(now.Add(time.Hour))
+				return sign(jwt.SigningMethodHS256, c, []byte(secret))
+			}(),
+			errorExpected: ErrTokenNotValidYet,
+		},
+		{
+			name: "missing subject",
+			token: func() string {
+				c := validClaims()
+				c.Subject = ""
+				return sign(jwt.SigningMethodHS256, c, []byte(secret))
+			}(),
+			errorExpected: ErrTokenClaimMissing,
+		},
+		{
+			name:          "garbage",
+			token:         "not.a.token",
+			errorExpected: ErrTokenMalformed,
+		},
+	}
+
+	ks := NewKeySet(secret)
+	v := DefaultValidator()
+	v.RequiredClaims = append(v.RequiredClaims, "email")
+	err := ks.SetValidator(v)
+	if err == nil {
+		t.Errorf("SetValidator accepts the unknown required claim email")
+	}
+	for _, c := range cases {
+		_, err := ks.ValidateJWT(c.token)
+		if c.errorExpected == nil && err != nil {
+			t.Errorf("%v: ValidateJWT returns an error %v", c.name, err.Error())
+		}
+		if c.errorExpected != nil && !errors.Is(err, c.errorExpected) {
+			t.Errorf("%v: %v is not %v", c.name, err, c.errorExpected)
+		}
+	}
+}
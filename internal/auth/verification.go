@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrVerificationTokenInvalid = errors.New("verification token is malformed or its signature doesn't match")
+	ErrVerificationTokenExpired = errors.New("verification token expired")
+)
+
+var verificationToken = signedToken{
+	purpose:    "chirpy-email-verification",
+	errInvalid: ErrVerificationTokenInvalid,
+	errExpired: ErrVerificationTokenExpired,
+}
+
+// MakeVerificationToken returns a token which proves that whoever holds it received an email sent to email. It is
+// bound to the email, so it stops being valid when the user changes their email.
+func MakeVerificationToken(secret string, userID uuid.UUID, email string, expiresAt time.Time) string {
+	return verificationToken.make(secret, userID, email, expiresAt)
+}
+
+// VerificationTokenUser returns the user id of a token made by MakeVerificationToken without checking it, so the
+// caller can look up the email ValidateVerificationToken needs.
+func VerificationTokenUser(token string) (uuid.UUID, error) {
+	return verificationToken.user(token)
+}
+
+// ValidateVerificationToken checks that token was made by MakeVerificationToken with secret for email and hasn't
+// expired at now.
+func ValidateVerificationToken(secret, token, email string, now time.Time) error {
+	return verificationToken.validate(secret, token, email, now)
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestVerificationToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	secret := "AllYourBaseAreBelongToUsAllYourBase"
+	userID := uuid.New()
+	token := MakeVerificationToken(secret, userID, "lane@example.com", now.Add(time.Hour))
+
+	id, err := VerificationTokenUser(token)
+	if err != nil || id != userID {
+		t.Errorf("VerificationTokenUser returns %v, %v", id, err)
+	}
+
+	cases := []struct {
+		comment string
+		secret  string
+		token   string
+		email   string
+		now     time.Time
+		err     error
+	}{
+		{"valid", secret, token, "lane@example.com", now, nil},
+		{"expired", secret, token, "lane@example.com", now.Add(time.Hour), ErrVerificationTokenExpired},
+		{"email changed", secret, token, "saul@example.com", now, ErrVerificationTokenInvalid},
+		{"other secret", "OtherSecretOtherSecretOtherSecret", token, "lane@example.com", now, ErrVerificationTokenInvalid},
+		{"other user", secret, MakeVerificationToken(secret, uuid.New(), "saul@example.com", now.Add(time.Hour))[:32] + token[32:], "lane@example.com", now, ErrVerificationTokenInvalid},
+		{"no signature", secret, token[:32], "lane@example.com", now, ErrVerificationTokenInvalid},
+		{"empty", secret, "", "lane@example.com", now, ErrVerificationTokenInvalid},
+	}
+
+	for _, c := range cases {
+		err := ValidateVerificationToken(c.secret, c.token, c.email, c.now)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%v: %v != %v", c.comment, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyWebhook(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1","event":"user.upgraded"}`)
+	tolerance := 5 * time.Minute
+	current := "current-secret-0123456789"
+	previous := "previous-secret-0123456789"
+	signed := SignWebhook(current, now, body)
+
+	cases := []struct {
+		comment string
+		header  string
+		body    []byte
+		secrets []string
+		err     error
+	}{
+		{"valid", signed, body, []string{current}, nil},
+		{"signed with the previous secret", SignWebhook(previous, now, body), body, []string{current, previous}, nil},
+		{"sender sends two signatures", SignWebhook("unknown-secret", now, body) + "," + strings.Split(signed, ",")[1], body, []string{current}, nil},
+		{"slightly in the future", SignWebhook(current, now.Add(time.Minute), body), body, []string{current}, nil},
+		{"missing header", "", body, []string{current}, ErrWebhookSignatureMissing},
+		{"no signature", "t=1700000000", body, []string{current}, ErrWebhookSignatureMissing},
+		{"no timestamp", strings.Split(signed, ",")[1], body, []string{current}, ErrWebhookSignatureMissing},
+		{"too old", SignWebhook(current, now.Add(-tolerance-time.Second), body), body, []string{current}, ErrWebhookTimestampExpired},
+		{"too far in the future", SignWebhook(current, now.Add(tolerance+time.Second), body), body, []string{current}, ErrWebhookTimestampExpired},
+		{"changed body", signed, []byte(`{"id":"evt_1","event":"user.downgraded"}`), []string{current}, ErrWebhookSignatureMismatch},
+		{"changed timestamp", strings.Replace(signed, "t=1700000000", "t=1700000001", 1), body, []string{current}, ErrWebhookSignatureMismatch},
+		{"retired secret", SignWebhook(previous, now, body), body, []string{current}, ErrWebhookSignatureMismatch},
+	}
+
+	for _, c := range cases {
+		err := VerifyWebhook(c.header, c.body, c.secrets, now, tolerance)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%v: %v != %v", c.comment, err, c.err)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: chirp_revisions.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createChirpRevision = `-- name: CreateChirpRevision :one
+INSERT INTO chirp_revisions (id, created_at, chirp_id, body)
+SELECT gen_random_uuid(), NOW(), chirps.id, chirps.body FROM chirps
+WHERE chirps.id = $1 AND chirps.deleted_at IS NULL
+FOR UPDATE
+RETURNING id, created_at, chirp_id, body
+`
+
+// CreateChirpRevision saves the current body of the chirp, unless it was deleted. It locks the chirp, so a concurrent
+// edit waits and then saves the body this one sets.
+func (q *Queries) CreateChirpRevision(ctx context.Context, chirpID uuid.UUID) (ChirpRevision, error) {
+	row := q.db.QueryRowContext(ctx, createChirpRevision, chirpID)
+	var i ChirpRevision
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.ChirpID,
+		&i.Body,
+	)
+	return i, err
+}
+
+const deleteChirpRevisions = `-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = $1
+`
+
+func (q *Queries) DeleteChirpRevisions(ctx context.Context, chirpID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirpRevisions, chirpID)
+	return err
+}
+
+const listChirpRevisions = `-- name: ListChirpRevisions :many
+SELECT id, created_at, chirp_id, body FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.ChirpID,
+			&i.Body,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
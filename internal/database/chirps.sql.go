@@ -7,25 +7,28 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID, arg.InReplyTo)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -33,23 +36,32 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
+const deleteChirp = `-- name: DeleteChirp :execrows
 DELETE FROM chirps
-WHERE id = $1
+WHERE chirps.id = $1 AND NOT EXISTS (
+    SELECT 1 FROM chirps AS replies
+    WHERE replies.in_reply_to = chirps.id
+)
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
+// DeleteChirp returns 0 if the chirp has replies, such a chirp is tombstoned instead.
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE id = $1 AND deleted_at IS NULL
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -61,17 +73,161 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
 	)
 	return i, err
 }
 
-const listChirps = `-- name: ListChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, parent.deleted_at,
+        1 AS depth
+    FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = $1
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at,
+        a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON a.in_reply_to = c.id
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM ancestors
+ORDER BY depth DESC
+`
+
+type ListChirpAncestorsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+}
+
+func (q *Queries) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]ListChirpAncestorsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpAncestorsRow
+	for rows.Next() {
+		var i ListChirpAncestorsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at,
+        0 AS depth
+    FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at,
+        d.depth + 1
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE d.depth < $3::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, depth FROM descendants
+ORDER BY depth, created_at, id
+LIMIT $2
 `
 
-func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, listChirps)
+type ListChirpDescendantsParams struct {
+	ID       uuid.UUID
+	MaxRows  int32
+	MaxDepth int32
+}
+
+type ListChirpDescendantsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+	Depth     int32
+}
+
+func (q *Queries) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]ListChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants, arg.ID, arg.MaxRows, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpDescendantsRow
+	for rows.Next() {
+		var i ListChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE deleted_at IS NULL
+AND ($2::uuid IS NULL OR user_id = $2::uuid)
+AND ($3::timestamp IS NULL
+    OR (created_at, id) > ($3::timestamp, $4::uuid))
+ORDER BY created_at, id
+LIMIT $1
+`
+
+type ListChirpsAscParams struct {
+	Limit          int32
+	UserID         uuid.NullUUID
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.Limit,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +241,8 @@ func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -99,14 +257,30 @@ func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
 	return items, nil
 }
 
-const listChirpsByUserId = `-- name: ListChirpsByUserId :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE user_id = $1
-ORDER BY created_at
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE deleted_at IS NULL
+AND ($2::uuid IS NULL OR user_id = $2::uuid)
+AND ($3::timestamp IS NULL
+    OR (created_at, id) < ($3::timestamp, $4::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $1
 `
 
-func (q *Queries) ListChirpsByUserId(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, listChirpsByUserId, userID)
+type ListChirpsDescParams struct {
+	Limit           int32
+	UserID          uuid.NullUUID
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.Limit,
+		arg.UserID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -120,6 +294,8 @@ func (q *Queries) ListChirpsByUserId(ctx context.Context, userID uuid.UUID) ([]C
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -133,3 +309,41 @@ func (q *Queries) ListChirpsByUserId(ctx context.Context, userID uuid.UUID) ([]C
 	}
 	return items, nil
 }
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+UPDATE chirps
+SET updated_at = NOW(), deleted_at = NOW(), body = ''
+WHERE id = $1
+`
+
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET updated_at = NOW(), body = $1
+WHERE id = $2 AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
+`
+
+type UpdateChirpParams struct {
+	Body string
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.Body, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,94 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: password_resets.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const countPasswordResetsSince = `-- name: CountPasswordResetsSince :one
+SELECT COUNT(*) FROM password_resets
+WHERE user_id = $1 AND created_at >= $2::timestamp
+`
+
+type CountPasswordResetsSinceParams struct {
+	UserID uuid.UUID
+	Since  time.Time
+}
+
+func (q *Queries) CountPasswordResetsSince(ctx context.Context, arg CountPasswordResetsSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countPasswordResetsSince, arg.UserID, arg.Since)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+const createPasswordReset = `-- name: CreatePasswordReset :one
+INSERT INTO password_resets (token_hash, created_at, user_id, expires_at)
+VALUES (
+    $1, NOW(), $2, $3
+)
+RETURNING token_hash, created_at, user_id, expires_at, used_at
+`
+
+type CreatePasswordResetParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+}
+
+func (q *Queries) CreatePasswordReset(ctx context.Context, arg CreatePasswordResetParams) (PasswordReset, error) {
+	row := q.db.QueryRowContext(ctx, createPasswordReset, arg.TokenHash, arg.UserID, arg.ExpiresAt)
+	var i PasswordReset
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
+
+const invalidatePasswordResets = `-- name: InvalidatePasswordResets :exec
+UPDATE password_resets
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL
+`
+
+func (q *Queries) InvalidatePasswordResets(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, invalidatePasswordResets, userID)
+	return err
+}
+
+const usePasswordReset = `-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > $2::timestamp
+RETURNING token_hash, created_at, user_id, expires_at, used_at
+`
+
+type UsePasswordResetParams struct {
+	TokenHash string
+	Now       time.Time
+}
+
+// UsePasswordReset returns no row if the token is unknown, used or expired at now.
+func (q *Queries) UsePasswordReset(ctx context.Context, arg UsePasswordResetParams) (PasswordReset, error) {
+	row := q.db.QueryRowContext(ctx, usePasswordReset, arg.TokenHash, arg.Now)
+	var i PasswordReset
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.UsedAt,
+	)
+	return i, err
+}
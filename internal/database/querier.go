@@ -0,0 +1,105 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Querier interface {
+	CancelSubscription(ctx context.Context, id uuid.UUID) (Subscription, error)
+	// ClaimWebhookDeliveries leases the due deliveries until lease_until, so no other instance sends them meanwhile.
+	ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ClearTOTPFailures(ctx context.Context, userID uuid.UUID) error
+	CountPasswordResetsSince(ctx context.Context, arg CountPasswordResetsSinceParams) (int64, error)
+	CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error)
+	// CreateChirpRevision saves the current body of the chirp, unless it was deleted. It locks the chirp, so a concurrent
+	// edit waits and then saves the body this one sets.
+	CreateChirpRevision(ctx context.Context, chirpID uuid.UUID) (ChirpRevision, error)
+	CreatePasswordReset(ctx context.Context, arg CreatePasswordResetParams) (PasswordReset, error)
+	CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error
+	CreateSubscription(ctx context.Context, arg CreateSubscriptionParams) (Subscription, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error)
+	CreateWebhookDeliveryAttempt(ctx context.Context, arg CreateWebhookDeliveryAttemptParams) (WebhookDeliveryAttempt, error)
+	CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error)
+	CreateWebhookEvent(ctx context.Context, arg CreateWebhookEventParams) (WebhookEvent, error)
+	DeleteAllUsers(ctx context.Context) error
+	// DeleteChirp returns 0 if the chirp has replies, such a chirp is tombstoned instead.
+	DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error)
+	DeleteChirpRevisions(ctx context.Context, chirpID uuid.UUID) error
+	DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error
+	DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error
+	DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error
+	EnableTOTP(ctx context.Context, arg EnableTOTPParams) (int64, error)
+	ExpireSubscriptions(ctx context.Context, endedBefore time.Time) ([]Subscription, error)
+	FollowUser(ctx context.Context, arg FollowUserParams) error
+	GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error)
+	GetLatestSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error)
+	GetOpenSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error)
+	GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error)
+	GetTOTPSecret(ctx context.Context, userID uuid.UUID) (TotpSecret, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserById(ctx context.Context, id uuid.UUID) (User, error)
+	GetWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error)
+	GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (WebhookEndpoint, error)
+	GetWebhookEvent(ctx context.Context, id uuid.UUID) (WebhookEvent, error)
+	GetWebhookEventByEventID(ctx context.Context, eventID string) (WebhookEvent, error)
+	InvalidatePasswordResets(ctx context.Context, userID uuid.UUID) error
+	ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]ListChirpAncestorsRow, error)
+	ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]ListChirpDescendantsRow, error)
+	ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error)
+	ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error)
+	ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error)
+	ListFollowers(ctx context.Context, arg ListFollowersParams) ([]ListFollowersRow, error)
+	ListFollowing(ctx context.Context, arg ListFollowingParams) ([]ListFollowingRow, error)
+	ListTimeline(ctx context.Context, arg ListTimelineParams) ([]Chirp, error)
+	ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error)
+	ListWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]WebhookDeliveryAttempt, error)
+	ListWebhookEndpoints(ctx context.Context, userID uuid.NullUUID) ([]WebhookEndpoint, error)
+	ListWebhookEndpointsForUser(ctx context.Context, userID uuid.NullUUID) ([]WebhookEndpoint, error)
+	ListWebhookEvents(ctx context.Context, arg ListWebhookEventsParams) ([]WebhookEvent, error)
+	MarkSubscriptionPastDue(ctx context.Context, id uuid.UUID) (Subscription, error)
+	// MarkVerificationSent returns 0 if the email is verified or the last verification email was sent after sent_before.
+	MarkVerificationSent(ctx context.Context, arg MarkVerificationSentParams) (int64, error)
+	MarkWebhookEventFailed(ctx context.Context, arg MarkWebhookEventFailedParams) error
+	MarkWebhookEventProcessed(ctx context.Context, id uuid.UUID) (int64, error)
+	// RecordTOTPFailure locks the second factor until lock_until once max_attempts failed attempts are counted, and
+	// starts counting again.
+	RecordTOTPFailure(ctx context.Context, arg RecordTOTPFailureParams) (TotpSecret, error)
+	RefreshToken(ctx context.Context, arg RefreshTokenParams) (RefreshToken, error)
+	RenewSubscription(ctx context.Context, arg RenewSubscriptionParams) (Subscription, error)
+	RevokeActiveRefreshToken(ctx context.Context, tokenHash string) (int64, error)
+	RevokeRefreshToken(ctx context.Context, tokenHash string) error
+	RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error
+	RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error
+	SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) (int64, error)
+	// StartTOTPAttempt counts an attempt before its code is checked, so concurrent requests can't check more than
+	// max_attempts codes before the lock. It returns 0 if the second factor is locked or max_attempts attempts are counted
+	// already. Attempts counted before stale_before, which were never recorded as failed, don't count anymore.
+	StartTOTPAttempt(ctx context.Context, arg StartTOTPAttemptParams) (int64, error)
+	TombstoneChirp(ctx context.Context, id uuid.UUID) error
+	UnfollowUser(ctx context.Context, arg UnfollowUserParams) error
+	UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error)
+	// A new email isn't verified.
+	UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error)
+	UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error
+	UpdateWebhookDeliveryAttempt(ctx context.Context, arg UpdateWebhookDeliveryAttemptParams) (WebhookDelivery, error)
+	// A new enrollment replaces one which wasn't confirmed, it returns no row if TOTP is enabled already.
+	UpsertTOTPSecret(ctx context.Context, arg UpsertTOTPSecretParams) (TotpSecret, error)
+	// UsePasswordReset returns no row if the token is unknown, used or expired at now.
+	UsePasswordReset(ctx context.Context, arg UsePasswordResetParams) (PasswordReset, error)
+	// UseRecoveryCode returns 0 if the code is unknown or used, or the second factor is locked.
+	UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error)
+	// UseTOTPStep returns 0 if a code of the step or a later one was used already, or the second factor is locked.
+	UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error)
+	// The email is checked, so a verification of an email the user changed since doesn't count.
+	VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error)
+}
+
+var _ Querier = (*Queries)(nil)
@@ -0,0 +1,201 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: subscriptions.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const cancelSubscription = `-- name: CancelSubscription :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'canceled', ended_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+func (q *Queries) CancelSubscription(ctx context.Context, id uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, cancelSubscription, id)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const createSubscription = `-- name: CreateSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, current_period_start, current_period_end)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, 'active', $2, $3
+)
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+type CreateSubscriptionParams struct {
+	UserID             uuid.UUID
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+}
+
+func (q *Queries) CreateSubscription(ctx context.Context, arg CreateSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, createSubscription, arg.UserID, arg.CurrentPeriodStart, arg.CurrentPeriodEnd)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const expireSubscriptions = `-- name: ExpireSubscriptions :many
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'expired', ended_at = NOW()
+WHERE status IN ('active', 'past_due') AND current_period_end < $1
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+func (q *Queries) ExpireSubscriptions(ctx context.Context, endedBefore time.Time) ([]Subscription, error) {
+	rows, err := q.db.QueryContext(ctx, expireSubscriptions, endedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Subscription
+	for rows.Next() {
+		var i Subscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Status,
+			&i.CurrentPeriodStart,
+			&i.CurrentPeriodEnd,
+			&i.EndedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestSubscription = `-- name: GetLatestSubscription :one
+SELECT id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at FROM subscriptions
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getLatestSubscription, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const getOpenSubscription = `-- name: GetOpenSubscription :one
+SELECT id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at FROM subscriptions
+WHERE user_id = $1 AND status IN ('active', 'past_due')
+`
+
+func (q *Queries) GetOpenSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getOpenSubscription, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const markSubscriptionPastDue = `-- name: MarkSubscriptionPastDue :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'past_due'
+WHERE id = $1
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+func (q *Queries) MarkSubscriptionPastDue(ctx context.Context, id uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, markSubscriptionPastDue, id)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const renewSubscription = `-- name: RenewSubscription :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'active', current_period_start = $2, current_period_end = $3
+WHERE id = $1
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+type RenewSubscriptionParams struct {
+	ID                 uuid.UUID
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+}
+
+func (q *Queries) RenewSubscription(ctx context.Context, arg RenewSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, renewSubscription, arg.ID, arg.CurrentPeriodStart, arg.CurrentPeriodEnd)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
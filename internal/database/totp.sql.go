@@ -0,0 +1,195 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: totp.sql
+
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const clearTOTPFailures = `-- name: ClearTOTPFailures :exec
+UPDATE totp_secrets
+SET updated_at = NOW(), failed_attempts = 0
+WHERE user_id = $1
+`
+
+func (q *Queries) ClearTOTPFailures(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, clearTOTPFailures, userID)
+	return err
+}
+
+const deleteTOTPSecret = `-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteTOTPSecret, userID)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :execrows
+UPDATE totp_secrets
+SET updated_at = NOW(), enabled_at = NOW(), last_used_step = $2::bigint
+WHERE user_id = $1 AND enabled_at IS NULL
+`
+
+type EnableTOTPParams struct {
+	UserID uuid.UUID
+	Step   int64
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableTOTP, arg.UserID, arg.Step)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getTOTPSecret = `-- name: GetTOTPSecret :one
+SELECT user_id, created_at, updated_at, secret, enabled_at, last_used_step, failed_attempts, locked_until FROM totp_secrets
+WHERE user_id = $1
+`
+
+func (q *Queries) GetTOTPSecret(ctx context.Context, userID uuid.UUID) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, getTOTPSecret, userID)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const recordTOTPFailure = `-- name: RecordTOTPFailure :one
+UPDATE totp_secrets
+SET updated_at = NOW(),
+    failed_attempts = CASE WHEN failed_attempts >= $2::int THEN 0 ELSE failed_attempts END,
+    locked_until = CASE WHEN failed_attempts >= $2::int THEN $3::timestamp ELSE locked_until END
+WHERE user_id = $1
+RETURNING user_id, created_at, updated_at, secret, enabled_at, last_used_step, failed_attempts, locked_until
+`
+
+type RecordTOTPFailureParams struct {
+	UserID      uuid.UUID
+	MaxAttempts int32
+	LockUntil   time.Time
+}
+
+// RecordTOTPFailure locks the second factor until lock_until once max_attempts failed attempts are counted, and
+// starts counting again.
+func (q *Queries) RecordTOTPFailure(ctx context.Context, arg RecordTOTPFailureParams) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, recordTOTPFailure, arg.UserID, arg.MaxAttempts, arg.LockUntil)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const startTOTPAttempt = `-- name: StartTOTPAttempt :execrows
+UPDATE totp_secrets
+SET updated_at = NOW(),
+    failed_attempts = CASE WHEN failed_attempts >= $2::int THEN 1 ELSE failed_attempts + 1 END
+WHERE user_id = $1 AND enabled_at IS NOT NULL
+AND (locked_until IS NULL OR locked_until <= $3::timestamp)
+AND (failed_attempts < $2::int OR updated_at < $4::timestamp)
+`
+
+type StartTOTPAttemptParams struct {
+	UserID      uuid.UUID
+	MaxAttempts int32
+	Now         time.Time
+	StaleBefore time.Time
+}
+
+// StartTOTPAttempt counts an attempt before its code is checked, so concurrent requests can't check more than
+// max_attempts codes before the lock. It returns 0 if the second factor is locked or max_attempts attempts are counted
+// already. Attempts counted before stale_before, which were never recorded as failed, don't count anymore.
+func (q *Queries) StartTOTPAttempt(ctx context.Context, arg StartTOTPAttemptParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, startTOTPAttempt,
+		arg.UserID,
+		arg.MaxAttempts,
+		arg.Now,
+		arg.StaleBefore,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertTOTPSecret = `-- name: UpsertTOTPSecret :one
+INSERT INTO totp_secrets (user_id, created_at, updated_at, secret)
+VALUES (
+    $1, NOW(), NOW(), $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET created_at = NOW(), updated_at = NOW(), secret = excluded.secret,
+    last_used_step = NULL, failed_attempts = 0, locked_until = NULL
+WHERE totp_secrets.enabled_at IS NULL
+RETURNING user_id, created_at, updated_at, secret, enabled_at, last_used_step, failed_attempts, locked_until
+`
+
+type UpsertTOTPSecretParams struct {
+	UserID uuid.UUID
+	Secret string
+}
+
+// A new enrollment replaces one which wasn't confirmed, it returns no row if TOTP is enabled already.
+func (q *Queries) UpsertTOTPSecret(ctx context.Context, arg UpsertTOTPSecretParams) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, upsertTOTPSecret, arg.UserID, arg.Secret)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE totp_secrets
+SET updated_at = NOW(), last_used_step = $2::bigint, failed_attempts = 0
+WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < $2::bigint)
+AND (locked_until IS NULL OR locked_until <= $3::timestamp)
+`
+
+type UseTOTPStepParams struct {
+	UserID uuid.UUID
+	Step   int64
+	Now    time.Time
+}
+
+// UseTOTPStep returns 0 if a code of the step or a later one was used already, or the second factor is locked.
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.UserID, arg.Step, arg.Now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
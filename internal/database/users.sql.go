@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/google/uuid"
 )
@@ -16,7 +17,7 @@ INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
     gen_random_uuid(), NOW(), NOW(), $1, $2
 )
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at
 `
 
 type CreateUserParams struct {
@@ -34,6 +35,8 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
 	)
 	return i, err
 }
@@ -48,7 +51,7 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 }
 
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red FROM users
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at FROM users
 WHERE email = $1
 `
 
@@ -62,15 +65,80 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
 	)
 	return i, err
 }
 
+const getUserById = `-- name: GetUserById :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at FROM users
+WHERE id = $1
+`
+
+func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
+
+const markVerificationSent = `-- name: MarkVerificationSent :execrows
+UPDATE users
+SET verification_sent_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL
+AND (verification_sent_at IS NULL OR verification_sent_at < $2::timestamp)
+`
+
+type MarkVerificationSentParams struct {
+	ID         uuid.UUID
+	SentBefore time.Time
+}
+
+// MarkVerificationSent returns 0 if the email is verified or the last verification email was sent after sent_before.
+func (q *Queries) MarkVerificationSent(ctx context.Context, arg MarkVerificationSentParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markVerificationSent, arg.ID, arg.SentBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserChirpyRed = `-- name: SetUserChirpyRed :execrows
+UPDATE users
+SET updated_at = NOW(), is_chirpy_red = $2
+WHERE id = $1
+`
+
+type SetUserChirpyRedParams struct {
+	ID          uuid.UUID
+	IsChirpyRed bool
+}
+
+func (q *Queries) SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserChirpyRed, arg.ID, arg.IsChirpyRed)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET updated_at = NOW(), email = $1, hashed_password = $2
+SET updated_at = NOW(), email = $1, hashed_password = $2,
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at END,
+    verification_sent_at = CASE WHEN email = $1 THEN verification_sent_at END
 WHERE id = $3
-RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at
 `
 
 type UpdateUserParams struct {
@@ -79,6 +147,7 @@ type UpdateUserParams struct {
 	ID             uuid.UUID
 }
 
+// A new email isn't verified.
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
 	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
 	var i User
@@ -89,17 +158,53 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.Email,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
 	)
 	return i, err
 }
 
-const updateUserChirpyRed = `-- name: UpdateUserChirpyRed :exec
+const updateUserPassword = `-- name: UpdateUserPassword :exec
 UPDATE users
-SET is_chirpy_red = TRUE
+SET updated_at = NOW(), hashed_password = $2
 WHERE id = $1
 `
 
-func (q *Queries) UpdateUserChirpyRed(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, updateUserChirpyRed, id)
+type UpdateUserPasswordParams struct {
+	ID             uuid.UUID
+	HashedPassword string
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.ID, arg.HashedPassword)
 	return err
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET updated_at = NOW(), email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1 AND email = $2
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// The email is checked, so a verification of an email the user changed since doesn't count.
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
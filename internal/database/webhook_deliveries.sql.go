@@ -0,0 +1,289 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_deliveries.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET updated_at = NOW(), next_attempt_at = $1
+WHERE id IN (
+    SELECT d.id FROM webhook_deliveries d
+    WHERE d.status = 'pending' AND d.next_attempt_at <= $2
+    ORDER BY d.next_attempt_at
+    LIMIT $3
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseUntil time.Time
+	Now        time.Time
+	Limit      int32
+}
+
+// ClaimWebhookDeliveries leases the due deliveries until lease_until, so no other instance sends them meanwhile.
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, claimWebhookDeliveries, arg.LeaseUntil, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EndpointID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'pending', 0, $4
+)
+RETURNING id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at
+`
+
+type CreateWebhookDeliveryParams struct {
+	EndpointID    uuid.UUID
+	Event         string
+	Payload       string
+	NextAttemptAt time.Time
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookDelivery,
+		arg.EndpointID,
+		arg.Event,
+		arg.Payload,
+		arg.NextAttemptAt,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+	)
+	return i, err
+}
+
+const createWebhookDeliveryAttempt = `-- name: CreateWebhookDeliveryAttempt :one
+INSERT INTO webhook_delivery_attempts (id, created_at, delivery_id, attempt, status_code, error, duration_ms)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4, $5
+)
+RETURNING id, created_at, delivery_id, attempt, status_code, error, duration_ms
+`
+
+type CreateWebhookDeliveryAttemptParams struct {
+	DeliveryID uuid.UUID
+	Attempt    int32
+	StatusCode sql.NullInt32
+	Error      sql.NullString
+	DurationMs int32
+}
+
+func (q *Queries) CreateWebhookDeliveryAttempt(ctx context.Context, arg CreateWebhookDeliveryAttemptParams) (WebhookDeliveryAttempt, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookDeliveryAttempt,
+		arg.DeliveryID,
+		arg.Attempt,
+		arg.StatusCode,
+		arg.Error,
+		arg.DurationMs,
+	)
+	var i WebhookDeliveryAttempt
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.DeliveryID,
+		&i.Attempt,
+		&i.StatusCode,
+		&i.Error,
+		&i.DurationMs,
+	)
+	return i, err
+}
+
+const getWebhookDelivery = `-- name: GetWebhookDelivery :one
+SELECT id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at FROM webhook_deliveries
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookDelivery, id)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+	)
+	return i, err
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at FROM webhook_deliveries
+WHERE endpoint_id = $1
+AND ($3::timestamp IS NULL
+    OR (created_at, id) < ($3::timestamp, $4::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $2
+`
+
+type ListWebhookDeliveriesParams struct {
+	EndpointID      uuid.UUID
+	Limit           int32
+	BeforeCreatedAt sql.NullTime
+	BeforeID        uuid.NullUUID
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries,
+		arg.EndpointID,
+		arg.Limit,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EndpointID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveryAttempts = `-- name: ListWebhookDeliveryAttempts :many
+SELECT id, created_at, delivery_id, attempt, status_code, error, duration_ms FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempt
+`
+
+func (q *Queries) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]WebhookDeliveryAttempt, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveryAttempts, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDeliveryAttempt
+	for rows.Next() {
+		var i WebhookDeliveryAttempt
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.DeliveryID,
+			&i.Attempt,
+			&i.StatusCode,
+			&i.Error,
+			&i.DurationMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateWebhookDeliveryAttempt = `-- name: UpdateWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET updated_at = NOW(), status = $2, attempts = attempts + 1, next_attempt_at = $3, last_attempt_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at
+`
+
+type UpdateWebhookDeliveryAttemptParams struct {
+	ID            uuid.UUID
+	Status        string
+	NextAttemptAt time.Time
+}
+
+func (q *Queries) UpdateWebhookDeliveryAttempt(ctx context.Context, arg UpdateWebhookDeliveryAttemptParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, updateWebhookDeliveryAttempt, arg.ID, arg.Status, arg.NextAttemptAt)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+	)
+	return i, err
+}
@@ -0,0 +1,151 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_endpoints.sql
+
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createWebhookEndpoint = `-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, events)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4
+)
+RETURNING id, created_at, updated_at, user_id, url, secret, events
+`
+
+type CreateWebhookEndpointParams struct {
+	UserID uuid.NullUUID
+	Url    string
+	Secret string
+	Events string
+}
+
+func (q *Queries) CreateWebhookEndpoint(ctx context.Context, arg CreateWebhookEndpointParams) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookEndpoint,
+		arg.UserID,
+		arg.Url,
+		arg.Secret,
+		arg.Events,
+	)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		&i.Events,
+	)
+	return i, err
+}
+
+const deleteWebhookEndpoint = `-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints
+WHERE id = $1
+`
+
+func (q *Queries) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteWebhookEndpoint, id)
+	return err
+}
+
+const getWebhookEndpoint = `-- name: GetWebhookEndpoint :one
+SELECT id, created_at, updated_at, user_id, url, secret, events FROM webhook_endpoints
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (WebhookEndpoint, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEndpoint, id)
+	var i WebhookEndpoint
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Url,
+		&i.Secret,
+		&i.Events,
+	)
+	return i, err
+}
+
+const listWebhookEndpoints = `-- name: ListWebhookEndpoints :many
+SELECT id, created_at, updated_at, user_id, url, secret, events FROM webhook_endpoints
+WHERE user_id IS NOT DISTINCT FROM $1::uuid
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListWebhookEndpoints(ctx context.Context, userID uuid.NullUUID) ([]WebhookEndpoint, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookEndpoints, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEndpoint
+	for rows.Next() {
+		var i WebhookEndpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			&i.Events,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookEndpointsForUser = `-- name: ListWebhookEndpointsForUser :many
+SELECT id, created_at, updated_at, user_id, url, secret, events FROM webhook_endpoints
+WHERE user_id IS NULL OR user_id = $1
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListWebhookEndpointsForUser(ctx context.Context, userID uuid.NullUUID) ([]WebhookEndpoint, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookEndpointsForUser, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEndpoint
+	for rows.Next() {
+		var i WebhookEndpoint
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Url,
+			&i.Secret,
+			&i.Events,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,177 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_events.sql
+
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const createWebhookEvent = `-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, created_at, updated_at, event_id, event, payload, status, attempts)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'pending', 0
+)
+ON CONFLICT (event_id) DO NOTHING
+RETURNING id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at
+`
+
+type CreateWebhookEventParams struct {
+	EventID string
+	Event   string
+	Payload string
+}
+
+func (q *Queries) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookEvent, arg.EventID, arg.Event, arg.Payload)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EventID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.LastError,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const getWebhookEvent = `-- name: GetWebhookEvent :one
+SELECT id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at FROM webhook_events
+WHERE id = $1
+`
+
+func (q *Queries) GetWebhookEvent(ctx context.Context, id uuid.UUID) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEvent, id)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EventID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.LastError,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const getWebhookEventByEventID = `-- name: GetWebhookEventByEventID :one
+SELECT id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at FROM webhook_events
+WHERE event_id = $1
+`
+
+func (q *Queries) GetWebhookEventByEventID(ctx context.Context, eventID string) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEventByEventID, eventID)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EventID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.LastError,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const listWebhookEvents = `-- name: ListWebhookEvents :many
+SELECT id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at FROM webhook_events
+WHERE status = $1
+AND ($3::timestamp IS NULL
+    OR (created_at, id) > ($3::timestamp, $4::uuid))
+ORDER BY created_at, id
+LIMIT $2
+`
+
+type ListWebhookEventsParams struct {
+	Status         string
+	Limit          int32
+	AfterCreatedAt sql.NullTime
+	AfterID        uuid.NullUUID
+}
+
+func (q *Queries) ListWebhookEvents(ctx context.Context, arg ListWebhookEventsParams) ([]WebhookEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookEvents,
+		arg.Status,
+		arg.Limit,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEvent
+	for rows.Next() {
+		var i WebhookEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EventID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.LastError,
+			&i.ProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markWebhookEventFailed = `-- name: MarkWebhookEventFailed :exec
+UPDATE webhook_events
+SET updated_at = NOW(), status = 'failed', attempts = attempts + 1, last_error = $2
+WHERE id = $1 AND status <> 'processed'
+`
+
+type MarkWebhookEventFailedParams struct {
+	ID        uuid.UUID
+	LastError sql.NullString
+}
+
+func (q *Queries) MarkWebhookEventFailed(ctx context.Context, arg MarkWebhookEventFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markWebhookEventFailed, arg.ID, arg.LastError)
+	return err
+}
+
+const markWebhookEventProcessed = `-- name: MarkWebhookEventProcessed :execrows
+UPDATE webhook_events
+SET updated_at = NOW(), status = 'processed', attempts = attempts + 1, last_error = NULL, processed_at = NOW()
+WHERE id = $1 AND status <> 'processed'
+`
+
+func (q *Queries) MarkWebhookEventProcessed(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markWebhookEventProcessed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
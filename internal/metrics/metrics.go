@@ -0,0 +1,215 @@
+// Package metrics keeps the Prometheus registry of the server: HTTP request metrics, the database pool and the
+// domain counters the handlers increment.
+package metrics
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// unmatchedRoute labels requests no route pattern matched, so unknown paths don't create new series.
+const unmatchedRoute = "unmatched"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	requests         *prometheus.CounterVec
+	requestDuration  *prometheus.HistogramVec
+	requestsInFlight prometheus.Gauge
+
+	FileserverHits    prometheus.Counter
+	ChirpsCreated     prometheus.Counter
+	Logins            *prometheus.CounterVec
+	WebhooksProcessed *prometheus.CounterVec
+	WebhookDeliveries *prometheus.CounterVec
+}
+
+// New registers every metric in a new registry. If db isn't nil, its pool stats are exported too.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_http_requests_total",
+			Help: "HTTP requests by route pattern and status code.",
+		}, []string{"route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "chirpy_http_request_duration_seconds",
+			Help:    "HTTP request latency by route pattern and status code.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "code"}),
+		requestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "chirpy_http_requests_in_flight",
+			Help: "HTTP requests being served.",
+		}),
+		FileserverHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chirpy_fileserver_hits_total",
+			Help: "Requests for the files under /app/.",
+		}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "chirpy_chirps_created_total",
+			Help: "Chirps created.",
+		}),
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_logins_total",
+			Help: "Login attempts by result, succeeded, failed or mfa_required when the password was right and a second factor is needed.",
+		}, []string{"result"}),
+		WebhooksProcessed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_webhooks_processed_total",
+			Help: "Polka webhooks processed by event, events Chirpy doesn't handle are counted as ignored.",
+		}, []string{"event"}),
+		WebhookDeliveries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "chirpy_webhook_deliveries_total",
+			Help: "Attempts to deliver outbound webhooks by result, succeeded, retried or dead.",
+		}, []string{"result"}),
+	}
+
+	m.Registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.requestsInFlight,
+		m.FileserverHits,
+		m.ChirpsCreated,
+		m.Logins,
+		m.WebhooksProcessed,
+		m.WebhookDeliveries,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(db, "chirpy"))
+	}
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Middleware measures every request to mux. The route label is the pattern the request matched, like
+// "GET /api/chirps/{chirpID}", so it doesn't grow with the ids in the path.
+func (m *Metrics) Middleware(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.requestsInFlight.Inc()
+		defer m.requestsInFlight.Dec()
+
+		start := time.Now()
+		recorder := RecordResponse(w)
+		mux.ServeHTTP(recorder, r)
+
+		// ServeMux sets r.Pattern on the request it routes.
+		route := r.Pattern
+		if route == "" {
+			route = unmatchedRoute
+		}
+		code := strconv.Itoa(recorder.Status())
+		m.requests.WithLabelValues(route, code).Inc()
+		m.requestDuration.WithLabelValues(route, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// ResponseRecorder remembers the status and size of a response for the middlewares which measure or log it.
+type ResponseRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+// RecordResponse wraps w, unless an outer middleware wrapped it already, so every request is wrapped once however
+// many middlewares look at the response.
+func RecordResponse(w http.ResponseWriter) *ResponseRecorder {
+	if recorder, ok := w.(*ResponseRecorder); ok {
+		return recorder
+	}
+	return &ResponseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+// Status is the status code of the response, 200 if the handler didn't set one.
+func (r *ResponseRecorder) Status() int {
+	return r.status
+}
+
+// Bytes is how many bytes of body were written.
+func (r *ResponseRecorder) Bytes() int {
+	return r.bytes
+}
+
+func (r *ResponseRecorder) WriteHeader(code int) {
+	if !r.wroteHeader {
+		r.status = code
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *ResponseRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Flush sends what was written so far, for handlers which stream and check for http.Flusher.
+func (r *ResponseRecorder) Flush() {
+	r.wroteHeader = true
+	http.NewResponseController(r.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying ResponseWriter.
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Sample is the value of one counter or gauge series, Labels are formatted like `{route="/app/",code="200"}`.
+type Sample struct {
+	Name   string
+	Labels string
+	Value  float64
+}
+
+// Samples gathers the counters and gauges of the registry whose name starts with prefix.
+func (m *Metrics) Samples(prefix string) ([]Sample, error) {
+	families, err := m.Registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	samples := []Sample{}
+	for _, family := range families {
+		if !strings.HasPrefix(family.GetName(), prefix) {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			var value float64
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				value = metric.GetCounter().GetValue()
+			case dto.MetricType_GAUGE:
+				value = metric.GetGauge().GetValue()
+			default:
+				continue
+			}
+
+			labels := []string{}
+			for _, label := range metric.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%v=%q", label.GetName(), label.GetValue()))
+			}
+			formatted := ""
+			if len(labels) > 0 {
+				formatted = "{" + strings.Join(labels, ",") + "}"
+			}
+			samples = append(samples, Sample{Name: family.GetName(), Labels: formatted, Value: value})
+		}
+	}
+	return samples, nil
+}
@@ -0,0 +1,111 @@
+// Package migrate applies the goose migrations embedded in the binary to the Postgres or SQLite database.
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+
+	"github.com/PavelVaavra/http-server/internal/store"
+	chirpysql "github.com/PavelVaavra/http-server/sql"
+	"github.com/pressly/goose/v3"
+	"github.com/pressly/goose/v3/lock"
+)
+
+// ErrSchemaDrift means the database schema isn't the one the binary was built for.
+var ErrSchemaDrift = errors.New("schema drift")
+
+type Migrator struct {
+	provider *goose.Provider
+}
+
+// New prepares the migrations for db. On Postgres, Up and Down hold an advisory lock, so replicas starting at the same
+// time apply every migration exactly once. SQLite locks the whole file for a write anyway.
+func New(db *sql.DB, dialect store.Dialect) (*Migrator, error) {
+	var (
+		fsys          fs.FS
+		gooseDialect  goose.Dialect
+		providerOpts  []goose.ProviderOption
+		migrationsDir string
+	)
+	switch dialect {
+	case store.DialectPostgres:
+		fsys, gooseDialect, migrationsDir = chirpysql.PostgresMigrations, goose.DialectPostgres, "schema"
+		locker, err := lock.NewPostgresSessionLocker()
+		if err != nil {
+			return nil, err
+		}
+		providerOpts = append(providerOpts, goose.WithSessionLocker(locker))
+	case store.DialectSQLite:
+		fsys, gooseDialect, migrationsDir = chirpysql.SQLiteMigrations, goose.DialectSQLite3, path.Join("sqlite", "schema")
+	default:
+		return nil, fmt.Errorf("no migrations for dialect %q", dialect)
+	}
+
+	fsys, err := fs.Sub(fsys, migrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := goose.NewProvider(gooseDialect, db, fsys, providerOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{provider: provider}, nil
+}
+
+// Up applies every pending migration and writes what it did to w.
+func (m *Migrator) Up(ctx context.Context, w io.Writer) error {
+	results, err := m.provider.Up(ctx)
+	for _, result := range results {
+		fmt.Fprintln(w, result)
+	}
+	return err
+}
+
+// Down rolls back the latest migration and writes what it did to w.
+func (m *Migrator) Down(ctx context.Context, w io.Writer) error {
+	result, err := m.provider.Down(ctx)
+	if result != nil {
+		fmt.Fprintln(w, result)
+	}
+	return err
+}
+
+// Status writes every migration with the time it was applied, or pending, to w.
+func (m *Migrator) Status(ctx context.Context, w io.Writer) error {
+	statuses, err := m.provider.Status(ctx)
+	if err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.State == goose.StateApplied {
+			appliedAt = status.AppliedAt.UTC().Format("2006-01-02 15:04:05")
+		}
+		fmt.Fprintf(w, "%-20s %v\n", appliedAt, path.Base(status.Source.Path))
+	}
+	return nil
+}
+
+// Check returns ErrSchemaDrift if a migration is pending or the database has a migration the binary doesn't know about.
+func (m *Migrator) Check(ctx context.Context) error {
+	current, target, err := m.provider.GetVersions(ctx)
+	if err != nil {
+		return err
+	}
+	if current > target {
+		return fmt.Errorf("%w: database is at version %v, the newest known migration is %v", ErrSchemaDrift, current, target)
+	}
+	pending, err := m.provider.HasPending(ctx)
+	if err != nil {
+		return err
+	}
+	if pending {
+		return fmt.Errorf("%w: database is at version %v, migrations up to %v are pending", ErrSchemaDrift, current, target)
+	}
+	return nil
+}
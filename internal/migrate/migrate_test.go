@@ -0,0 +1,55 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/PavelVaavra/http-server/internal/store"
+)
+
+func TestMigrateSQLite(t *testing.T) {
+	ctx := context.Background()
+	db, dialect, err := store.OpenDB("sqlite://" + filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := New(db, dialect)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = m.Check(ctx)
+	if !errors.Is(err, ErrSchemaDrift) {
+		t.Errorf("empty database: %v != %v", err, ErrSchemaDrift)
+	}
+
+	out := bytes.Buffer{}
+	err = m.Up(ctx, &out)
+	if err != nil {
+		t.Fatalf("Up returns an error %v", err.Error())
+	}
+	err = m.Check(ctx)
+	if err != nil {
+		t.Errorf("migrated database: %v", err)
+	}
+
+	out.Reset()
+	err = m.Status(ctx, &out)
+	if err != nil || strings.Contains(out.String(), "pending") {
+		t.Errorf("Status returns %q, %v", out.String(), err)
+	}
+
+	err = m.Down(ctx, &out)
+	if err != nil {
+		t.Fatalf("Down returns an error %v", err.Error())
+	}
+	err = m.Check(ctx)
+	if !errors.Is(err, ErrSchemaDrift) {
+		t.Errorf("rolled back database: %v != %v", err, ErrSchemaDrift)
+	}
+}
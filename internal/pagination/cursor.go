@@ -0,0 +1,40 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Cursor points at the last row of a page. Rows are ordered by (created_at, id), so the id breaks ties
+// between rows which share the same created_at and the ordering stays stable.
+type Cursor struct {
+	CreatedAt time.Time `json:"t"`
+	ID        uuid.UUID `json:"id"`
+}
+
+// Encode returns the cursor as an opaque URL safe string that can be handed out to clients.
+func (c Cursor) Encode() string {
+	dat, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(dat)
+}
+
+// DecodeCursor parses a string created by Cursor.Encode.
+func DecodeCursor(s string) (Cursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("cursor not base64url encoded: %w", err)
+	}
+	c := Cursor{}
+	err = json.Unmarshal(dat, &c)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("cursor malformed: %w", err)
+	}
+	if c.CreatedAt.IsZero() || c.ID == uuid.Nil {
+		return Cursor{}, fmt.Errorf("cursor incomplete")
+	}
+	return c, nil
+}
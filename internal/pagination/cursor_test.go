@@ -0,0 +1,48 @@
+package pagination
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	cases := []Cursor{
+		{
+			CreatedAt: time.Date(2025, 1, 2, 3, 4, 5, 123456000, time.UTC),
+			ID:        uuid.New(),
+		},
+		{
+			CreatedAt: time.Date(1999, 12, 31, 23, 59, 59, 0, time.UTC),
+			ID:        uuid.New(),
+		},
+	}
+
+	for _, c := range cases {
+		decoded, err := DecodeCursor(c.Encode())
+		if err != nil {
+			t.Errorf("DecodeCursor(%v) returns an error %v", c.Encode(), err.Error())
+		}
+		if !decoded.CreatedAt.Equal(c.CreatedAt) || decoded.ID != c.ID {
+			t.Errorf("%v != %v", decoded, c)
+		}
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	cases := []string{
+		"",
+		"not base64!",
+		"bm90IGpzb24",
+		Cursor{ID: uuid.New()}.Encode(),
+		Cursor{CreatedAt: time.Now()}.Encode(),
+	}
+
+	for _, c := range cases {
+		_, err := DecodeCursor(c)
+		if err == nil {
+			t.Errorf("DecodeCursor(%v) doesn't return an error", c)
+		}
+	}
+}
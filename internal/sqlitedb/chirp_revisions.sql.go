@@ -0,0 +1,82 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: chirp_revisions.sql
+
+package sqlitedb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createChirpRevision = `-- name: CreateChirpRevision :one
+INSERT INTO chirp_revisions (id, created_at, chirp_id, body)
+SELECT ?1, strftime('%Y-%m-%d %H:%M:%f', 'now'), chirps.id, chirps.body FROM chirps
+WHERE chirps.id = ?2 AND chirps.deleted_at IS NULL
+RETURNING id, created_at, chirp_id, body
+`
+
+type CreateChirpRevisionParams struct {
+	ID      uuid.UUID
+	ChirpID uuid.UUID
+}
+
+// CreateChirpRevision saves the current body of the chirp, unless it was deleted. SQLite runs one write at a time, so no edit can come
+// between reading the body and the insert.
+func (q *Queries) CreateChirpRevision(ctx context.Context, arg CreateChirpRevisionParams) (ChirpRevision, error) {
+	row := q.db.QueryRowContext(ctx, createChirpRevision, arg.ID, arg.ChirpID)
+	var i ChirpRevision
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.ChirpID,
+		&i.Body,
+	)
+	return i, err
+}
+
+const deleteChirpRevisions = `-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = ?
+`
+
+func (q *Queries) DeleteChirpRevisions(ctx context.Context, chirpID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteChirpRevisions, chirpID)
+	return err
+}
+
+const listChirpRevisions = `-- name: ListChirpRevisions :many
+SELECT id, created_at, chirp_id, body FROM chirp_revisions
+WHERE chirp_id = ?
+ORDER BY created_at, id
+`
+
+func (q *Queries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]ChirpRevision, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpRevisions, chirpID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChirpRevision
+	for rows.Next() {
+		var i ChirpRevision
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.ChirpID,
+			&i.Body,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
@@ -0,0 +1,343 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: chirps.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const createChirp = `-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?
+)
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
+`
+
+type CreateChirpParams struct {
+	ID        uuid.UUID
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+}
+
+func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.ID,
+		arg.Body,
+		arg.UserID,
+		arg.InReplyTo,
+	)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const deleteChirp = `-- name: DeleteChirp :execrows
+DELETE FROM chirps
+WHERE chirps.id = ? AND NOT EXISTS (
+    SELECT 1 FROM chirps AS replies
+    WHERE replies.in_reply_to = chirps.id
+)
+`
+
+// DeleteChirp returns 0 if the chirp has replies, such a chirp is tombstoned instead.
+func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirp, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChirp = `-- name: GetChirp :one
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE id = ? AND deleted_at IS NULL
+`
+
+func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+	)
+	return i, err
+}
+
+const listChirpAncestors = `-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.in_reply_to, 1 AS depth
+    FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = ?1
+    UNION ALL
+    SELECT c.id, c.in_reply_to, ancestors.depth + 1
+    FROM chirps c
+    JOIN ancestors ON ancestors.in_reply_to = c.id
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at FROM ancestors
+JOIN chirps ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC
+`
+
+func (q *Queries) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpAncestors, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpDescendants = `-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, 0 AS depth
+    FROM chirps
+    WHERE chirps.id = ?2
+    UNION ALL
+    SELECT c.id, descendants.depth + 1
+    FROM chirps c
+    JOIN descendants ON c.in_reply_to = descendants.id
+    WHERE descendants.depth < CAST(?3 AS INTEGER)
+)
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at, CAST(descendants.depth AS INTEGER) AS depth FROM descendants
+JOIN chirps ON chirps.id = descendants.id
+ORDER BY descendants.depth, chirps.created_at, chirps.id
+LIMIT ?1
+`
+
+type ListChirpDescendantsParams struct {
+	MaxRows  int64
+	ID       uuid.UUID
+	MaxDepth int64
+}
+
+type ListChirpDescendantsRow struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+	Depth     int64
+}
+
+func (q *Queries) ListChirpDescendants(ctx context.Context, arg ListChirpDescendantsParams) ([]ListChirpDescendantsRow, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpDescendants, arg.MaxRows, arg.ID, arg.MaxDepth)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChirpDescendantsRow
+	for rows.Next() {
+		var i ListChirpDescendantsRow
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+			&i.Depth,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsAsc = `-- name: ListChirpsAsc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE deleted_at IS NULL
+AND (CAST(?1 AS TEXT) IS NULL OR user_id = CAST(?1 AS TEXT))
+AND (CAST(?2 AS TEXT) IS NULL
+    OR (created_at, id) > (CAST(?2 AS TEXT), CAST(?3 AS TEXT)))
+ORDER BY created_at, id
+LIMIT ?4
+`
+
+type ListChirpsAscParams struct {
+	UserID         sql.NullString
+	AfterCreatedAt sql.NullString
+	AfterID        sql.NullString
+	Limit          int64
+}
+
+func (q *Queries) ListChirpsAsc(ctx context.Context, arg ListChirpsAscParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsAsc,
+		arg.UserID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsDesc = `-- name: ListChirpsDesc :many
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM chirps
+WHERE deleted_at IS NULL
+AND (CAST(?1 AS TEXT) IS NULL OR user_id = CAST(?1 AS TEXT))
+AND (CAST(?2 AS TEXT) IS NULL
+    OR (created_at, id) < (CAST(?2 AS TEXT), CAST(?3 AS TEXT)))
+ORDER BY created_at DESC, id DESC
+LIMIT ?4
+`
+
+type ListChirpsDescParams struct {
+	UserID          sql.NullString
+	BeforeCreatedAt sql.NullString
+	BeforeID        sql.NullString
+	Limit           int64
+}
+
+func (q *Queries) ListChirpsDesc(ctx context.Context, arg ListChirpsDescParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsDesc,
+		arg.UserID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const tombstoneChirp = `-- name: TombstoneChirp :exec
+UPDATE chirps
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), deleted_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), body = ''
+WHERE id = ?
+`
+
+func (q *Queries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, tombstoneChirp, id)
+	return err
+}
+
+const updateChirp = `-- name: UpdateChirp :one
+UPDATE chirps
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), body = ?
+WHERE id = ? AND deleted_at IS NULL
+RETURNING id, created_at, updated_at, body, user_id, in_reply_to, deleted_at
+`
+
+type UpdateChirpParams struct {
+	Body string
+	ID   uuid.UUID
+}
+
+func (q *Queries) UpdateChirp(ctx context.Context, arg UpdateChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, updateChirp, arg.Body, arg.ID)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Body,
+		&i.UserID,
+		&i.InReplyTo,
+		&i.DeletedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,199 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: follows.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const followUser = `-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    ?, ?, strftime('%Y-%m-%d %H:%M:%f', 'now')
+)
+ON CONFLICT DO NOTHING
+`
+
+type FollowUserParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+}
+
+func (q *Queries) FollowUser(ctx context.Context, arg FollowUserParams) error {
+	_, err := q.db.ExecContext(ctx, followUser, arg.FollowerID, arg.FolloweeID)
+	return err
+}
+
+const listFollowers = `-- name: ListFollowers :many
+SELECT follower_id AS user_id, created_at FROM follows
+WHERE followee_id = ?1
+AND (CAST(?2 AS TEXT) IS NULL
+    OR (created_at, follower_id) > (CAST(?2 AS TEXT), CAST(?3 AS TEXT)))
+ORDER BY created_at, follower_id
+LIMIT ?4
+`
+
+type ListFollowersParams struct {
+	FolloweeID     uuid.UUID
+	AfterCreatedAt sql.NullString
+	AfterID        sql.NullString
+	Limit          int64
+}
+
+type ListFollowersRow struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) ListFollowers(ctx context.Context, arg ListFollowersParams) ([]ListFollowersRow, error) {
+	rows, err := q.db.QueryContext(ctx, listFollowers,
+		arg.FolloweeID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFollowersRow
+	for rows.Next() {
+		var i ListFollowersRow
+		if err := rows.Scan(&i.UserID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFollowing = `-- name: ListFollowing :many
+SELECT followee_id AS user_id, created_at FROM follows
+WHERE follower_id = ?1
+AND (CAST(?2 AS TEXT) IS NULL
+    OR (created_at, followee_id) > (CAST(?2 AS TEXT), CAST(?3 AS TEXT)))
+ORDER BY created_at, followee_id
+LIMIT ?4
+`
+
+type ListFollowingParams struct {
+	FollowerID     uuid.UUID
+	AfterCreatedAt sql.NullString
+	AfterID        sql.NullString
+	Limit          int64
+}
+
+type ListFollowingRow struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) ListFollowing(ctx context.Context, arg ListFollowingParams) ([]ListFollowingRow, error) {
+	rows, err := q.db.QueryContext(ctx, listFollowing,
+		arg.FollowerID,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListFollowingRow
+	for rows.Next() {
+		var i ListFollowingRow
+		if err := rows.Scan(&i.UserID, &i.CreatedAt); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTimeline = `-- name: ListTimeline :many
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.in_reply_to, chirps.deleted_at FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = ?1
+AND chirps.deleted_at IS NULL
+AND (CAST(?2 AS TEXT) IS NULL
+    OR (chirps.created_at, chirps.id) < (CAST(?2 AS TEXT), CAST(?3 AS TEXT)))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT ?4
+`
+
+type ListTimelineParams struct {
+	FollowerID      uuid.UUID
+	BeforeCreatedAt sql.NullString
+	BeforeID        sql.NullString
+	Limit           int64
+}
+
+func (q *Queries) ListTimeline(ctx context.Context, arg ListTimelineParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listTimeline,
+		arg.FollowerID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.InReplyTo,
+			&i.DeletedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const unfollowUser = `-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = ? AND followee_id = ?
+`
+
+type UnfollowUserParams struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+}
+
+func (q *Queries) UnfollowUser(ctx context.Context, arg UnfollowUserParams) error {
+	_, err := q.db.ExecContext(ctx, unfollowUser, arg.FollowerID, arg.FolloweeID)
+	return err
+}
@@ -0,0 +1,139 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+
+package sqlitedb
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Chirp struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Body      string
+	UserID    uuid.UUID
+	InReplyTo uuid.NullUUID
+	DeletedAt sql.NullTime
+}
+
+type ChirpRevision struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	ChirpID   uuid.UUID
+	Body      string
+}
+
+type Follow struct {
+	FollowerID uuid.UUID
+	FolloweeID uuid.UUID
+	CreatedAt  time.Time
+}
+
+type PasswordReset struct {
+	TokenHash string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type RecoveryCode struct {
+	CodeHash  string
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	UsedAt    sql.NullTime
+}
+
+type RefreshToken struct {
+	TokenHash string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.UUID
+	ExpiresAt time.Time
+	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+}
+
+type Subscription struct {
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	UserID             uuid.UUID
+	Status             string
+	CurrentPeriodStart time.Time
+	CurrentPeriodEnd   time.Time
+	EndedAt            sql.NullTime
+}
+
+type TotpSecret struct {
+	UserID         uuid.UUID
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	Secret         string
+	EnabledAt      sql.NullTime
+	LastUsedStep   sql.NullInt64
+	FailedAttempts int64
+	LockedUntil    sql.NullTime
+}
+
+type User struct {
+	ID                 uuid.UUID
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+	Email              string
+	HashedPassword     string
+	IsChirpyRed        bool
+	EmailVerifiedAt    sql.NullTime
+	VerificationSentAt sql.NullTime
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+	EndpointID    uuid.UUID
+	Event         string
+	Payload       string
+	Status        string
+	Attempts      int64
+	NextAttemptAt time.Time
+	LastAttemptAt sql.NullTime
+}
+
+type WebhookDeliveryAttempt struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	DeliveryID uuid.UUID
+	Attempt    int64
+	StatusCode sql.NullInt64
+	Error      sql.NullString
+	DurationMs int64
+}
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uuid.NullUUID
+	Url       string
+	Secret    string
+	Events    string
+}
+
+type WebhookEvent struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	EventID     string
+	Event       string
+	Payload     string
+	Status      string
+	Attempts    int64
+	LastError   sql.NullString
+	ProcessedAt sql.NullTime
+}
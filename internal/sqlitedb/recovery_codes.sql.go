@@ -0,0 +1,64 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: recovery_codes.sql
+
+package sqlitedb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createRecoveryCode = `-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, created_at, user_id)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), ?
+)
+`
+
+type CreateRecoveryCodeParams struct {
+	CodeHash string
+	UserID   uuid.UUID
+}
+
+func (q *Queries) CreateRecoveryCode(ctx context.Context, arg CreateRecoveryCodeParams) error {
+	_, err := q.db.ExecContext(ctx, createRecoveryCode, arg.CodeHash, arg.UserID)
+	return err
+}
+
+const deleteRecoveryCodes = `-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = ?
+`
+
+func (q *Queries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteRecoveryCodes, userID)
+	return err
+}
+
+const useRecoveryCode = `-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE recovery_codes.user_id = ?1 AND code_hash = ?2 AND used_at IS NULL
+AND recovery_codes.user_id NOT IN (
+    SELECT totp_secrets.user_id FROM totp_secrets
+    WHERE totp_secrets.locked_until > CAST(?3 AS TEXT)
+)
+`
+
+type UseRecoveryCodeParams struct {
+	UserID   uuid.UUID
+	CodeHash string
+	Now      string
+}
+
+// UseRecoveryCode returns 0 if the code is unknown or used, or the second factor is locked.
+func (q *Queries) UseRecoveryCode(ctx context.Context, arg UseRecoveryCodeParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useRecoveryCode, arg.UserID, arg.CodeHash, arg.Now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,108 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: refresh_tokens.sql
+
+package sqlitedb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const getRefreshToken = `-- name: GetRefreshToken :one
+SELECT token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id FROM refresh_tokens
+WHERE token_hash = ?
+`
+
+func (q *Queries) GetRefreshToken(ctx context.Context, tokenHash string) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, getRefreshToken, tokenHash)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+	)
+	return i, err
+}
+
+const refreshToken = `-- name: RefreshToken :one
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, strftime('%Y-%m-%d %H:%M:%f', 'now', '+60 days'), NULL, ?
+)
+RETURNING token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id
+`
+
+type RefreshTokenParams struct {
+	TokenHash string
+	UserID    uuid.UUID
+	FamilyID  uuid.UUID
+}
+
+func (q *Queries) RefreshToken(ctx context.Context, arg RefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRowContext(ctx, refreshToken, arg.TokenHash, arg.UserID, arg.FamilyID)
+	var i RefreshToken
+	err := row.Scan(
+		&i.TokenHash,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.ExpiresAt,
+		&i.RevokedAt,
+		&i.FamilyID,
+	)
+	return i, err
+}
+
+const revokeActiveRefreshToken = `-- name: RevokeActiveRefreshToken :execrows
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE token_hash = ? AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeActiveRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, revokeActiveRefreshToken, tokenHash)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE token_hash = ?
+`
+
+func (q *Queries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshToken, tokenHash)
+	return err
+}
+
+const revokeRefreshTokenFamily = `-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE family_id = ? AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeRefreshTokenFamily, familyID)
+	return err
+}
+
+const revokeUserRefreshTokens = `-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE user_id = ? AND revoked_at IS NULL
+`
+
+func (q *Queries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, revokeUserRefreshTokens, userID)
+	return err
+}
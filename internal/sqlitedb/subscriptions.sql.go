@@ -0,0 +1,208 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: subscriptions.sql
+
+package sqlitedb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const cancelSubscription = `-- name: CancelSubscription :one
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'canceled', ended_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = ?
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+func (q *Queries) CancelSubscription(ctx context.Context, id uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, cancelSubscription, id)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const createSubscription = `-- name: CreateSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, current_period_start, current_period_end)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, 'active',
+    CAST(?3 AS TEXT), CAST(?4 AS TEXT)
+)
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+type CreateSubscriptionParams struct {
+	ID                 uuid.UUID
+	UserID             uuid.UUID
+	CurrentPeriodStart string
+	CurrentPeriodEnd   string
+}
+
+func (q *Queries) CreateSubscription(ctx context.Context, arg CreateSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, createSubscription,
+		arg.ID,
+		arg.UserID,
+		arg.CurrentPeriodStart,
+		arg.CurrentPeriodEnd,
+	)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const expireSubscriptions = `-- name: ExpireSubscriptions :many
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'expired', ended_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE status IN ('active', 'past_due') AND current_period_end < CAST(?1 AS TEXT)
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+func (q *Queries) ExpireSubscriptions(ctx context.Context, endedBefore string) ([]Subscription, error) {
+	rows, err := q.db.QueryContext(ctx, expireSubscriptions, endedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Subscription
+	for rows.Next() {
+		var i Subscription
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.UserID,
+			&i.Status,
+			&i.CurrentPeriodStart,
+			&i.CurrentPeriodEnd,
+			&i.EndedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getLatestSubscription = `-- name: GetLatestSubscription :one
+SELECT id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at FROM subscriptions
+WHERE user_id = ?
+ORDER BY created_at DESC, id DESC
+LIMIT 1
+`
+
+func (q *Queries) GetLatestSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getLatestSubscription, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const getOpenSubscription = `-- name: GetOpenSubscription :one
+SELECT id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at FROM subscriptions
+WHERE user_id = ? AND status IN ('active', 'past_due')
+`
+
+func (q *Queries) GetOpenSubscription(ctx context.Context, userID uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, getOpenSubscription, userID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const markSubscriptionPastDue = `-- name: MarkSubscriptionPastDue :one
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'past_due'
+WHERE id = ?
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+func (q *Queries) MarkSubscriptionPastDue(ctx context.Context, id uuid.UUID) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, markSubscriptionPastDue, id)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
+
+const renewSubscription = `-- name: RenewSubscription :one
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'active',
+    current_period_start = CAST(?1 AS TEXT), current_period_end = CAST(?2 AS TEXT)
+WHERE id = ?3
+RETURNING id, created_at, updated_at, user_id, status, current_period_start, current_period_end, ended_at
+`
+
+type RenewSubscriptionParams struct {
+	CurrentPeriodStart string
+	CurrentPeriodEnd   string
+	ID                 uuid.UUID
+}
+
+func (q *Queries) RenewSubscription(ctx context.Context, arg RenewSubscriptionParams) (Subscription, error) {
+	row := q.db.QueryRowContext(ctx, renewSubscription, arg.CurrentPeriodStart, arg.CurrentPeriodEnd, arg.ID)
+	var i Subscription
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.UserID,
+		&i.Status,
+		&i.CurrentPeriodStart,
+		&i.CurrentPeriodEnd,
+		&i.EndedAt,
+	)
+	return i, err
+}
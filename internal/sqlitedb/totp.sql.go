@@ -0,0 +1,195 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: totp.sql
+
+package sqlitedb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const clearTOTPFailures = `-- name: ClearTOTPFailures :exec
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), failed_attempts = 0
+WHERE user_id = ?
+`
+
+func (q *Queries) ClearTOTPFailures(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, clearTOTPFailures, userID)
+	return err
+}
+
+const deleteTOTPSecret = `-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets
+WHERE user_id = ?
+`
+
+func (q *Queries) DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteTOTPSecret, userID)
+	return err
+}
+
+const enableTOTP = `-- name: EnableTOTP :execrows
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), enabled_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    last_used_step = CAST(?1 AS INTEGER)
+WHERE user_id = ?2 AND enabled_at IS NULL
+`
+
+type EnableTOTPParams struct {
+	Step   int64
+	UserID uuid.UUID
+}
+
+func (q *Queries) EnableTOTP(ctx context.Context, arg EnableTOTPParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, enableTOTP, arg.Step, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getTOTPSecret = `-- name: GetTOTPSecret :one
+SELECT user_id, created_at, updated_at, secret, enabled_at, last_used_step, failed_attempts, locked_until FROM totp_secrets
+WHERE user_id = ?
+`
+
+func (q *Queries) GetTOTPSecret(ctx context.Context, userID uuid.UUID) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, getTOTPSecret, userID)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const recordTOTPFailure = `-- name: RecordTOTPFailure :one
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    failed_attempts = CASE WHEN failed_attempts >= CAST(?1 AS INTEGER) THEN 0 ELSE failed_attempts END,
+    locked_until = CASE WHEN failed_attempts >= CAST(?1 AS INTEGER) THEN CAST(?2 AS TEXT) ELSE locked_until END
+WHERE user_id = ?3
+RETURNING user_id, created_at, updated_at, secret, enabled_at, last_used_step, failed_attempts, locked_until
+`
+
+type RecordTOTPFailureParams struct {
+	MaxAttempts int64
+	LockUntil   string
+	UserID      uuid.UUID
+}
+
+// RecordTOTPFailure locks the second factor until lock_until once max_attempts failed attempts are counted, and
+// starts counting again.
+func (q *Queries) RecordTOTPFailure(ctx context.Context, arg RecordTOTPFailureParams) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, recordTOTPFailure, arg.MaxAttempts, arg.LockUntil, arg.UserID)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const startTOTPAttempt = `-- name: StartTOTPAttempt :execrows
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    failed_attempts = CASE WHEN failed_attempts >= CAST(?1 AS INTEGER) THEN 1 ELSE failed_attempts + 1 END
+WHERE user_id = ?2 AND enabled_at IS NOT NULL
+AND (locked_until IS NULL OR locked_until <= CAST(?3 AS TEXT))
+AND (failed_attempts < CAST(?1 AS INTEGER) OR updated_at < CAST(?4 AS TEXT))
+`
+
+type StartTOTPAttemptParams struct {
+	MaxAttempts int64
+	UserID      uuid.UUID
+	Now         string
+	StaleBefore string
+}
+
+// StartTOTPAttempt counts an attempt before its code is checked, so concurrent requests can't check more than
+// max_attempts codes before the lock. It returns 0 if the second factor is locked or max_attempts attempts are counted
+// already. Attempts counted before stale_before, which were never recorded as failed, don't count anymore.
+func (q *Queries) StartTOTPAttempt(ctx context.Context, arg StartTOTPAttemptParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, startTOTPAttempt,
+		arg.MaxAttempts,
+		arg.UserID,
+		arg.Now,
+		arg.StaleBefore,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const upsertTOTPSecret = `-- name: UpsertTOTPSecret :one
+INSERT INTO totp_secrets (user_id, created_at, updated_at, secret)
+VALUES (
+    ?1, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET created_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), secret = excluded.secret,
+    last_used_step = NULL, failed_attempts = 0, locked_until = NULL
+WHERE totp_secrets.enabled_at IS NULL
+RETURNING user_id, created_at, updated_at, secret, enabled_at, last_used_step, failed_attempts, locked_until
+`
+
+type UpsertTOTPSecretParams struct {
+	UserID uuid.UUID
+	Secret string
+}
+
+// A new enrollment replaces one which wasn't confirmed, it returns no row if TOTP is enabled already.
+func (q *Queries) UpsertTOTPSecret(ctx context.Context, arg UpsertTOTPSecretParams) (TotpSecret, error) {
+	row := q.db.QueryRowContext(ctx, upsertTOTPSecret, arg.UserID, arg.Secret)
+	var i TotpSecret
+	err := row.Scan(
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Secret,
+		&i.EnabledAt,
+		&i.LastUsedStep,
+		&i.FailedAttempts,
+		&i.LockedUntil,
+	)
+	return i, err
+}
+
+const useTOTPStep = `-- name: UseTOTPStep :execrows
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), last_used_step = CAST(?1 AS INTEGER), failed_attempts = 0
+WHERE user_id = ?2 AND (last_used_step IS NULL OR last_used_step < CAST(?1 AS INTEGER))
+AND (locked_until IS NULL OR locked_until <= CAST(?3 AS TEXT))
+`
+
+type UseTOTPStepParams struct {
+	Step   int64
+	UserID uuid.UUID
+	Now    string
+}
+
+// UseTOTPStep returns 0 if a code of the step or a later one was used already, or the second factor is locked.
+func (q *Queries) UseTOTPStep(ctx context.Context, arg UseTOTPStepParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, useTOTPStep, arg.Step, arg.UserID, arg.Now)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
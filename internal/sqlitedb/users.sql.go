@@ -0,0 +1,211 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: users.sql
+
+package sqlitedb
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+const createUser = `-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?
+)
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at
+`
+
+type CreateUserParams struct {
+	ID             uuid.UUID
+	Email          string
+	HashedPassword string
+}
+
+func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, createUser, arg.ID, arg.Email, arg.HashedPassword)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
+
+const deleteAllUsers = `-- name: DeleteAllUsers :exec
+DELETE FROM users
+`
+
+func (q *Queries) DeleteAllUsers(ctx context.Context) error {
+	_, err := q.db.ExecContext(ctx, deleteAllUsers)
+	return err
+}
+
+const getUserByEmail = `-- name: GetUserByEmail :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at FROM users
+WHERE email = ?
+`
+
+func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmail, email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
+
+const getUserById = `-- name: GetUserById :one
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at FROM users
+WHERE id = ?
+`
+
+func (q *Queries) GetUserById(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserById, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
+
+const markVerificationSent = `-- name: MarkVerificationSent :execrows
+UPDATE users
+SET verification_sent_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = ?1 AND email_verified_at IS NULL
+AND (verification_sent_at IS NULL OR verification_sent_at < CAST(?2 AS TEXT))
+`
+
+type MarkVerificationSentParams struct {
+	ID         uuid.UUID
+	SentBefore string
+}
+
+// MarkVerificationSent returns 0 if the email is verified or the last verification email was sent after sent_before.
+func (q *Queries) MarkVerificationSent(ctx context.Context, arg MarkVerificationSentParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markVerificationSent, arg.ID, arg.SentBefore)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const setUserChirpyRed = `-- name: SetUserChirpyRed :execrows
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), is_chirpy_red = ?1
+WHERE id = ?2
+`
+
+type SetUserChirpyRedParams struct {
+	IsChirpyRed bool
+	ID          uuid.UUID
+}
+
+func (q *Queries) SetUserChirpyRed(ctx context.Context, arg SetUserChirpyRedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, setUserChirpyRed, arg.IsChirpyRed, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateUser = `-- name: UpdateUser :one
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), email = ?1, hashed_password = ?2,
+    email_verified_at = CASE WHEN email = ?1 THEN email_verified_at END,
+    verification_sent_at = CASE WHEN email = ?1 THEN verification_sent_at END
+WHERE id = ?3
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at
+`
+
+type UpdateUserParams struct {
+	Email          string
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+// A new email isn't verified.
+func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
+
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), hashed_password = ?1
+WHERE id = ?2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
+const verifyUserEmail = `-- name: VerifyUserEmail :one
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    email_verified_at = COALESCE(email_verified_at, strftime('%Y-%m-%d %H:%M:%f', 'now'))
+WHERE id = ? AND email = ?
+RETURNING id, created_at, updated_at, email, hashed_password, is_chirpy_red, email_verified_at, verification_sent_at
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+// The email is checked, so a verification of an email the user changed since doesn't count.
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.EmailVerifiedAt,
+		&i.VerificationSentAt,
+	)
+	return i, err
+}
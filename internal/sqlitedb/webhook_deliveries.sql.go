@@ -0,0 +1,294 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_deliveries.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), next_attempt_at = CAST(?1 AS TEXT)
+WHERE id IN (
+    SELECT d.id FROM webhook_deliveries d
+    WHERE d.status = 'pending' AND d.next_attempt_at <= CAST(?2 AS TEXT)
+    ORDER BY d.next_attempt_at
+    LIMIT ?3
+)
+RETURNING id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseUntil string
+	Now        string
+	Limit      int64
+}
+
+// ClaimWebhookDeliveries leases the due deliveries until lease_until, so no other instance sends them meanwhile.
+// SQLite has a single writer, it needs no row locks.
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, claimWebhookDeliveries, arg.LeaseUntil, arg.Now, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EndpointID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?, 'pending', 0,
+    CAST(?5 AS TEXT)
+)
+RETURNING id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at
+`
+
+type CreateWebhookDeliveryParams struct {
+	ID            uuid.UUID
+	EndpointID    uuid.UUID
+	Event         string
+	Payload       string
+	NextAttemptAt string
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookDelivery,
+		arg.ID,
+		arg.EndpointID,
+		arg.Event,
+		arg.Payload,
+		arg.NextAttemptAt,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+	)
+	return i, err
+}
+
+const createWebhookDeliveryAttempt = `-- name: CreateWebhookDeliveryAttempt :one
+INSERT INTO webhook_delivery_attempts (id, created_at, delivery_id, attempt, status_code, error, duration_ms)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?, ?, ?
+)
+RETURNING id, created_at, delivery_id, attempt, status_code, error, duration_ms
+`
+
+type CreateWebhookDeliveryAttemptParams struct {
+	ID         uuid.UUID
+	DeliveryID uuid.UUID
+	Attempt    int64
+	StatusCode sql.NullInt64
+	Error      sql.NullString
+	DurationMs int64
+}
+
+func (q *Queries) CreateWebhookDeliveryAttempt(ctx context.Context, arg CreateWebhookDeliveryAttemptParams) (WebhookDeliveryAttempt, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookDeliveryAttempt,
+		arg.ID,
+		arg.DeliveryID,
+		arg.Attempt,
+		arg.StatusCode,
+		arg.Error,
+		arg.DurationMs,
+	)
+	var i WebhookDeliveryAttempt
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.DeliveryID,
+		&i.Attempt,
+		&i.StatusCode,
+		&i.Error,
+		&i.DurationMs,
+	)
+	return i, err
+}
+
+const getWebhookDelivery = `-- name: GetWebhookDelivery :one
+SELECT id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at FROM webhook_deliveries
+WHERE id = ?
+`
+
+func (q *Queries) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookDelivery, id)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+	)
+	return i, err
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at FROM webhook_deliveries
+WHERE endpoint_id = ?1
+AND (CAST(?2 AS TEXT) IS NULL
+    OR (created_at, id) < (CAST(?2 AS TEXT), CAST(?3 AS TEXT)))
+ORDER BY created_at DESC, id DESC
+LIMIT ?4
+`
+
+type ListWebhookDeliveriesParams struct {
+	EndpointID      uuid.UUID
+	BeforeCreatedAt sql.NullString
+	BeforeID        sql.NullString
+	Limit           int64
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries,
+		arg.EndpointID,
+		arg.BeforeCreatedAt,
+		arg.BeforeID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDelivery
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EndpointID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastAttemptAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveryAttempts = `-- name: ListWebhookDeliveryAttempts :many
+SELECT id, created_at, delivery_id, attempt, status_code, error, duration_ms FROM webhook_delivery_attempts
+WHERE delivery_id = ?
+ORDER BY attempt
+`
+
+func (q *Queries) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]WebhookDeliveryAttempt, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveryAttempts, deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookDeliveryAttempt
+	for rows.Next() {
+		var i WebhookDeliveryAttempt
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.DeliveryID,
+			&i.Attempt,
+			&i.StatusCode,
+			&i.Error,
+			&i.DurationMs,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateWebhookDeliveryAttempt = `-- name: UpdateWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = ?1, attempts = attempts + 1,
+    next_attempt_at = CAST(?2 AS TEXT), last_attempt_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = ?3
+RETURNING id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at, last_attempt_at
+`
+
+type UpdateWebhookDeliveryAttemptParams struct {
+	Status        string
+	NextAttemptAt string
+	ID            uuid.UUID
+}
+
+func (q *Queries) UpdateWebhookDeliveryAttempt(ctx context.Context, arg UpdateWebhookDeliveryAttemptParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, updateWebhookDeliveryAttempt, arg.Status, arg.NextAttemptAt, arg.ID)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EndpointID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastAttemptAt,
+	)
+	return i, err
+}
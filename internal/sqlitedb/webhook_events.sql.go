@@ -0,0 +1,184 @@
+// Code generated by sqlc. DO NOT EDIT.
+// versions:
+//   sqlc v1.30.0
+// source: webhook_events.sql
+
+package sqlitedb
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/google/uuid"
+)
+
+const createWebhookEvent = `-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, created_at, updated_at, event_id, event, payload, status, attempts)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?, 'pending', 0
+)
+ON CONFLICT (event_id) DO NOTHING
+RETURNING id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at
+`
+
+type CreateWebhookEventParams struct {
+	ID      uuid.UUID
+	EventID string
+	Event   string
+	Payload string
+}
+
+func (q *Queries) CreateWebhookEvent(ctx context.Context, arg CreateWebhookEventParams) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookEvent,
+		arg.ID,
+		arg.EventID,
+		arg.Event,
+		arg.Payload,
+	)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EventID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.LastError,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const getWebhookEvent = `-- name: GetWebhookEvent :one
+SELECT id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at FROM webhook_events
+WHERE id = ?
+`
+
+func (q *Queries) GetWebhookEvent(ctx context.Context, id uuid.UUID) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEvent, id)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EventID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.LastError,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const getWebhookEventByEventID = `-- name: GetWebhookEventByEventID :one
+SELECT id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at FROM webhook_events
+WHERE event_id = ?
+`
+
+func (q *Queries) GetWebhookEventByEventID(ctx context.Context, eventID string) (WebhookEvent, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookEventByEventID, eventID)
+	var i WebhookEvent
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.EventID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.LastError,
+		&i.ProcessedAt,
+	)
+	return i, err
+}
+
+const listWebhookEvents = `-- name: ListWebhookEvents :many
+SELECT id, created_at, updated_at, event_id, event, payload, status, attempts, last_error, processed_at FROM webhook_events
+WHERE status = ?1
+AND (CAST(?2 AS TEXT) IS NULL
+    OR (created_at, id) > (CAST(?2 AS TEXT), CAST(?3 AS TEXT)))
+ORDER BY created_at, id
+LIMIT ?4
+`
+
+type ListWebhookEventsParams struct {
+	Status         string
+	AfterCreatedAt sql.NullString
+	AfterID        sql.NullString
+	Limit          int64
+}
+
+func (q *Queries) ListWebhookEvents(ctx context.Context, arg ListWebhookEventsParams) ([]WebhookEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookEvents,
+		arg.Status,
+		arg.AfterCreatedAt,
+		arg.AfterID,
+		arg.Limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WebhookEvent
+	for rows.Next() {
+		var i WebhookEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.EventID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.LastError,
+			&i.ProcessedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markWebhookEventFailed = `-- name: MarkWebhookEventFailed :exec
+UPDATE webhook_events
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'failed', attempts = attempts + 1, last_error = ?1
+WHERE id = ?2 AND status <> 'processed'
+`
+
+type MarkWebhookEventFailedParams struct {
+	LastError sql.NullString
+	ID        uuid.UUID
+}
+
+func (q *Queries) MarkWebhookEventFailed(ctx context.Context, arg MarkWebhookEventFailedParams) error {
+	_, err := q.db.ExecContext(ctx, markWebhookEventFailed, arg.LastError, arg.ID)
+	return err
+}
+
+const markWebhookEventProcessed = `-- name: MarkWebhookEventProcessed :execrows
+UPDATE webhook_events
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'processed', attempts = attempts + 1, last_error = NULL,
+    processed_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = ? AND status <> 'processed'
+`
+
+func (q *Queries) MarkWebhookEventProcessed(ctx context.Context, id uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, markWebhookEventProcessed, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,1394 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+var (
+	errDuplicateEmail   = errors.New("duplicate key value violates unique constraint \"users_email_key\"")
+	errUserMissing      = errors.New("insert or update violates foreign key constraint, user doesn't exist")
+	errChirpMissing     = errors.New("insert or update violates foreign key constraint, chirp doesn't exist")
+	errFollowSelf       = errors.New("new row violates check constraint \"follows_check\"")
+	errOpenSubscription = errors.New("duplicate key value violates unique constraint \"subscriptions_user_id_open_idx\"")
+
+	errWebhookEndpointMissing = errors.New("insert or update violates foreign key constraint, webhook endpoint doesn't exist")
+	errWebhookDeliveryMissing = errors.New("insert or update violates foreign key constraint, webhook delivery doesn't exist")
+)
+
+// Memory is a thread-safe Store which keeps everything in maps. It mirrors the behaviour of the SQL queries,
+// including sql.ErrNoRows for missing rows and the ON DELETE rules of the schema.
+type Memory struct {
+	mu   sync.Mutex
+	data *memoryData
+}
+
+type follow struct {
+	followerId uuid.UUID
+	followeeId uuid.UUID
+}
+
+type memoryData struct {
+	users         map[uuid.UUID]database.User
+	chirps        map[uuid.UUID]database.Chirp
+	revisions     map[uuid.UUID]database.ChirpRevision
+	follows       map[follow]time.Time
+	refreshTokens map[string]database.RefreshToken
+	resets        map[string]database.PasswordReset
+	totpSecrets   map[uuid.UUID]database.TotpSecret
+	recoveryCodes map[string]database.RecoveryCode
+	subscriptions map[uuid.UUID]database.Subscription
+	webhookEvents map[uuid.UUID]database.WebhookEvent
+	endpoints     map[uuid.UUID]database.WebhookEndpoint
+	deliveries    map[uuid.UUID]database.WebhookDelivery
+	attempts      map[uuid.UUID]database.WebhookDeliveryAttempt
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		data: newMemoryData(),
+	}
+}
+
+func newMemoryData() *memoryData {
+	return &memoryData{
+		users:         make(map[uuid.UUID]database.User),
+		chirps:        make(map[uuid.UUID]database.Chirp),
+		revisions:     make(map[uuid.UUID]database.ChirpRevision),
+		follows:       make(map[follow]time.Time),
+		refreshTokens: make(map[string]database.RefreshToken),
+		resets:        make(map[string]database.PasswordReset),
+		totpSecrets:   make(map[uuid.UUID]database.TotpSecret),
+		recoveryCodes: make(map[string]database.RecoveryCode),
+		subscriptions: make(map[uuid.UUID]database.Subscription),
+		webhookEvents: make(map[uuid.UUID]database.WebhookEvent),
+		endpoints:     make(map[uuid.UUID]database.WebhookEndpoint),
+		deliveries:    make(map[uuid.UUID]database.WebhookDelivery),
+		attempts:      make(map[uuid.UUID]database.WebhookDeliveryAttempt),
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := newMemoryData()
+	for k, v := range d.users {
+		c.users[k] = v
+	}
+	for k, v := range d.chirps {
+		c.chirps[k] = v
+	}
+	for k, v := range d.revisions {
+		c.revisions[k] = v
+	}
+	for k, v := range d.follows {
+		c.follows[k] = v
+	}
+	for k, v := range d.refreshTokens {
+		c.refreshTokens[k] = v
+	}
+	for k, v := range d.resets {
+		c.resets[k] = v
+	}
+	for k, v := range d.totpSecrets {
+		c.totpSecrets[k] = v
+	}
+	for k, v := range d.recoveryCodes {
+		c.recoveryCodes[k] = v
+	}
+	for k, v := range d.subscriptions {
+		c.subscriptions[k] = v
+	}
+	for k, v := range d.webhookEvents {
+		c.webhookEvents[k] = v
+	}
+	for k, v := range d.endpoints {
+		c.endpoints[k] = v
+	}
+	for k, v := range d.deliveries {
+		c.deliveries[k] = v
+	}
+	for k, v := range d.attempts {
+		c.attempts[k] = v
+	}
+	return c
+}
+
+// InTx runs fn against a copy of the data, which replaces the data only if fn succeeds.
+// Transactions are serialized with everything else.
+func (m *Memory) InTx(ctx context.Context, fn func(q database.Querier) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &Memory{data: m.data.clone()}
+	err := fn(tx)
+	if err != nil {
+		return err
+	}
+	m.data = tx.data
+	return nil
+}
+
+// now matches the precision of Postgres timestamps.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+// less orders rows by (created_at, id) the same way Postgres compares the row values.
+func less(aCreatedAt time.Time, aId uuid.UUID, bCreatedAt time.Time, bId uuid.UUID) bool {
+	if !aCreatedAt.Equal(bCreatedAt) {
+		return aCreatedAt.Before(bCreatedAt)
+	}
+	return bytes.Compare(aId[:], bId[:]) < 0
+}
+
+func limit[T any](items []T, n int32) []T {
+	if int(n) < len(items) {
+		return items[:n]
+	}
+	return items
+}
+
+// Users
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.data.users {
+		if u.Email == arg.Email {
+			return database.User{}, errDuplicateEmail
+		}
+	}
+	t := now()
+	user := database.User{
+		ID:             uuid.New(),
+		CreatedAt:      t,
+		UpdatedAt:      t,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	}
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) DeleteAllUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Everything else references users with ON DELETE CASCADE, except the webhook inbox and the webhook endpoints
+	// of admins.
+	for id, e := range m.data.endpoints {
+		if e.UserID.Valid {
+			m.data.deleteWebhookEndpoint(id)
+		}
+	}
+	old := m.data
+	m.data = newMemoryData()
+	m.data.webhookEvents = old.webhookEvents
+	m.data.endpoints = old.endpoints
+	m.data.deliveries = old.deliveries
+	m.data.attempts = old.attempts
+	return nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, u := range m.data.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	for _, other := range m.data.users {
+		if other.ID != arg.ID && other.Email == arg.Email {
+			return database.User{}, errDuplicateEmail
+		}
+	}
+	if u.Email != arg.Email {
+		u.EmailVerifiedAt = sql.NullTime{}
+		u.VerificationSentAt = sql.NullTime{}
+	}
+	u.UpdatedAt = now()
+	u.Email = arg.Email
+	u.HashedPassword = arg.HashedPassword
+	m.data.users[u.ID] = u
+	return u, nil
+}
+
+func (m *Memory) VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[arg.ID]
+	if !ok || u.Email != arg.Email {
+		return database.User{}, sql.ErrNoRows
+	}
+	t := now()
+	u.UpdatedAt = t
+	if !u.EmailVerifiedAt.Valid {
+		u.EmailVerifiedAt = sql.NullTime{Time: t, Valid: true}
+	}
+	m.data.users[u.ID] = u
+	return u, nil
+}
+
+func (m *Memory) MarkVerificationSent(ctx context.Context, arg database.MarkVerificationSentParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[arg.ID]
+	if !ok || u.EmailVerifiedAt.Valid || (u.VerificationSentAt.Valid && !u.VerificationSentAt.Time.Before(arg.SentBefore)) {
+		return 0, nil
+	}
+	u.VerificationSentAt = sql.NullTime{Time: now(), Valid: true}
+	m.data.users[u.ID] = u
+	return 1, nil
+}
+
+func (m *Memory) SetUserChirpyRed(ctx context.Context, arg database.SetUserChirpyRedParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[arg.ID]
+	if !ok {
+		return 0, nil
+	}
+	u.UpdatedAt = now()
+	u.IsChirpyRed = arg.IsChirpyRed
+	m.data.users[arg.ID] = u
+	return 1, nil
+}
+
+func (m *Memory) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, ok := m.data.users[arg.ID]
+	if !ok {
+		return nil
+	}
+	u.UpdatedAt = now()
+	u.HashedPassword = arg.HashedPassword
+	m.data.users[arg.ID] = u
+	return nil
+}
+
+// Chirps
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Chirp{}, errUserMissing
+	}
+	if _, ok := m.data.chirps[arg.InReplyTo.UUID]; arg.InReplyTo.Valid && !ok {
+		return database.Chirp{}, errChirpMissing
+	}
+	t := now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		InReplyTo: arg.InReplyTo,
+	}
+	m.data.chirps[chirp.ID] = chirp
+	return chirp, nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.data.chirps[id]
+	if !ok || c.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func (m *Memory) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.chirps[id]; !ok {
+		return 0, nil
+	}
+	for _, c := range m.data.chirps {
+		if c.InReplyTo.Valid && c.InReplyTo.UUID == id {
+			return 0, nil
+		}
+	}
+	m.data.deleteChirp(id)
+	return 1, nil
+}
+
+// deleteChirp applies the ON DELETE rules: revisions are deleted, replies lose their parent.
+func (d *memoryData) deleteChirp(id uuid.UUID) {
+	delete(d.chirps, id)
+	for rid, r := range d.revisions {
+		if r.ChirpID == id {
+			delete(d.revisions, rid)
+		}
+	}
+	for cid, c := range d.chirps {
+		if c.InReplyTo.Valid && c.InReplyTo.UUID == id {
+			c.InReplyTo = uuid.NullUUID{}
+			d.chirps[cid] = c
+		}
+	}
+}
+
+func (m *Memory) UpdateChirp(ctx context.Context, arg database.UpdateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.data.chirps[arg.ID]
+	if !ok || c.DeletedAt.Valid {
+		return database.Chirp{}, sql.ErrNoRows
+	}
+	c.UpdatedAt = now()
+	c.Body = arg.Body
+	m.data.chirps[c.ID] = c
+	return c, nil
+}
+
+func (m *Memory) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.data.chirps[id]
+	if ok {
+		t := now()
+		c.UpdatedAt = t
+		c.DeletedAt = sql.NullTime{Time: t, Valid: true}
+		c.Body = ""
+		m.data.chirps[id] = c
+	}
+	return nil
+}
+
+// listChirps returns the visible chirps matching keep, ordered by (created_at, id).
+func (d *memoryData) listChirps(desc bool, keep func(c database.Chirp) bool) []database.Chirp {
+	chirps := []database.Chirp{}
+	for _, c := range d.chirps {
+		if !c.DeletedAt.Valid && keep(c) {
+			chirps = append(chirps, c)
+		}
+	}
+	sort.Slice(chirps, func(i, j int) bool {
+		if desc {
+			return less(chirps[j].CreatedAt, chirps[j].ID, chirps[i].CreatedAt, chirps[i].ID)
+		}
+		return less(chirps[i].CreatedAt, chirps[i].ID, chirps[j].CreatedAt, chirps[j].ID)
+	})
+	return chirps
+}
+
+func (m *Memory) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chirps := m.data.listChirps(false, func(c database.Chirp) bool {
+		if arg.UserID.Valid && c.UserID != arg.UserID.UUID {
+			return false
+		}
+		return !arg.AfterCreatedAt.Valid || less(arg.AfterCreatedAt.Time, arg.AfterID.UUID, c.CreatedAt, c.ID)
+	})
+	return limit(chirps, arg.Limit), nil
+}
+
+func (m *Memory) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chirps := m.data.listChirps(true, func(c database.Chirp) bool {
+		if arg.UserID.Valid && c.UserID != arg.UserID.UUID {
+			return false
+		}
+		return !arg.BeforeCreatedAt.Valid || less(c.CreatedAt, c.ID, arg.BeforeCreatedAt.Time, arg.BeforeID.UUID)
+	})
+	return limit(chirps, arg.Limit), nil
+}
+
+func (m *Memory) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.ListChirpAncestorsRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ancestors := []database.ListChirpAncestorsRow{}
+	c, ok := m.data.chirps[id]
+	for ok && c.InReplyTo.Valid {
+		c, ok = m.data.chirps[c.InReplyTo.UUID]
+		if ok {
+			ancestors = append([]database.ListChirpAncestorsRow{database.ListChirpAncestorsRow(c)}, ancestors...)
+		}
+	}
+	return ancestors, nil
+}
+
+func (m *Memory) ListChirpDescendants(ctx context.Context, arg database.ListChirpDescendantsParams) ([]database.ListChirpDescendantsRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	root, ok := m.data.chirps[arg.ID]
+	if !ok {
+		return []database.ListChirpDescendantsRow{}, nil
+	}
+
+	children := make(map[uuid.UUID][]database.Chirp)
+	for _, c := range m.data.chirps {
+		if c.InReplyTo.Valid {
+			children[c.InReplyTo.UUID] = append(children[c.InReplyTo.UUID], c)
+		}
+	}
+
+	rows := []database.ListChirpDescendantsRow{}
+	level := []database.Chirp{root}
+	for depth := int32(0); len(level) > 0; depth++ {
+		next := []database.Chirp{}
+		for _, c := range level {
+			rows = append(rows, descendantRow(c, depth))
+			if depth < arg.MaxDepth {
+				next = append(next, children[c.ID]...)
+			}
+		}
+		level = next
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if rows[i].Depth != rows[j].Depth {
+			return rows[i].Depth < rows[j].Depth
+		}
+		return less(rows[i].CreatedAt, rows[i].ID, rows[j].CreatedAt, rows[j].ID)
+	})
+	return limit(rows, arg.MaxRows), nil
+}
+
+func descendantRow(c database.Chirp, depth int32) database.ListChirpDescendantsRow {
+	return database.ListChirpDescendantsRow{
+		ID:        c.ID,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+		Body:      c.Body,
+		UserID:    c.UserID,
+		InReplyTo: c.InReplyTo,
+		DeletedAt: c.DeletedAt,
+		Depth:     depth,
+	}
+}
+
+// Chirp revisions
+
+func (m *Memory) CreateChirpRevision(ctx context.Context, chirpID uuid.UUID) (database.ChirpRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chirp, ok := m.data.chirps[chirpID]
+	if !ok || chirp.DeletedAt.Valid {
+		return database.ChirpRevision{}, sql.ErrNoRows
+	}
+	revision := database.ChirpRevision{
+		ID:        uuid.New(),
+		CreatedAt: now(),
+		ChirpID:   chirp.ID,
+		Body:      chirp.Body,
+	}
+	m.data.revisions[revision.ID] = revision
+	return revision, nil
+}
+
+func (m *Memory) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	revisions := []database.ChirpRevision{}
+	for _, r := range m.data.revisions {
+		if r.ChirpID == chirpID {
+			revisions = append(revisions, r)
+		}
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return less(revisions[i].CreatedAt, revisions[i].ID, revisions[j].CreatedAt, revisions[j].ID)
+	})
+	return revisions, nil
+}
+
+func (m *Memory) DeleteChirpRevisions(ctx context.Context, chirpID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, r := range m.data.revisions {
+		if r.ChirpID == chirpID {
+			delete(m.data.revisions, id)
+		}
+	}
+	return nil
+}
+
+// Follows
+
+func (m *Memory) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, followerOk := m.data.users[arg.FollowerID]
+	_, followeeOk := m.data.users[arg.FolloweeID]
+	if !followerOk || !followeeOk {
+		return errUserMissing
+	}
+	if arg.FollowerID == arg.FolloweeID {
+		return errFollowSelf
+	}
+	f := follow{followerId: arg.FollowerID, followeeId: arg.FolloweeID}
+	if _, ok := m.data.follows[f]; !ok {
+		m.data.follows[f] = now()
+	}
+	return nil
+}
+
+func (m *Memory) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.follows, follow{followerId: arg.FollowerID, followeeId: arg.FolloweeID})
+	return nil
+}
+
+func (m *Memory) ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.ListFollowersRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows := []database.ListFollowersRow{}
+	for f, createdAt := range m.data.follows {
+		if f.followeeId != arg.FolloweeID {
+			continue
+		}
+		if arg.AfterCreatedAt.Valid && !less(arg.AfterCreatedAt.Time, arg.AfterID.UUID, createdAt, f.followerId) {
+			continue
+		}
+		rows = append(rows, database.ListFollowersRow{UserID: f.followerId, CreatedAt: createdAt})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return less(rows[i].CreatedAt, rows[i].UserID, rows[j].CreatedAt, rows[j].UserID)
+	})
+	return limit(rows, arg.Limit), nil
+}
+
+func (m *Memory) ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.ListFollowingRow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rows := []database.ListFollowingRow{}
+	for f, createdAt := range m.data.follows {
+		if f.followerId != arg.FollowerID {
+			continue
+		}
+		if arg.AfterCreatedAt.Valid && !less(arg.AfterCreatedAt.Time, arg.AfterID.UUID, createdAt, f.followeeId) {
+			continue
+		}
+		rows = append(rows, database.ListFollowingRow{UserID: f.followeeId, CreatedAt: createdAt})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return less(rows[i].CreatedAt, rows[i].UserID, rows[j].CreatedAt, rows[j].UserID)
+	})
+	return limit(rows, arg.Limit), nil
+}
+
+func (m *Memory) ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	chirps := m.data.listChirps(true, func(c database.Chirp) bool {
+		if _, ok := m.data.follows[follow{followerId: arg.FollowerID, followeeId: c.UserID}]; !ok {
+			return false
+		}
+		return !arg.BeforeCreatedAt.Valid || less(c.CreatedAt, c.ID, arg.BeforeCreatedAt.Time, arg.BeforeID.UUID)
+	})
+	return limit(chirps, arg.Limit), nil
+}
+
+// Refresh tokens
+
+func (m *Memory) RefreshToken(ctx context.Context, arg database.RefreshTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, errUserMissing
+	}
+	t := now()
+	token := database.RefreshToken{
+		TokenHash: arg.TokenHash,
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		ExpiresAt: t.AddDate(0, 0, 60),
+		FamilyID:  arg.FamilyID,
+	}
+	m.data.refreshTokens[token.TokenHash] = token
+	return token, nil
+}
+
+func (m *Memory) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.data.refreshTokens[tokenHash]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return token, nil
+}
+
+func (m *Memory) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.data.refreshTokens[tokenHash]
+	if ok {
+		m.data.refreshTokens[tokenHash] = revoked(token)
+	}
+	return nil
+}
+
+func (m *Memory) RevokeActiveRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.data.refreshTokens[tokenHash]
+	if !ok || token.RevokedAt.Valid {
+		return 0, nil
+	}
+	m.data.refreshTokens[tokenHash] = revoked(token)
+	return 1, nil
+}
+
+func (m *Memory) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.data.refreshTokens {
+		if token.FamilyID == familyID && !token.RevokedAt.Valid {
+			m.data.refreshTokens[hash] = revoked(token)
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, token := range m.data.refreshTokens {
+		if token.UserID == userID && !token.RevokedAt.Valid {
+			m.data.refreshTokens[hash] = revoked(token)
+		}
+	}
+	return nil
+}
+
+func revoked(token database.RefreshToken) database.RefreshToken {
+	t := now()
+	token.UpdatedAt = t
+	token.RevokedAt = sql.NullTime{Time: t, Valid: true}
+	return token
+}
+
+// Password resets
+
+func (m *Memory) CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) (database.PasswordReset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.PasswordReset{}, errUserMissing
+	}
+	reset := database.PasswordReset{
+		TokenHash: arg.TokenHash,
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+		ExpiresAt: arg.ExpiresAt.UTC(),
+	}
+	m.data.resets[reset.TokenHash] = reset
+	return reset, nil
+}
+
+func (m *Memory) CountPasswordResetsSince(ctx context.Context, arg database.CountPasswordResetsSinceParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := int64(0)
+	for _, reset := range m.data.resets {
+		if reset.UserID == arg.UserID && !reset.CreatedAt.Before(arg.Since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) UsePasswordReset(ctx context.Context, arg database.UsePasswordResetParams) (database.PasswordReset, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reset, ok := m.data.resets[arg.TokenHash]
+	if !ok || reset.UsedAt.Valid || !reset.ExpiresAt.After(arg.Now) {
+		return database.PasswordReset{}, sql.ErrNoRows
+	}
+	reset.UsedAt = sql.NullTime{Time: now(), Valid: true}
+	m.data.resets[reset.TokenHash] = reset
+	return reset, nil
+}
+
+func (m *Memory) InvalidatePasswordResets(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t := now()
+	for hash, reset := range m.data.resets {
+		if reset.UserID == userID && !reset.UsedAt.Valid {
+			reset.UsedAt = sql.NullTime{Time: t, Valid: true}
+			m.data.resets[hash] = reset
+		}
+	}
+	return nil
+}
+
+// TOTP
+
+func (m *Memory) UpsertTOTPSecret(ctx context.Context, arg database.UpsertTOTPSecretParams) (database.TotpSecret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.TotpSecret{}, errUserMissing
+	}
+	if old, ok := m.data.totpSecrets[arg.UserID]; ok && old.EnabledAt.Valid {
+		return database.TotpSecret{}, sql.ErrNoRows
+	}
+	t := now()
+	secret := database.TotpSecret{
+		UserID:    arg.UserID,
+		CreatedAt: t,
+		UpdatedAt: t,
+		Secret:    arg.Secret,
+	}
+	m.data.totpSecrets[secret.UserID] = secret
+	return secret, nil
+}
+
+func (m *Memory) GetTOTPSecret(ctx context.Context, userID uuid.UUID) (database.TotpSecret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.data.totpSecrets[userID]
+	if !ok {
+		return database.TotpSecret{}, sql.ErrNoRows
+	}
+	return secret, nil
+}
+
+func (m *Memory) EnableTOTP(ctx context.Context, arg database.EnableTOTPParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.data.totpSecrets[arg.UserID]
+	if !ok || secret.EnabledAt.Valid {
+		return 0, nil
+	}
+	t := now()
+	secret.UpdatedAt = t
+	secret.EnabledAt = sql.NullTime{Time: t, Valid: true}
+	secret.LastUsedStep = sql.NullInt64{Int64: arg.Step, Valid: true}
+	m.data.totpSecrets[arg.UserID] = secret
+	return 1, nil
+}
+
+func (m *Memory) UseTOTPStep(ctx context.Context, arg database.UseTOTPStepParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.data.totpSecrets[arg.UserID]
+	if !ok || (secret.LastUsedStep.Valid && secret.LastUsedStep.Int64 >= arg.Step) || totpLocked(secret, arg.Now) {
+		return 0, nil
+	}
+	secret.UpdatedAt = now()
+	secret.LastUsedStep = sql.NullInt64{Int64: arg.Step, Valid: true}
+	secret.FailedAttempts = 0
+	m.data.totpSecrets[arg.UserID] = secret
+	return 1, nil
+}
+
+func (m *Memory) ClearTOTPFailures(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.data.totpSecrets[userID]
+	if ok {
+		secret.UpdatedAt = now()
+		secret.FailedAttempts = 0
+		m.data.totpSecrets[userID] = secret
+	}
+	return nil
+}
+
+func (m *Memory) StartTOTPAttempt(ctx context.Context, arg database.StartTOTPAttemptParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.data.totpSecrets[arg.UserID]
+	if !ok || !secret.EnabledAt.Valid || totpLocked(secret, arg.Now) {
+		return 0, nil
+	}
+	switch {
+	case secret.FailedAttempts < arg.MaxAttempts:
+		secret.FailedAttempts++
+	case secret.UpdatedAt.Before(arg.StaleBefore):
+		secret.FailedAttempts = 1
+	default:
+		return 0, nil
+	}
+	secret.UpdatedAt = now()
+	m.data.totpSecrets[arg.UserID] = secret
+	return 1, nil
+}
+
+func (m *Memory) RecordTOTPFailure(ctx context.Context, arg database.RecordTOTPFailureParams) (database.TotpSecret, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, ok := m.data.totpSecrets[arg.UserID]
+	if !ok {
+		return database.TotpSecret{}, sql.ErrNoRows
+	}
+	secret.UpdatedAt = now()
+	if secret.FailedAttempts >= arg.MaxAttempts {
+		secret.FailedAttempts = 0
+		secret.LockedUntil = sql.NullTime{Time: arg.LockUntil.UTC(), Valid: true}
+	}
+	m.data.totpSecrets[arg.UserID] = secret
+	return secret, nil
+}
+
+// totpLocked reports whether secret is locked at t.
+func totpLocked(secret database.TotpSecret, t time.Time) bool {
+	return secret.LockedUntil.Valid && secret.LockedUntil.Time.After(t)
+}
+
+func (m *Memory) DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.totpSecrets, userID)
+	return nil
+}
+
+func (m *Memory) CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return errUserMissing
+	}
+	m.data.recoveryCodes[arg.CodeHash] = database.RecoveryCode{
+		CodeHash:  arg.CodeHash,
+		CreatedAt: now(),
+		UserID:    arg.UserID,
+	}
+	return nil
+}
+
+func (m *Memory) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	code, ok := m.data.recoveryCodes[arg.CodeHash]
+	if !ok || code.UserID != arg.UserID || code.UsedAt.Valid || totpLocked(m.data.totpSecrets[arg.UserID], arg.Now) {
+		return 0, nil
+	}
+	code.UsedAt = sql.NullTime{Time: now(), Valid: true}
+	m.data.recoveryCodes[arg.CodeHash] = code
+	return 1, nil
+}
+
+func (m *Memory) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, code := range m.data.recoveryCodes {
+		if code.UserID == userID {
+			delete(m.data.recoveryCodes, hash)
+		}
+	}
+	return nil
+}
+
+// Subscriptions
+
+func isOpen(s database.Subscription) bool {
+	return s.Status == "active" || s.Status == "past_due"
+}
+
+func (m *Memory) CreateSubscription(ctx context.Context, arg database.CreateSubscriptionParams) (database.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Subscription{}, errUserMissing
+	}
+	for _, s := range m.data.subscriptions {
+		if s.UserID == arg.UserID && isOpen(s) {
+			return database.Subscription{}, errOpenSubscription
+		}
+	}
+	t := now()
+	subscription := database.Subscription{
+		ID:                 uuid.New(),
+		CreatedAt:          t,
+		UpdatedAt:          t,
+		UserID:             arg.UserID,
+		Status:             "active",
+		CurrentPeriodStart: arg.CurrentPeriodStart,
+		CurrentPeriodEnd:   arg.CurrentPeriodEnd,
+	}
+	m.data.subscriptions[subscription.ID] = subscription
+	return subscription, nil
+}
+
+func (m *Memory) GetOpenSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, s := range m.data.subscriptions {
+		if s.UserID == userID && isOpen(s) {
+			return s, nil
+		}
+	}
+	return database.Subscription{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetLatestSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	latest, found := database.Subscription{}, false
+	for _, s := range m.data.subscriptions {
+		if s.UserID == userID && (!found || less(latest.CreatedAt, latest.ID, s.CreatedAt, s.ID)) {
+			latest, found = s, true
+		}
+	}
+	if !found {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	return latest, nil
+}
+
+// updateSubscription applies change to the subscription id and returns it, like UPDATE ... RETURNING *.
+func (m *Memory) updateSubscription(id uuid.UUID, change func(s *database.Subscription)) (database.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ok := m.data.subscriptions[id]
+	if !ok {
+		return database.Subscription{}, sql.ErrNoRows
+	}
+	s.UpdatedAt = now()
+	change(&s)
+	m.data.subscriptions[id] = s
+	return s, nil
+}
+
+func (m *Memory) RenewSubscription(ctx context.Context, arg database.RenewSubscriptionParams) (database.Subscription, error) {
+	return m.updateSubscription(arg.ID, func(s *database.Subscription) {
+		s.Status = "active"
+		s.CurrentPeriodStart = arg.CurrentPeriodStart
+		s.CurrentPeriodEnd = arg.CurrentPeriodEnd
+	})
+}
+
+func (m *Memory) MarkSubscriptionPastDue(ctx context.Context, id uuid.UUID) (database.Subscription, error) {
+	return m.updateSubscription(id, func(s *database.Subscription) {
+		s.Status = "past_due"
+	})
+}
+
+func (m *Memory) CancelSubscription(ctx context.Context, id uuid.UUID) (database.Subscription, error) {
+	return m.updateSubscription(id, func(s *database.Subscription) {
+		s.Status = "canceled"
+		s.EndedAt = sql.NullTime{Time: s.UpdatedAt, Valid: true}
+	})
+}
+
+func (m *Memory) ExpireSubscriptions(ctx context.Context, endedBefore time.Time) ([]database.Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	expired := []database.Subscription{}
+	for id, s := range m.data.subscriptions {
+		if isOpen(s) && s.CurrentPeriodEnd.Before(endedBefore) {
+			t := now()
+			s.UpdatedAt = t
+			s.Status = "expired"
+			s.EndedAt = sql.NullTime{Time: t, Valid: true}
+			m.data.subscriptions[id] = s
+			expired = append(expired, s)
+		}
+	}
+	return expired, nil
+}
+
+// Webhook events
+
+func (m *Memory) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (database.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// ON CONFLICT (event_id) DO NOTHING RETURNING * returns no row.
+	for _, e := range m.data.webhookEvents {
+		if e.EventID == arg.EventID {
+			return database.WebhookEvent{}, sql.ErrNoRows
+		}
+	}
+	t := now()
+	event := database.WebhookEvent{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		EventID:   arg.EventID,
+		Event:     arg.Event,
+		Payload:   arg.Payload,
+		Status:    "pending",
+	}
+	m.data.webhookEvents[event.ID] = event
+	return event, nil
+}
+
+func (m *Memory) GetWebhookEvent(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data.webhookEvents[id]
+	if !ok {
+		return database.WebhookEvent{}, sql.ErrNoRows
+	}
+	return e, nil
+}
+
+func (m *Memory) GetWebhookEventByEventID(ctx context.Context, eventID string) (database.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, e := range m.data.webhookEvents {
+		if e.EventID == eventID {
+			return e, nil
+		}
+	}
+	return database.WebhookEvent{}, sql.ErrNoRows
+}
+
+func (m *Memory) MarkWebhookEventProcessed(ctx context.Context, id uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data.webhookEvents[id]
+	if !ok || e.Status == "processed" {
+		return 0, nil
+	}
+	t := now()
+	e.UpdatedAt = t
+	e.Status = "processed"
+	e.Attempts++
+	e.LastError = sql.NullString{}
+	e.ProcessedAt = sql.NullTime{Time: t, Valid: true}
+	m.data.webhookEvents[id] = e
+	return 1, nil
+}
+
+func (m *Memory) MarkWebhookEventFailed(ctx context.Context, arg database.MarkWebhookEventFailedParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data.webhookEvents[arg.ID]
+	if ok && e.Status != "processed" {
+		e.UpdatedAt = now()
+		e.Status = "failed"
+		e.Attempts++
+		e.LastError = arg.LastError
+		m.data.webhookEvents[arg.ID] = e
+	}
+	return nil
+}
+
+func (m *Memory) ListWebhookEvents(ctx context.Context, arg database.ListWebhookEventsParams) ([]database.WebhookEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	events := []database.WebhookEvent{}
+	for _, e := range m.data.webhookEvents {
+		if e.Status != arg.Status {
+			continue
+		}
+		if arg.AfterCreatedAt.Valid && !less(arg.AfterCreatedAt.Time, arg.AfterID.UUID, e.CreatedAt, e.ID) {
+			continue
+		}
+		events = append(events, e)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return less(events[i].CreatedAt, events[i].ID, events[j].CreatedAt, events[j].ID)
+	})
+	return limit(events, arg.Limit), nil
+}
+
+// Webhook endpoints
+
+func (m *Memory) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID.UUID]; arg.UserID.Valid && !ok {
+		return database.WebhookEndpoint{}, errUserMissing
+	}
+	t := now()
+	endpoint := database.WebhookEndpoint{
+		ID:        uuid.New(),
+		CreatedAt: t,
+		UpdatedAt: t,
+		UserID:    arg.UserID,
+		Url:       arg.Url,
+		Secret:    arg.Secret,
+		Events:    arg.Events,
+	}
+	m.data.endpoints[endpoint.ID] = endpoint
+	return endpoint, nil
+}
+
+func (m *Memory) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data.endpoints[id]
+	if !ok {
+		return database.WebhookEndpoint{}, sql.ErrNoRows
+	}
+	return e, nil
+}
+
+func (m *Memory) ListWebhookEndpoints(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.data.listWebhookEndpoints(func(e database.WebhookEndpoint) bool {
+		return e.UserID == userID
+	}), nil
+}
+
+func (m *Memory) ListWebhookEndpointsForUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookEndpoint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.data.listWebhookEndpoints(func(e database.WebhookEndpoint) bool {
+		return !e.UserID.Valid || (userID.Valid && e.UserID.UUID == userID.UUID)
+	}), nil
+}
+
+func (d *memoryData) listWebhookEndpoints(keep func(e database.WebhookEndpoint) bool) []database.WebhookEndpoint {
+	endpoints := []database.WebhookEndpoint{}
+	for _, e := range d.endpoints {
+		if keep(e) {
+			endpoints = append(endpoints, e)
+		}
+	}
+	sort.Slice(endpoints, func(i, j int) bool {
+		return less(endpoints[i].CreatedAt, endpoints[i].ID, endpoints[j].CreatedAt, endpoints[j].ID)
+	})
+	return endpoints
+}
+
+func (m *Memory) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.data.deleteWebhookEndpoint(id)
+	return nil
+}
+
+// deleteWebhookEndpoint applies the ON DELETE CASCADE to deliveries and their attempts.
+func (d *memoryData) deleteWebhookEndpoint(id uuid.UUID) {
+	delete(d.endpoints, id)
+	for deliveryId, delivery := range d.deliveries {
+		if delivery.EndpointID != id {
+			continue
+		}
+		delete(d.deliveries, deliveryId)
+		for attemptId, attempt := range d.attempts {
+			if attempt.DeliveryID == deliveryId {
+				delete(d.attempts, attemptId)
+			}
+		}
+	}
+}
+
+// Webhook deliveries
+
+func (m *Memory) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.endpoints[arg.EndpointID]; !ok {
+		return database.WebhookDelivery{}, errWebhookEndpointMissing
+	}
+	t := now()
+	delivery := database.WebhookDelivery{
+		ID:            uuid.New(),
+		CreatedAt:     t,
+		UpdatedAt:     t,
+		EndpointID:    arg.EndpointID,
+		Event:         arg.Event,
+		Payload:       arg.Payload,
+		Status:        "pending",
+		NextAttemptAt: arg.NextAttemptAt.UTC().Truncate(time.Microsecond),
+	}
+	m.data.deliveries[delivery.ID] = delivery
+	return delivery, nil
+}
+
+func (m *Memory) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.data.deliveries[id]
+	if !ok {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+	return d, nil
+}
+
+func (m *Memory) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	due := []database.WebhookDelivery{}
+	for _, d := range m.data.deliveries {
+		if d.Status == "pending" && !d.NextAttemptAt.After(arg.Now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+	})
+	due = limit(due, arg.Limit)
+	for i := range due {
+		due[i].UpdatedAt = now()
+		due[i].NextAttemptAt = arg.LeaseUntil.UTC().Truncate(time.Microsecond)
+		m.data.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *Memory) UpdateWebhookDeliveryAttempt(ctx context.Context, arg database.UpdateWebhookDeliveryAttemptParams) (database.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	d, ok := m.data.deliveries[arg.ID]
+	if !ok {
+		return database.WebhookDelivery{}, sql.ErrNoRows
+	}
+	t := now()
+	d.UpdatedAt = t
+	d.Status = arg.Status
+	d.Attempts++
+	d.NextAttemptAt = arg.NextAttemptAt.UTC().Truncate(time.Microsecond)
+	d.LastAttemptAt = sql.NullTime{Time: t, Valid: true}
+	m.data.deliveries[d.ID] = d
+	return d, nil
+}
+
+func (m *Memory) ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	deliveries := []database.WebhookDelivery{}
+	for _, d := range m.data.deliveries {
+		if d.EndpointID != arg.EndpointID {
+			continue
+		}
+		if arg.BeforeCreatedAt.Valid && !less(d.CreatedAt, d.ID, arg.BeforeCreatedAt.Time, arg.BeforeID.UUID) {
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		return less(deliveries[j].CreatedAt, deliveries[j].ID, deliveries[i].CreatedAt, deliveries[i].ID)
+	})
+	return limit(deliveries, arg.Limit), nil
+}
+
+func (m *Memory) CreateWebhookDeliveryAttempt(ctx context.Context, arg database.CreateWebhookDeliveryAttemptParams) (database.WebhookDeliveryAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.deliveries[arg.DeliveryID]; !ok {
+		return database.WebhookDeliveryAttempt{}, errWebhookDeliveryMissing
+	}
+	attempt := database.WebhookDeliveryAttempt{
+		ID:         uuid.New(),
+		CreatedAt:  now(),
+		DeliveryID: arg.DeliveryID,
+		Attempt:    arg.Attempt,
+		StatusCode: arg.StatusCode,
+		Error:      arg.Error,
+		DurationMs: arg.DurationMs,
+	}
+	m.data.attempts[attempt.ID] = attempt
+	return attempt, nil
+}
+
+func (m *Memory) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]database.WebhookDeliveryAttempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	attempts := []database.WebhookDeliveryAttempt{}
+	for _, a := range m.data.attempts {
+		if a.DeliveryID == deliveryID {
+			attempts = append(attempts, a)
+		}
+	}
+	sort.Slice(attempts, func(i, j int) bool {
+		return attempts[i].Attempt < attempts[j].Attempt
+	})
+	return attempts, nil
+}
+
+var _ Store = (*Memory)(nil)
+var _ Store = (*Postgres)(nil)
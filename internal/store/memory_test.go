@@ -0,0 +1,112 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestMemoryUsers(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	user, err := m.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com", HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser returns an error %v", err.Error())
+	}
+	_, err = m.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com", HashedPassword: "hash"})
+	if err == nil {
+		t.Errorf("CreateUser accepts a duplicate email")
+	}
+
+	found, err := m.GetUserByEmail(ctx, "lane@example.com")
+	if err != nil || found.ID != user.ID {
+		t.Errorf("GetUserByEmail returns %v, %v", found, err)
+	}
+	_, err = m.GetUserById(ctx, uuid.New())
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("%v != %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestMemoryListChirpsPagination(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+	created := []database.Chirp{}
+	for i := 0; i < 5; i++ {
+		chirp, err := m.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: user.ID})
+		if err != nil {
+			t.Fatalf("CreateChirp returns an error %v", err.Error())
+		}
+		created = append(created, chirp)
+	}
+
+	// Walk the chirps two at a time, every chirp has to show up exactly once.
+	seen := make(map[uuid.UUID]bool)
+	arg := database.ListChirpsAscParams{Limit: 2}
+	for {
+		page, _ := m.ListChirpsAsc(ctx, arg)
+		if len(page) == 0 {
+			break
+		}
+		for _, c := range page {
+			if seen[c.ID] {
+				t.Errorf("chirp %v returned twice", c.ID)
+			}
+			seen[c.ID] = true
+		}
+		last := page[len(page)-1]
+		arg.AfterCreatedAt = sql.NullTime{Time: last.CreatedAt, Valid: true}
+		arg.AfterID = uuid.NullUUID{UUID: last.ID, Valid: true}
+	}
+	if len(seen) != len(created) {
+		t.Errorf("%v != %v", len(seen), len(created))
+	}
+
+	desc, _ := m.ListChirpsDesc(ctx, database.ListChirpsDescParams{Limit: 10})
+	asc, _ := m.ListChirpsAsc(ctx, database.ListChirpsAscParams{Limit: 10})
+	for i := range asc {
+		if asc[i].ID != desc[len(desc)-1-i].ID {
+			t.Errorf("desc order isn't the reverse of asc order")
+		}
+	}
+}
+
+func TestMemoryInTxRollback(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	errAbort := errors.New("abort")
+
+	err := m.InTx(ctx, func(q database.Querier) error {
+		_, err := q.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("%v != %v", err, errAbort)
+	}
+	_, err = m.GetUserByEmail(ctx, "lane@example.com")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("user created in a rolled back transaction exists")
+	}
+
+	err = m.InTx(ctx, func(q database.Querier) error {
+		_, err := q.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+		return err
+	})
+	if err != nil {
+		t.Errorf("InTx returns an error %v", err.Error())
+	}
+	_, err = m.GetUserByEmail(ctx, "lane@example.com")
+	if err != nil {
+		t.Errorf("user created in a committed transaction doesn't exist")
+	}
+}
@@ -0,0 +1,36 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	_ "github.com/lib/pq"
+)
+
+// Postgres is the Store backed by the sqlc generated queries.
+type Postgres struct {
+	*database.Queries
+	db *sql.DB
+}
+
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{
+		Queries: database.New(db),
+		db:      db,
+	}
+}
+
+func (p *Postgres) InTx(ctx context.Context, fn func(q database.Querier) error) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(p.Queries.WithTx(tx))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
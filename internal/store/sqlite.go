@@ -0,0 +1,654 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/sqlitedb"
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite"
+)
+
+// sqliteTimeFormat is how the SQLite schema stores timestamps, see sql/sqlite/schema.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000"
+
+// SQLite is the Store backed by the sqlc generated queries for the SQLite dialect. SQLite can't generate UUIDs,
+// so they are generated here, and the rows are converted to the database package types the handlers use.
+type SQLite struct {
+	sqliteQueries
+	db *sql.DB
+}
+
+// openSQLite opens the SQLite database file at path with foreign keys enforced.
+func openSQLite(path string) (*sql.DB, error) {
+	separator := "?"
+	if strings.Contains(path, "?") {
+		separator = "&"
+	}
+	db, err := sql.Open("sqlite", "file:"+path+separator+"_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer, one connection serializes writes instead of failing them with SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{
+		sqliteQueries: sqliteQueries{q: sqlitedb.New(db)},
+		db:            db,
+	}
+}
+
+func (s *SQLite) InTx(ctx context.Context, fn func(q database.Querier) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = fn(&sqliteQueries{q: s.q.WithTx(tx)})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// sqliteQueries adapts sqlitedb.Queries to database.Querier.
+type sqliteQueries struct {
+	q *sqlitedb.Queries
+}
+
+func sqliteTime(t sql.NullTime) sql.NullString {
+	if !t.Valid {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: t.Time.UTC().Format(sqliteTimeFormat), Valid: true}
+}
+
+func sqliteTimestamp(t time.Time) string {
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+func sqliteUUID(id uuid.NullUUID) sql.NullString {
+	if !id.Valid {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: id.UUID.String(), Valid: true}
+}
+
+func chirps(rows []sqlitedb.Chirp) []database.Chirp {
+	result := make([]database.Chirp, len(rows))
+	for i, row := range rows {
+		result[i] = database.Chirp(row)
+	}
+	return result
+}
+
+func (s *sqliteQueries) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	user, err := s.q.CreateUser(ctx, sqlitedb.CreateUserParams{
+		ID:             uuid.New(),
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+	})
+	return database.User(user), err
+}
+
+func (s *sqliteQueries) DeleteAllUsers(ctx context.Context) error {
+	return s.q.DeleteAllUsers(ctx)
+}
+
+func (s *sqliteQueries) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	user, err := s.q.GetUserByEmail(ctx, email)
+	return database.User(user), err
+}
+
+func (s *sqliteQueries) GetUserById(ctx context.Context, id uuid.UUID) (database.User, error) {
+	user, err := s.q.GetUserById(ctx, id)
+	return database.User(user), err
+}
+
+func (s *sqliteQueries) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	user, err := s.q.UpdateUser(ctx, sqlitedb.UpdateUserParams(arg))
+	return database.User(user), err
+}
+
+func (s *sqliteQueries) SetUserChirpyRed(ctx context.Context, arg database.SetUserChirpyRedParams) (int64, error) {
+	return s.q.SetUserChirpyRed(ctx, sqlitedb.SetUserChirpyRedParams{IsChirpyRed: arg.IsChirpyRed, ID: arg.ID})
+}
+
+func (s *sqliteQueries) VerifyUserEmail(ctx context.Context, arg database.VerifyUserEmailParams) (database.User, error) {
+	user, err := s.q.VerifyUserEmail(ctx, sqlitedb.VerifyUserEmailParams(arg))
+	return database.User(user), err
+}
+
+func (s *sqliteQueries) MarkVerificationSent(ctx context.Context, arg database.MarkVerificationSentParams) (int64, error) {
+	return s.q.MarkVerificationSent(ctx, sqlitedb.MarkVerificationSentParams{ID: arg.ID, SentBefore: sqliteTimestamp(arg.SentBefore)})
+}
+
+func (s *sqliteQueries) UpdateUserPassword(ctx context.Context, arg database.UpdateUserPasswordParams) error {
+	return s.q.UpdateUserPassword(ctx, sqlitedb.UpdateUserPasswordParams{HashedPassword: arg.HashedPassword, ID: arg.ID})
+}
+
+func (s *sqliteQueries) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	chirp, err := s.q.CreateChirp(ctx, sqlitedb.CreateChirpParams{
+		ID:        uuid.New(),
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		InReplyTo: arg.InReplyTo,
+	})
+	return database.Chirp(chirp), err
+}
+
+func (s *sqliteQueries) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	chirp, err := s.q.GetChirp(ctx, id)
+	return database.Chirp(chirp), err
+}
+
+func (s *sqliteQueries) DeleteChirp(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.DeleteChirp(ctx, id)
+}
+
+func (s *sqliteQueries) UpdateChirp(ctx context.Context, arg database.UpdateChirpParams) (database.Chirp, error) {
+	chirp, err := s.q.UpdateChirp(ctx, sqlitedb.UpdateChirpParams(arg))
+	return database.Chirp(chirp), err
+}
+
+func (s *sqliteQueries) TombstoneChirp(ctx context.Context, id uuid.UUID) error {
+	return s.q.TombstoneChirp(ctx, id)
+}
+
+func (s *sqliteQueries) ListChirpsAsc(ctx context.Context, arg database.ListChirpsAscParams) ([]database.Chirp, error) {
+	rows, err := s.q.ListChirpsAsc(ctx, sqlitedb.ListChirpsAscParams{
+		UserID:         sqliteUUID(arg.UserID),
+		AfterCreatedAt: sqliteTime(arg.AfterCreatedAt),
+		AfterID:        sqliteUUID(arg.AfterID),
+		Limit:          int64(arg.Limit),
+	})
+	return chirps(rows), err
+}
+
+func (s *sqliteQueries) ListChirpsDesc(ctx context.Context, arg database.ListChirpsDescParams) ([]database.Chirp, error) {
+	rows, err := s.q.ListChirpsDesc(ctx, sqlitedb.ListChirpsDescParams{
+		UserID:          sqliteUUID(arg.UserID),
+		BeforeCreatedAt: sqliteTime(arg.BeforeCreatedAt),
+		BeforeID:        sqliteUUID(arg.BeforeID),
+		Limit:           int64(arg.Limit),
+	})
+	return chirps(rows), err
+}
+
+func (s *sqliteQueries) ListChirpAncestors(ctx context.Context, id uuid.UUID) ([]database.ListChirpAncestorsRow, error) {
+	rows, err := s.q.ListChirpAncestors(ctx, id)
+	result := make([]database.ListChirpAncestorsRow, len(rows))
+	for i, row := range rows {
+		result[i] = database.ListChirpAncestorsRow(row)
+	}
+	return result, err
+}
+
+func (s *sqliteQueries) ListChirpDescendants(ctx context.Context, arg database.ListChirpDescendantsParams) ([]database.ListChirpDescendantsRow, error) {
+	rows, err := s.q.ListChirpDescendants(ctx, sqlitedb.ListChirpDescendantsParams{
+		ID:       arg.ID,
+		MaxRows:  int64(arg.MaxRows),
+		MaxDepth: int64(arg.MaxDepth),
+	})
+	result := make([]database.ListChirpDescendantsRow, len(rows))
+	for i, row := range rows {
+		result[i] = database.ListChirpDescendantsRow{
+			ID:        row.ID,
+			CreatedAt: row.CreatedAt,
+			UpdatedAt: row.UpdatedAt,
+			Body:      row.Body,
+			UserID:    row.UserID,
+			InReplyTo: row.InReplyTo,
+			DeletedAt: row.DeletedAt,
+			Depth:     int32(row.Depth),
+		}
+	}
+	return result, err
+}
+
+func (s *sqliteQueries) CreateChirpRevision(ctx context.Context, chirpID uuid.UUID) (database.ChirpRevision, error) {
+	revision, err := s.q.CreateChirpRevision(ctx, sqlitedb.CreateChirpRevisionParams{
+		ID:      uuid.New(),
+		ChirpID: chirpID,
+	})
+	return database.ChirpRevision(revision), err
+}
+
+func (s *sqliteQueries) ListChirpRevisions(ctx context.Context, chirpID uuid.UUID) ([]database.ChirpRevision, error) {
+	rows, err := s.q.ListChirpRevisions(ctx, chirpID)
+	result := make([]database.ChirpRevision, len(rows))
+	for i, row := range rows {
+		result[i] = database.ChirpRevision(row)
+	}
+	return result, err
+}
+
+func (s *sqliteQueries) DeleteChirpRevisions(ctx context.Context, chirpID uuid.UUID) error {
+	return s.q.DeleteChirpRevisions(ctx, chirpID)
+}
+
+func (s *sqliteQueries) FollowUser(ctx context.Context, arg database.FollowUserParams) error {
+	return s.q.FollowUser(ctx, sqlitedb.FollowUserParams(arg))
+}
+
+func (s *sqliteQueries) UnfollowUser(ctx context.Context, arg database.UnfollowUserParams) error {
+	return s.q.UnfollowUser(ctx, sqlitedb.UnfollowUserParams(arg))
+}
+
+func (s *sqliteQueries) ListFollowers(ctx context.Context, arg database.ListFollowersParams) ([]database.ListFollowersRow, error) {
+	rows, err := s.q.ListFollowers(ctx, sqlitedb.ListFollowersParams{
+		FolloweeID:     arg.FolloweeID,
+		AfterCreatedAt: sqliteTime(arg.AfterCreatedAt),
+		AfterID:        sqliteUUID(arg.AfterID),
+		Limit:          int64(arg.Limit),
+	})
+	result := make([]database.ListFollowersRow, len(rows))
+	for i, row := range rows {
+		result[i] = database.ListFollowersRow(row)
+	}
+	return result, err
+}
+
+func (s *sqliteQueries) ListFollowing(ctx context.Context, arg database.ListFollowingParams) ([]database.ListFollowingRow, error) {
+	rows, err := s.q.ListFollowing(ctx, sqlitedb.ListFollowingParams{
+		FollowerID:     arg.FollowerID,
+		AfterCreatedAt: sqliteTime(arg.AfterCreatedAt),
+		AfterID:        sqliteUUID(arg.AfterID),
+		Limit:          int64(arg.Limit),
+	})
+	result := make([]database.ListFollowingRow, len(rows))
+	for i, row := range rows {
+		result[i] = database.ListFollowingRow(row)
+	}
+	return result, err
+}
+
+func (s *sqliteQueries) ListTimeline(ctx context.Context, arg database.ListTimelineParams) ([]database.Chirp, error) {
+	rows, err := s.q.ListTimeline(ctx, sqlitedb.ListTimelineParams{
+		FollowerID:      arg.FollowerID,
+		BeforeCreatedAt: sqliteTime(arg.BeforeCreatedAt),
+		BeforeID:        sqliteUUID(arg.BeforeID),
+		Limit:           int64(arg.Limit),
+	})
+	return chirps(rows), err
+}
+
+func (s *sqliteQueries) RefreshToken(ctx context.Context, arg database.RefreshTokenParams) (database.RefreshToken, error) {
+	token, err := s.q.RefreshToken(ctx, sqlitedb.RefreshTokenParams(arg))
+	return database.RefreshToken(token), err
+}
+
+func (s *sqliteQueries) GetRefreshToken(ctx context.Context, tokenHash string) (database.RefreshToken, error) {
+	token, err := s.q.GetRefreshToken(ctx, tokenHash)
+	return database.RefreshToken(token), err
+}
+
+func (s *sqliteQueries) RevokeRefreshToken(ctx context.Context, tokenHash string) error {
+	return s.q.RevokeRefreshToken(ctx, tokenHash)
+}
+
+func (s *sqliteQueries) RevokeActiveRefreshToken(ctx context.Context, tokenHash string) (int64, error) {
+	return s.q.RevokeActiveRefreshToken(ctx, tokenHash)
+}
+
+func (s *sqliteQueries) RevokeRefreshTokenFamily(ctx context.Context, familyID uuid.UUID) error {
+	return s.q.RevokeRefreshTokenFamily(ctx, familyID)
+}
+
+func (s *sqliteQueries) RevokeUserRefreshTokens(ctx context.Context, userID uuid.UUID) error {
+	return s.q.RevokeUserRefreshTokens(ctx, userID)
+}
+
+func (s *sqliteQueries) CreatePasswordReset(ctx context.Context, arg database.CreatePasswordResetParams) (database.PasswordReset, error) {
+	reset, err := s.q.CreatePasswordReset(ctx, sqlitedb.CreatePasswordResetParams{
+		TokenHash: arg.TokenHash,
+		UserID:    arg.UserID,
+		ExpiresAt: sqliteTimestamp(arg.ExpiresAt),
+	})
+	return database.PasswordReset(reset), err
+}
+
+func (s *sqliteQueries) CountPasswordResetsSince(ctx context.Context, arg database.CountPasswordResetsSinceParams) (int64, error) {
+	return s.q.CountPasswordResetsSince(ctx, sqlitedb.CountPasswordResetsSinceParams{UserID: arg.UserID, Since: sqliteTimestamp(arg.Since)})
+}
+
+func (s *sqliteQueries) UsePasswordReset(ctx context.Context, arg database.UsePasswordResetParams) (database.PasswordReset, error) {
+	reset, err := s.q.UsePasswordReset(ctx, sqlitedb.UsePasswordResetParams{TokenHash: arg.TokenHash, Now: sqliteTimestamp(arg.Now)})
+	return database.PasswordReset(reset), err
+}
+
+func (s *sqliteQueries) InvalidatePasswordResets(ctx context.Context, userID uuid.UUID) error {
+	return s.q.InvalidatePasswordResets(ctx, userID)
+}
+
+func (s *sqliteQueries) CreateSubscription(ctx context.Context, arg database.CreateSubscriptionParams) (database.Subscription, error) {
+	subscription, err := s.q.CreateSubscription(ctx, sqlitedb.CreateSubscriptionParams{
+		ID:                 uuid.New(),
+		UserID:             arg.UserID,
+		CurrentPeriodStart: sqliteTimestamp(arg.CurrentPeriodStart),
+		CurrentPeriodEnd:   sqliteTimestamp(arg.CurrentPeriodEnd),
+	})
+	return database.Subscription(subscription), err
+}
+
+func (s *sqliteQueries) GetOpenSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	subscription, err := s.q.GetOpenSubscription(ctx, userID)
+	return database.Subscription(subscription), err
+}
+
+func (s *sqliteQueries) GetLatestSubscription(ctx context.Context, userID uuid.UUID) (database.Subscription, error) {
+	subscription, err := s.q.GetLatestSubscription(ctx, userID)
+	return database.Subscription(subscription), err
+}
+
+func (s *sqliteQueries) RenewSubscription(ctx context.Context, arg database.RenewSubscriptionParams) (database.Subscription, error) {
+	subscription, err := s.q.RenewSubscription(ctx, sqlitedb.RenewSubscriptionParams{
+		CurrentPeriodStart: sqliteTimestamp(arg.CurrentPeriodStart),
+		CurrentPeriodEnd:   sqliteTimestamp(arg.CurrentPeriodEnd),
+		ID:                 arg.ID,
+	})
+	return database.Subscription(subscription), err
+}
+
+func (s *sqliteQueries) MarkSubscriptionPastDue(ctx context.Context, id uuid.UUID) (database.Subscription, error) {
+	subscription, err := s.q.MarkSubscriptionPastDue(ctx, id)
+	return database.Subscription(subscription), err
+}
+
+func (s *sqliteQueries) CancelSubscription(ctx context.Context, id uuid.UUID) (database.Subscription, error) {
+	subscription, err := s.q.CancelSubscription(ctx, id)
+	return database.Subscription(subscription), err
+}
+
+func (s *sqliteQueries) ExpireSubscriptions(ctx context.Context, endedBefore time.Time) ([]database.Subscription, error) {
+	rows, err := s.q.ExpireSubscriptions(ctx, sqliteTimestamp(endedBefore))
+	subscriptions := make([]database.Subscription, len(rows))
+	for i, row := range rows {
+		subscriptions[i] = database.Subscription(row)
+	}
+	return subscriptions, err
+}
+
+func webhookEvent(row sqlitedb.WebhookEvent) database.WebhookEvent {
+	return database.WebhookEvent{
+		ID:          row.ID,
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
+		EventID:     row.EventID,
+		Event:       row.Event,
+		Payload:     row.Payload,
+		Status:      row.Status,
+		Attempts:    int32(row.Attempts),
+		LastError:   row.LastError,
+		ProcessedAt: row.ProcessedAt,
+	}
+}
+
+func (s *sqliteQueries) CreateWebhookEvent(ctx context.Context, arg database.CreateWebhookEventParams) (database.WebhookEvent, error) {
+	event, err := s.q.CreateWebhookEvent(ctx, sqlitedb.CreateWebhookEventParams{
+		ID:      uuid.New(),
+		EventID: arg.EventID,
+		Event:   arg.Event,
+		Payload: arg.Payload,
+	})
+	return webhookEvent(event), err
+}
+
+func (s *sqliteQueries) GetWebhookEvent(ctx context.Context, id uuid.UUID) (database.WebhookEvent, error) {
+	event, err := s.q.GetWebhookEvent(ctx, id)
+	return webhookEvent(event), err
+}
+
+func (s *sqliteQueries) GetWebhookEventByEventID(ctx context.Context, eventID string) (database.WebhookEvent, error) {
+	event, err := s.q.GetWebhookEventByEventID(ctx, eventID)
+	return webhookEvent(event), err
+}
+
+func (s *sqliteQueries) MarkWebhookEventProcessed(ctx context.Context, id uuid.UUID) (int64, error) {
+	return s.q.MarkWebhookEventProcessed(ctx, id)
+}
+
+func (s *sqliteQueries) MarkWebhookEventFailed(ctx context.Context, arg database.MarkWebhookEventFailedParams) error {
+	return s.q.MarkWebhookEventFailed(ctx, sqlitedb.MarkWebhookEventFailedParams{LastError: arg.LastError, ID: arg.ID})
+}
+
+func (s *sqliteQueries) ListWebhookEvents(ctx context.Context, arg database.ListWebhookEventsParams) ([]database.WebhookEvent, error) {
+	rows, err := s.q.ListWebhookEvents(ctx, sqlitedb.ListWebhookEventsParams{
+		Status:         arg.Status,
+		AfterCreatedAt: sqliteTime(arg.AfterCreatedAt),
+		AfterID:        sqliteUUID(arg.AfterID),
+		Limit:          int64(arg.Limit),
+	})
+	events := make([]database.WebhookEvent, len(rows))
+	for i, row := range rows {
+		events[i] = webhookEvent(row)
+	}
+	return events, err
+}
+
+func (s *sqliteQueries) CreateWebhookEndpoint(ctx context.Context, arg database.CreateWebhookEndpointParams) (database.WebhookEndpoint, error) {
+	endpoint, err := s.q.CreateWebhookEndpoint(ctx, sqlitedb.CreateWebhookEndpointParams{
+		ID:     uuid.New(),
+		UserID: arg.UserID,
+		Url:    arg.Url,
+		Secret: arg.Secret,
+		Events: arg.Events,
+	})
+	return database.WebhookEndpoint(endpoint), err
+}
+
+func (s *sqliteQueries) GetWebhookEndpoint(ctx context.Context, id uuid.UUID) (database.WebhookEndpoint, error) {
+	endpoint, err := s.q.GetWebhookEndpoint(ctx, id)
+	return database.WebhookEndpoint(endpoint), err
+}
+
+func webhookEndpoints(rows []sqlitedb.WebhookEndpoint) []database.WebhookEndpoint {
+	result := make([]database.WebhookEndpoint, len(rows))
+	for i, row := range rows {
+		result[i] = database.WebhookEndpoint(row)
+	}
+	return result
+}
+
+func (s *sqliteQueries) ListWebhookEndpoints(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookEndpoint, error) {
+	rows, err := s.q.ListWebhookEndpoints(ctx, sqliteUUID(userID))
+	return webhookEndpoints(rows), err
+}
+
+func (s *sqliteQueries) ListWebhookEndpointsForUser(ctx context.Context, userID uuid.NullUUID) ([]database.WebhookEndpoint, error) {
+	rows, err := s.q.ListWebhookEndpointsForUser(ctx, userID)
+	return webhookEndpoints(rows), err
+}
+
+func (s *sqliteQueries) DeleteWebhookEndpoint(ctx context.Context, id uuid.UUID) error {
+	return s.q.DeleteWebhookEndpoint(ctx, id)
+}
+
+func webhookDelivery(row sqlitedb.WebhookDelivery) database.WebhookDelivery {
+	return database.WebhookDelivery{
+		ID:            row.ID,
+		CreatedAt:     row.CreatedAt,
+		UpdatedAt:     row.UpdatedAt,
+		EndpointID:    row.EndpointID,
+		Event:         row.Event,
+		Payload:       row.Payload,
+		Status:        row.Status,
+		Attempts:      int32(row.Attempts),
+		NextAttemptAt: row.NextAttemptAt,
+		LastAttemptAt: row.LastAttemptAt,
+	}
+}
+
+func webhookDeliveries(rows []sqlitedb.WebhookDelivery) []database.WebhookDelivery {
+	result := make([]database.WebhookDelivery, len(rows))
+	for i, row := range rows {
+		result[i] = webhookDelivery(row)
+	}
+	return result
+}
+
+func (s *sqliteQueries) CreateWebhookDelivery(ctx context.Context, arg database.CreateWebhookDeliveryParams) (database.WebhookDelivery, error) {
+	delivery, err := s.q.CreateWebhookDelivery(ctx, sqlitedb.CreateWebhookDeliveryParams{
+		ID:            uuid.New(),
+		EndpointID:    arg.EndpointID,
+		Event:         arg.Event,
+		Payload:       arg.Payload,
+		NextAttemptAt: sqliteTimestamp(arg.NextAttemptAt),
+	})
+	return webhookDelivery(delivery), err
+}
+
+func (s *sqliteQueries) GetWebhookDelivery(ctx context.Context, id uuid.UUID) (database.WebhookDelivery, error) {
+	delivery, err := s.q.GetWebhookDelivery(ctx, id)
+	return webhookDelivery(delivery), err
+}
+
+func (s *sqliteQueries) ClaimWebhookDeliveries(ctx context.Context, arg database.ClaimWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	rows, err := s.q.ClaimWebhookDeliveries(ctx, sqlitedb.ClaimWebhookDeliveriesParams{
+		LeaseUntil: sqliteTimestamp(arg.LeaseUntil),
+		Now:        sqliteTimestamp(arg.Now),
+		Limit:      int64(arg.Limit),
+	})
+	return webhookDeliveries(rows), err
+}
+
+func (s *sqliteQueries) UpdateWebhookDeliveryAttempt(ctx context.Context, arg database.UpdateWebhookDeliveryAttemptParams) (database.WebhookDelivery, error) {
+	delivery, err := s.q.UpdateWebhookDeliveryAttempt(ctx, sqlitedb.UpdateWebhookDeliveryAttemptParams{
+		Status:        arg.Status,
+		NextAttemptAt: sqliteTimestamp(arg.NextAttemptAt),
+		ID:            arg.ID,
+	})
+	return webhookDelivery(delivery), err
+}
+
+func (s *sqliteQueries) ListWebhookDeliveries(ctx context.Context, arg database.ListWebhookDeliveriesParams) ([]database.WebhookDelivery, error) {
+	rows, err := s.q.ListWebhookDeliveries(ctx, sqlitedb.ListWebhookDeliveriesParams{
+		EndpointID:      arg.EndpointID,
+		BeforeCreatedAt: sqliteTime(arg.BeforeCreatedAt),
+		BeforeID:        sqliteUUID(arg.BeforeID),
+		Limit:           int64(arg.Limit),
+	})
+	return webhookDeliveries(rows), err
+}
+
+func webhookDeliveryAttempt(row sqlitedb.WebhookDeliveryAttempt) database.WebhookDeliveryAttempt {
+	attempt := database.WebhookDeliveryAttempt{
+		ID:         row.ID,
+		CreatedAt:  row.CreatedAt,
+		DeliveryID: row.DeliveryID,
+		Attempt:    int32(row.Attempt),
+		Error:      row.Error,
+		DurationMs: int32(row.DurationMs),
+	}
+	if row.StatusCode.Valid {
+		attempt.StatusCode = sql.NullInt32{Int32: int32(row.StatusCode.Int64), Valid: true}
+	}
+	return attempt
+}
+
+func (s *sqliteQueries) CreateWebhookDeliveryAttempt(ctx context.Context, arg database.CreateWebhookDeliveryAttemptParams) (database.WebhookDeliveryAttempt, error) {
+	attempt, err := s.q.CreateWebhookDeliveryAttempt(ctx, sqlitedb.CreateWebhookDeliveryAttemptParams{
+		ID:         uuid.New(),
+		DeliveryID: arg.DeliveryID,
+		Attempt:    int64(arg.Attempt),
+		StatusCode: sql.NullInt64{Int64: int64(arg.StatusCode.Int32), Valid: arg.StatusCode.Valid},
+		Error:      arg.Error,
+		DurationMs: int64(arg.DurationMs),
+	})
+	return webhookDeliveryAttempt(attempt), err
+}
+
+func (s *sqliteQueries) ListWebhookDeliveryAttempts(ctx context.Context, deliveryID uuid.UUID) ([]database.WebhookDeliveryAttempt, error) {
+	rows, err := s.q.ListWebhookDeliveryAttempts(ctx, deliveryID)
+	attempts := make([]database.WebhookDeliveryAttempt, len(rows))
+	for i, row := range rows {
+		attempts[i] = webhookDeliveryAttempt(row)
+	}
+	return attempts, err
+}
+
+func totpSecret(row sqlitedb.TotpSecret) database.TotpSecret {
+	return database.TotpSecret{
+		UserID:         row.UserID,
+		CreatedAt:      row.CreatedAt,
+		UpdatedAt:      row.UpdatedAt,
+		Secret:         row.Secret,
+		EnabledAt:      row.EnabledAt,
+		LastUsedStep:   row.LastUsedStep,
+		FailedAttempts: int32(row.FailedAttempts),
+		LockedUntil:    row.LockedUntil,
+	}
+}
+
+func (s *sqliteQueries) UpsertTOTPSecret(ctx context.Context, arg database.UpsertTOTPSecretParams) (database.TotpSecret, error) {
+	secret, err := s.q.UpsertTOTPSecret(ctx, sqlitedb.UpsertTOTPSecretParams(arg))
+	return totpSecret(secret), err
+}
+
+func (s *sqliteQueries) GetTOTPSecret(ctx context.Context, userID uuid.UUID) (database.TotpSecret, error) {
+	secret, err := s.q.GetTOTPSecret(ctx, userID)
+	return totpSecret(secret), err
+}
+
+func (s *sqliteQueries) EnableTOTP(ctx context.Context, arg database.EnableTOTPParams) (int64, error) {
+	return s.q.EnableTOTP(ctx, sqlitedb.EnableTOTPParams{Step: arg.Step, UserID: arg.UserID})
+}
+
+func (s *sqliteQueries) UseTOTPStep(ctx context.Context, arg database.UseTOTPStepParams) (int64, error) {
+	return s.q.UseTOTPStep(ctx, sqlitedb.UseTOTPStepParams{
+		Step:   arg.Step,
+		UserID: arg.UserID,
+		Now:    sqliteTimestamp(arg.Now),
+	})
+}
+
+func (s *sqliteQueries) ClearTOTPFailures(ctx context.Context, userID uuid.UUID) error {
+	return s.q.ClearTOTPFailures(ctx, userID)
+}
+
+func (s *sqliteQueries) StartTOTPAttempt(ctx context.Context, arg database.StartTOTPAttemptParams) (int64, error) {
+	return s.q.StartTOTPAttempt(ctx, sqlitedb.StartTOTPAttemptParams{
+		MaxAttempts: int64(arg.MaxAttempts),
+		UserID:      arg.UserID,
+		Now:         sqliteTimestamp(arg.Now),
+		StaleBefore: sqliteTimestamp(arg.StaleBefore),
+	})
+}
+
+func (s *sqliteQueries) RecordTOTPFailure(ctx context.Context, arg database.RecordTOTPFailureParams) (database.TotpSecret, error) {
+	secret, err := s.q.RecordTOTPFailure(ctx, sqlitedb.RecordTOTPFailureParams{
+		MaxAttempts: int64(arg.MaxAttempts),
+		LockUntil:   sqliteTimestamp(arg.LockUntil),
+		UserID:      arg.UserID,
+	})
+	return totpSecret(secret), err
+}
+
+func (s *sqliteQueries) DeleteTOTPSecret(ctx context.Context, userID uuid.UUID) error {
+	return s.q.DeleteTOTPSecret(ctx, userID)
+}
+
+func (s *sqliteQueries) CreateRecoveryCode(ctx context.Context, arg database.CreateRecoveryCodeParams) error {
+	return s.q.CreateRecoveryCode(ctx, sqlitedb.CreateRecoveryCodeParams(arg))
+}
+
+func (s *sqliteQueries) UseRecoveryCode(ctx context.Context, arg database.UseRecoveryCodeParams) (int64, error) {
+	return s.q.UseRecoveryCode(ctx, sqlitedb.UseRecoveryCodeParams{
+		UserID:   arg.UserID,
+		CodeHash: arg.CodeHash,
+		Now:      sqliteTimestamp(arg.Now),
+	})
+}
+
+func (s *sqliteQueries) DeleteRecoveryCodes(ctx context.Context, userID uuid.UUID) error {
+	return s.q.DeleteRecoveryCodes(ctx, userID)
+}
+
+var _ Store = (*SQLite)(nil)
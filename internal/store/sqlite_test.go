@@ -0,0 +1,510 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// newTestSQLite opens a SQLite file in a temporary directory and applies the Up sections of sql/sqlite/schema.
+func newTestSQLite(t *testing.T) *SQLite {
+	t.Helper()
+	db, err := openSQLite(filepath.Join(t.TempDir(), "chirpy.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	s := NewSQLite(db)
+
+	files, err := filepath.Glob("../../sql/sqlite/schema/*.sql")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no SQLite schema files: %v", err)
+	}
+	for _, file := range files {
+		dat, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(dat), "-- +goose Down")
+		_, err = s.db.Exec(up)
+		if err != nil {
+			t.Fatalf("%v: %v", file, err)
+		}
+	}
+	return s
+}
+
+func TestSQLiteUsers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	user, err := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com", HashedPassword: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser returns an error %v", err.Error())
+	}
+	_, err = s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com", HashedPassword: "hash"})
+	if !IsUniqueViolation(err) {
+		t.Errorf("CreateUser of a duplicate email returns %v", err)
+	}
+
+	found, err := s.GetUserByEmail(ctx, "lane@example.com")
+	if err != nil || found.ID != user.ID || !found.CreatedAt.Equal(user.CreatedAt) {
+		t.Errorf("GetUserByEmail returns %v, %v", found, err)
+	}
+	_, err = s.GetUserById(ctx, uuid.New())
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("%v != %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestSQLiteListChirpsPagination(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+	created := []database.Chirp{}
+	for i := 0; i < 5; i++ {
+		chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{Body: "chirp", UserID: user.ID})
+		if err != nil {
+			t.Fatalf("CreateChirp returns an error %v", err.Error())
+		}
+		created = append(created, chirp)
+	}
+
+	// Chirps created within the same millisecond share created_at, the id has to break the tie.
+	seen := make(map[uuid.UUID]bool)
+	arg := database.ListChirpsDescParams{Limit: 2, UserID: uuid.NullUUID{UUID: user.ID, Valid: true}}
+	for {
+		page, err := s.ListChirpsDesc(ctx, arg)
+		if err != nil {
+			t.Fatalf("ListChirpsDesc returns an error %v", err.Error())
+		}
+		if len(page) == 0 {
+			break
+		}
+		for _, c := range page {
+			if seen[c.ID] {
+				t.Errorf("chirp %v returned twice", c.ID)
+			}
+			seen[c.ID] = true
+		}
+		last := page[len(page)-1]
+		arg.BeforeCreatedAt = sql.NullTime{Time: last.CreatedAt, Valid: true}
+		arg.BeforeID = uuid.NullUUID{UUID: last.ID, Valid: true}
+	}
+	if len(seen) != len(created) {
+		t.Errorf("%v != %v", len(seen), len(created))
+	}
+}
+
+func TestSQLiteThread(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+	root, _ := s.CreateChirp(ctx, database.CreateChirpParams{Body: "root", UserID: user.ID})
+	reply, _ := s.CreateChirp(ctx, database.CreateChirpParams{Body: "reply", UserID: user.ID, InReplyTo: uuid.NullUUID{UUID: root.ID, Valid: true}})
+	nested, _ := s.CreateChirp(ctx, database.CreateChirpParams{Body: "nested", UserID: user.ID, InReplyTo: uuid.NullUUID{UUID: reply.ID, Valid: true}})
+
+	ancestors, err := s.ListChirpAncestors(ctx, nested.ID)
+	if err != nil || len(ancestors) != 2 || ancestors[0].ID != root.ID || ancestors[1].ID != reply.ID {
+		t.Errorf("ListChirpAncestors returns %v, %v", ancestors, err)
+	}
+	descendants, err := s.ListChirpDescendants(ctx, database.ListChirpDescendantsParams{ID: root.ID, MaxDepth: 1, MaxRows: 10})
+	if err != nil || len(descendants) != 2 || descendants[1].ID != reply.ID || descendants[1].Depth != 1 {
+		t.Errorf("ListChirpDescendants returns %v, %v", descendants, err)
+	}
+
+	for _, c := range []struct {
+		id       uuid.UUID
+		expected int64
+	}{
+		{reply.ID, 0},
+		{nested.ID, 1},
+		{reply.ID, 1},
+	} {
+		deleted, err := s.DeleteChirp(ctx, c.id)
+		if err != nil || deleted != c.expected {
+			t.Errorf("DeleteChirp returns %v, %v", deleted, err)
+		}
+	}
+}
+
+func TestSQLiteChirpRevisions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+	chirp, _ := s.CreateChirp(ctx, database.CreateChirpParams{Body: "first", UserID: user.ID})
+	s.UpdateChirp(ctx, database.UpdateChirpParams{Body: "second", ID: chirp.ID})
+
+	revision, err := s.CreateChirpRevision(ctx, chirp.ID)
+	if err != nil || revision.ChirpID != chirp.ID || revision.Body != "second" {
+		t.Errorf("CreateChirpRevision returns %v, %v", revision, err)
+	}
+	_, err = s.CreateChirpRevision(ctx, uuid.New())
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("CreateChirpRevision of a missing chirp: %v != %v", err, sql.ErrNoRows)
+	}
+
+	s.TombstoneChirp(ctx, chirp.ID)
+	_, err = s.CreateChirpRevision(ctx, chirp.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("CreateChirpRevision of a deleted chirp: %v != %v", err, sql.ErrNoRows)
+	}
+	_, err = s.UpdateChirp(ctx, database.UpdateChirpParams{Body: "third", ID: chirp.ID})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateChirp of a deleted chirp: %v != %v", err, sql.ErrNoRows)
+	}
+}
+
+func TestSQLiteSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+	start := time.Date(2026, 1, 31, 12, 0, 0, 0, time.UTC)
+	created, err := s.CreateSubscription(ctx, database.CreateSubscriptionParams{
+		UserID:             user.ID,
+		CurrentPeriodStart: start,
+		CurrentPeriodEnd:   start.AddDate(0, 0, 30),
+	})
+	if err != nil || created.Status != "active" || !created.CurrentPeriodEnd.Equal(start.AddDate(0, 0, 30)) {
+		t.Fatalf("CreateSubscription returns %v, %v", created, err)
+	}
+	_, err = s.CreateSubscription(ctx, database.CreateSubscriptionParams{UserID: user.ID, CurrentPeriodStart: start, CurrentPeriodEnd: start})
+	if err == nil {
+		t.Errorf("CreateSubscription opens a second subscription")
+	}
+
+	pastDue, err := s.MarkSubscriptionPastDue(ctx, created.ID)
+	if err != nil || pastDue.Status != "past_due" {
+		t.Errorf("MarkSubscriptionPastDue returns %v, %v", pastDue, err)
+	}
+	open, err := s.GetOpenSubscription(ctx, user.ID)
+	if err != nil || open.ID != created.ID {
+		t.Errorf("GetOpenSubscription returns %v, %v", open, err)
+	}
+
+	// Periods are compared as text, the cutoff has to be formatted the same way.
+	expired, err := s.ExpireSubscriptions(ctx, start.AddDate(0, 0, 30))
+	if err != nil || len(expired) != 0 {
+		t.Errorf("ExpireSubscriptions at the end of the period returns %v, %v", expired, err)
+	}
+	expired, err = s.ExpireSubscriptions(ctx, start.AddDate(0, 0, 30).Add(time.Millisecond))
+	if err != nil || len(expired) != 1 || expired[0].Status != "expired" || !expired[0].EndedAt.Valid {
+		t.Errorf("ExpireSubscriptions after the period returns %v, %v", expired, err)
+	}
+	_, err = s.GetOpenSubscription(ctx, user.ID)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("%v != %v", err, sql.ErrNoRows)
+	}
+	latest, err := s.GetLatestSubscription(ctx, user.ID)
+	if err != nil || latest.ID != created.ID {
+		t.Errorf("GetLatestSubscription returns %v, %v", latest, err)
+	}
+
+	updated, err := s.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{ID: uuid.New(), IsChirpyRed: true})
+	if err != nil || updated != 0 {
+		t.Errorf("SetUserChirpyRed of an unknown user returns %v, %v", updated, err)
+	}
+}
+
+func TestSQLiteWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+
+	arg := database.CreateWebhookEventParams{EventID: "evt_1", Event: "user.upgraded", Payload: `{"id":"evt_1"}`}
+	event, err := s.CreateWebhookEvent(ctx, arg)
+	if err != nil || event.Status != "pending" || event.Attempts != 0 {
+		t.Fatalf("CreateWebhookEvent returns %v, %v", event, err)
+	}
+	_, err = s.CreateWebhookEvent(ctx, arg)
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("CreateWebhookEvent of a known event id: %v != %v", err, sql.ErrNoRows)
+	}
+
+	err = s.MarkWebhookEventFailed(ctx, database.MarkWebhookEventFailedParams{ID: event.ID, LastError: sql.NullString{String: "boom", Valid: true}})
+	if err != nil {
+		t.Fatalf("MarkWebhookEventFailed returns an error %v", err.Error())
+	}
+	failed, err := s.ListWebhookEvents(ctx, database.ListWebhookEventsParams{Status: "failed", Limit: 10})
+	if err != nil || len(failed) != 1 || failed[0].Attempts != 1 || failed[0].LastError.String != "boom" {
+		t.Errorf("ListWebhookEvents returns %v, %v", failed, err)
+	}
+
+	for _, expected := range []int64{1, 0} {
+		marked, err := s.MarkWebhookEventProcessed(ctx, event.ID)
+		if err != nil || marked != expected {
+			t.Errorf("MarkWebhookEventProcessed returns %v, %v", marked, err)
+		}
+	}
+	processed, err := s.GetWebhookEventByEventID(ctx, "evt_1")
+	if err != nil || processed.Status != "processed" || processed.Attempts != 2 || processed.LastError.Valid || !processed.ProcessedAt.Valid {
+		t.Errorf("GetWebhookEventByEventID returns %v, %v", processed, err)
+	}
+}
+
+func TestSQLiteWebhookDeliveries(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	now := time.Now().UTC()
+
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+	owner := uuid.NullUUID{UUID: user.ID, Valid: true}
+	endpoint, err := s.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{UserID: owner, Url: "https://example.com/hook", Secret: "whsec_1", Events: "chirp.created"})
+	if err != nil {
+		t.Fatalf("CreateWebhookEndpoint returns an error %v", err.Error())
+	}
+	admin, _ := s.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{Url: "https://example.com/admin", Secret: "whsec_2", Events: "chirp.deleted"})
+
+	cases := []struct {
+		owner uuid.NullUUID
+		id    uuid.UUID
+	}{
+		{owner, endpoint.ID},
+		{uuid.NullUUID{}, admin.ID},
+	}
+	for _, c := range cases {
+		endpoints, err := s.ListWebhookEndpoints(ctx, c.owner)
+		if err != nil || len(endpoints) != 1 || endpoints[0].ID != c.id {
+			t.Errorf("ListWebhookEndpoints(%v) returns %v, %v", c.owner, endpoints, err)
+		}
+	}
+	endpoints, err := s.ListWebhookEndpointsForUser(ctx, owner)
+	if err != nil || len(endpoints) != 2 {
+		t.Errorf("ListWebhookEndpointsForUser returns %v, %v", endpoints, err)
+	}
+
+	delivery, err := s.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{EndpointID: endpoint.ID, Event: "chirp.created", Payload: "{}", NextAttemptAt: now})
+	if err != nil || delivery.Status != "pending" {
+		t.Fatalf("CreateWebhookDelivery returns %v, %v", delivery, err)
+	}
+	for _, expected := range []int{1, 0} {
+		claimed, err := s.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{Now: now, LeaseUntil: now.Add(time.Minute), Limit: 10})
+		if err != nil || len(claimed) != expected {
+			t.Errorf("ClaimWebhookDeliveries returns %v, %v", claimed, err)
+		}
+	}
+
+	_, err = s.CreateWebhookDeliveryAttempt(ctx, database.CreateWebhookDeliveryAttemptParams{DeliveryID: delivery.ID, Attempt: 1, StatusCode: sql.NullInt32{Int32: 500, Valid: true}, DurationMs: 12})
+	if err != nil {
+		t.Fatalf("CreateWebhookDeliveryAttempt returns an error %v", err.Error())
+	}
+	retried, err := s.UpdateWebhookDeliveryAttempt(ctx, database.UpdateWebhookDeliveryAttemptParams{ID: delivery.ID, Status: "pending", NextAttemptAt: now.Add(time.Hour)})
+	if err != nil || retried.Attempts != 1 || !retried.LastAttemptAt.Valid || !retried.NextAttemptAt.Equal(now.Add(time.Hour).Truncate(time.Millisecond)) {
+		t.Errorf("UpdateWebhookDeliveryAttempt returns %v, %v", retried, err)
+	}
+	attempts, err := s.ListWebhookDeliveryAttempts(ctx, delivery.ID)
+	if err != nil || len(attempts) != 1 || attempts[0].StatusCode.Int32 != 500 {
+		t.Errorf("ListWebhookDeliveryAttempts returns %v, %v", attempts, err)
+	}
+
+	// Deleting the endpoint deletes its deliveries and their attempts.
+	err = s.DeleteWebhookEndpoint(ctx, endpoint.ID)
+	if err != nil {
+		t.Fatalf("DeleteWebhookEndpoint returns an error %v", err.Error())
+	}
+	deliveries, err := s.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{EndpointID: endpoint.ID, Limit: 10})
+	if err != nil || len(deliveries) != 0 {
+		t.Errorf("ListWebhookDeliveries returns %v, %v", deliveries, err)
+	}
+}
+
+func TestSQLiteEmailVerification(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+
+	for _, expected := range []int64{1, 0} {
+		marked, err := s.MarkVerificationSent(ctx, database.MarkVerificationSentParams{ID: user.ID, SentBefore: time.Now().Add(-time.Minute)})
+		if err != nil || marked != expected {
+			t.Errorf("MarkVerificationSent returns %v, %v", marked, err)
+		}
+	}
+
+	_, err := s.VerifyUserEmail(ctx, database.VerifyUserEmailParams{ID: user.ID, Email: "saul@example.com"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("VerifyUserEmail of another email: %v != %v", err, sql.ErrNoRows)
+	}
+	verified, err := s.VerifyUserEmail(ctx, database.VerifyUserEmailParams{ID: user.ID, Email: "lane@example.com"})
+	if err != nil || !verified.EmailVerifiedAt.Valid {
+		t.Fatalf("VerifyUserEmail returns %v, %v", verified, err)
+	}
+
+	cases := []struct {
+		email    string
+		verified bool
+	}{
+		{"lane@example.com", true},
+		{"lane@chirpy.example", false},
+	}
+	for _, c := range cases {
+		updated, err := s.UpdateUser(ctx, database.UpdateUserParams{ID: user.ID, Email: c.email})
+		if err != nil || updated.EmailVerifiedAt.Valid != c.verified || updated.VerificationSentAt.Valid != c.verified {
+			t.Errorf("UpdateUser to %v returns %v, %v", c.email, updated, err)
+		}
+	}
+}
+
+func TestSQLitePasswordResets(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+	now := time.Now()
+
+	for _, hash := range []string{"first", "second", "expired"} {
+		expiresAt := now.Add(time.Hour)
+		if hash == "expired" {
+			expiresAt = now.Add(-time.Second)
+		}
+		_, err := s.CreatePasswordReset(ctx, database.CreatePasswordResetParams{TokenHash: hash, UserID: user.ID, ExpiresAt: expiresAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := s.CountPasswordResetsSince(ctx, database.CountPasswordResetsSinceParams{UserID: user.ID, Since: now.Add(-time.Minute)})
+	if err != nil || count != 3 {
+		t.Errorf("CountPasswordResetsSince returns %v, %v", count, err)
+	}
+
+	_, err = s.UsePasswordReset(ctx, database.UsePasswordResetParams{TokenHash: "first", Now: now})
+	if err != nil {
+		t.Fatalf("UsePasswordReset: %v", err)
+	}
+	err = s.InvalidatePasswordResets(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range []string{"first", "second", "expired", "unknown"} {
+		_, err := s.UsePasswordReset(ctx, database.UsePasswordResetParams{TokenHash: hash, Now: now})
+		if !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("UsePasswordReset of %v: %v != %v", hash, err, sql.ErrNoRows)
+		}
+	}
+
+	token, _ := s.RefreshToken(ctx, database.RefreshTokenParams{TokenHash: "refresh", UserID: user.ID, FamilyID: uuid.New()})
+	err = s.RevokeUserRefreshTokens(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err = s.GetRefreshToken(ctx, token.TokenHash)
+	if err != nil || !token.RevokedAt.Valid {
+		t.Errorf("RevokeUserRefreshTokens leaves %v, %v", token, err)
+	}
+}
+
+func TestSQLiteTOTP(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	user, _ := s.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+
+	_, err := s.UpsertTOTPSecret(ctx, database.UpsertTOTPSecretParams{UserID: user.ID, Secret: "FIRST"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := s.UpsertTOTPSecret(ctx, database.UpsertTOTPSecretParams{UserID: user.ID, Secret: "SECOND"})
+	if err != nil || secret.Secret != "SECOND" {
+		t.Errorf("enrolling again returns %v, %v", secret, err)
+	}
+	enabled, err := s.EnableTOTP(ctx, database.EnableTOTPParams{UserID: user.ID, Step: 10})
+	if err != nil || enabled != 1 {
+		t.Fatalf("EnableTOTP returns %v, %v", enabled, err)
+	}
+	_, err = s.UpsertTOTPSecret(ctx, database.UpsertTOTPSecretParams{UserID: user.ID, Secret: "THIRD"})
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("enrolling when enabled: %v != %v", err, sql.ErrNoRows)
+	}
+
+	now := time.Now().UTC()
+	steps := []struct {
+		step     int64
+		expected int64
+	}{
+		{10, 0},
+		{11, 1},
+		{11, 0},
+		{9, 0},
+	}
+	for _, c := range steps {
+		used, err := s.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: user.ID, Step: c.step, Now: now})
+		if err != nil || used != c.expected {
+			t.Errorf("UseTOTPStep(%v) returns %v, %v", c.step, used, err)
+		}
+	}
+
+	start := database.StartTOTPAttemptParams{UserID: user.ID, MaxAttempts: 3, Now: now, StaleBefore: now.Add(-time.Hour)}
+	for _, expected := range []int64{1, 1, 1, 0} {
+		started, err := s.StartTOTPAttempt(ctx, start)
+		if err != nil || started != expected {
+			t.Errorf("StartTOTPAttempt returns %v, %v", started, err)
+		}
+	}
+	lockUntil := now.Add(time.Hour).Truncate(time.Millisecond)
+	secret, err = s.RecordTOTPFailure(ctx, database.RecordTOTPFailureParams{UserID: user.ID, MaxAttempts: 3, LockUntil: lockUntil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if secret.FailedAttempts != 0 || !secret.LockedUntil.Valid || !secret.LockedUntil.Time.Equal(lockUntil) {
+		t.Errorf("third failure leaves %v failures, locked until %v", secret.FailedAttempts, secret.LockedUntil)
+	}
+	started, err := s.StartTOTPAttempt(ctx, start)
+	if err != nil || started != 0 {
+		t.Errorf("StartTOTPAttempt when locked returns %v, %v", started, err)
+	}
+	used, err := s.UseTOTPStep(ctx, database.UseTOTPStepParams{UserID: user.ID, Step: 12, Now: now})
+	if err != nil || used != 0 {
+		t.Errorf("UseTOTPStep when locked returns %v, %v", used, err)
+	}
+
+	s.CreateRecoveryCode(ctx, database.CreateRecoveryCodeParams{CodeHash: "code", UserID: user.ID})
+	used, err = s.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{UserID: user.ID, CodeHash: "code", Now: now})
+	if err != nil || used != 0 {
+		t.Errorf("UseRecoveryCode when locked returns %v, %v", used, err)
+	}
+
+	later := lockUntil.Add(time.Second)
+	for i := 0; i < 3; i++ {
+		s.StartTOTPAttempt(ctx, database.StartTOTPAttemptParams{UserID: user.ID, MaxAttempts: 3, Now: later, StaleBefore: now})
+	}
+	started, err = s.StartTOTPAttempt(ctx, database.StartTOTPAttemptParams{UserID: user.ID, MaxAttempts: 3, Now: later, StaleBefore: later})
+	if err != nil || started != 1 {
+		t.Errorf("StartTOTPAttempt with stale attempts returns %v, %v", started, err)
+	}
+	for _, expected := range []int64{1, 0} {
+		used, err := s.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{UserID: user.ID, CodeHash: "code", Now: later})
+		if err != nil || used != expected {
+			t.Errorf("UseRecoveryCode returns %v, %v", used, err)
+		}
+	}
+}
+
+func TestSQLiteInTxRollback(t *testing.T) {
+	ctx := context.Background()
+	s := newTestSQLite(t)
+	errAbort := errors.New("abort")
+
+	err := s.InTx(ctx, func(q database.Querier) error {
+		_, err := q.CreateUser(ctx, database.CreateUserParams{Email: "lane@example.com"})
+		if err != nil {
+			return err
+		}
+		return errAbort
+	})
+	if !errors.Is(err, errAbort) {
+		t.Errorf("%v != %v", err, errAbort)
+	}
+	_, err = s.GetUserByEmail(ctx, "lane@example.com")
+	if !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("user created in a rolled back transaction exists")
+	}
+}
@@ -0,0 +1,70 @@
+// Package store hides where Chirpy keeps its data. Handlers talk to a Store, which is either Postgres or SQLite (through the
+// sqlc generated queries) or an in-memory implementation for tests and local development without a database.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+type Store interface {
+	database.Querier
+	// InTx runs fn in a transaction. If fn returns an error, nothing fn did is kept.
+	InTx(ctx context.Context, fn func(q database.Querier) error) error
+}
+
+// Dialect is the SQL database a Store runs on, it picks the sqlc generated queries and the migrations.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectSQLite   Dialect = "sqlite"
+)
+
+// OpenDB opens the database dbURL points to: sqlite://<path> is a SQLite file and anything else is a Postgres
+// connection string. memory:// has no database, db is nil.
+func OpenDB(dbURL string) (db *sql.DB, dialect Dialect, err error) {
+	switch {
+	case dbURL == "memory://":
+		return nil, "", nil
+	case strings.HasPrefix(dbURL, "sqlite://"):
+		db, err = openSQLite(strings.TrimPrefix(dbURL, "sqlite://"))
+		return db, DialectSQLite, err
+	default:
+		db, err = sql.Open("postgres", dbURL)
+		return db, DialectPostgres, err
+	}
+}
+
+// IsUniqueViolation reports whether err is a store refusing a row because it duplicates a unique column, like the
+// email of another user.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+	}
+	return errors.Is(err, errDuplicateEmail) || errors.Is(err, errOpenSubscription)
+}
+
+// New returns the Store for a database opened by OpenDB. Without a database, it is the in-memory store.
+func New(db *sql.DB, dialect Dialect) Store {
+	switch {
+	case db == nil:
+		return NewMemory()
+	case dialect == DialectSQLite:
+		return NewSQLite(db)
+	default:
+		return NewPostgres(db)
+	}
+}
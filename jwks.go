@@ -0,0 +1,12 @@
+package main
+
+import (
+	"net/http"
+)
+
+// GET /.well-known/jwks.json publishes the public keys access tokens are signed with, so other services can verify them.
+// It contains the current signing key and the keys still accepted for verification while they are being rotated out.
+func (cfg *apiConfig) jwks(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJson(w, http.StatusOK, cfg.jwtKeys.JWKS())
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/metrics"
+	"github.com/google/uuid"
+)
+
+const (
+	requestIDHeader    = "X-Request-ID"
+	maxRequestIDLength = 128
+)
+
+// requestInfo is what the access log knows about a request. The context holds a pointer, so requireAuth, which only
+// sees a derived request, can fill in the user.
+type requestInfo struct {
+	ID     string
+	UserId uuid.UUID
+}
+
+// logRequests honours the X-Request-ID header of the client or generates one, echoes it in the response and writes
+// one access log line per request.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		info := &requestInfo{ID: r.Header.Get(requestIDHeader)}
+		if !validRequestID(info.ID) {
+			info.ID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, info.ID)
+
+		recorder := metrics.RecordResponse(w)
+		r = r.WithContext(context.WithValue(r.Context(), requestInfoKey, info))
+		next.ServeHTTP(recorder, r)
+
+		attrs := []any{
+			"request_id", info.ID,
+			"method", r.Method,
+			"pattern", r.Pattern,
+			"path", r.URL.Path,
+			"status", recorder.Status(),
+			"bytes", recorder.Bytes(),
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		}
+		if info.UserId != uuid.Nil {
+			attrs = append(attrs, "user_id", info.UserId)
+		}
+		slog.Info("request", attrs...)
+	})
+}
+
+// validRequestID accepts ids of letters, digits and -_.: only, so a client can't inject anything into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		isLetter := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		isDigit := c >= '0' && c <= '9'
+		if !isLetter && !isDigit && c != '-' && c != '_' && c != '.' && c != ':' {
+			return false
+		}
+	}
+	return true
+}
+
+func requestInfoFromContext(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey).(*requestInfo)
+	return info
+}
+
+// requestID returns the id logRequests gave to the request, or "" outside of it.
+func requestID(r *http.Request) string {
+	info := requestInfoFromContext(r.Context())
+	if info == nil {
+		return ""
+	}
+	return info.ID
+}
+
+// requestLogger returns the default logger with the request id, route and user of r.
+func requestLogger(r *http.Request) *slog.Logger {
+	logger := slog.Default().With("request_id", requestID(r), "method", r.Method, "pattern", r.Pattern)
+	if userId, ok := userIdFromContext(r.Context()); ok {
+		logger = logger.With("user_id", userId)
+	}
+	return logger
+}
@@ -1,12 +1,12 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/PavelVaavra/http-server/internal/auth"
 	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
 )
 
 // Update the POST /api/login endpoint to return a refresh token, as well as an access token:
@@ -24,62 +24,93 @@ import (
 // }
 
 func (cfg *apiConfig) login(w http.ResponseWriter, r *http.Request) {
-	type userParams struct {
-		Password string `json:"password"`
-		Email    string `json:"email"`
-	}
-	type response struct {
-		User
-		Token        string `json:"token"`
-		RefreshToken string `json:"refresh_token"`
-	}
-
-	decoder := json.NewDecoder(r.Body)
-	params := userParams{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not decode JSON", err)
+	params := loginParams{}
+	if !decodeJSON(w, r, &params) {
 		return
 	}
 
-	user, err := cfg.dbQueries.GetUserByEmail(r.Context(), params.Email)
+	user, err := cfg.store.GetUserByEmail(r.Context(), params.Email)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		cfg.metrics.Logins.WithLabelValues("failed").Inc()
+		respondWithProblem(w, r, problemInvalidCredentials, "Incorrect email or password", err)
 		return
 	}
 
 	match, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
 	if err != nil || !match {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", err)
+		cfg.metrics.Logins.WithLabelValues("failed").Inc()
+		respondWithProblem(w, r, problemInvalidCredentials, "Incorrect email or password", err)
+		return
+	}
+
+	// A user with TOTP gets an MFA token instead, POST /api/login/mfa exchanges it and a code for the tokens.
+	enabled, err := cfg.totpEnabled(r.Context(), user.ID)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get TOTP secret", err)
+		return
+	}
+	if enabled {
+		cfg.metrics.Logins.WithLabelValues("mfa_required").Inc()
+		expiresAt := time.Now().Add(mfaTokenTTL).UTC().Truncate(time.Second)
+		respondWithJson(w, http.StatusOK, mfaChallenge{
+			MFARequired: true,
+			MFAToken:    auth.MakeMFAToken(cfg.tokenSecret, user.ID, user.HashedPassword, expiresAt),
+			ExpiresAt:   expiresAt,
+		})
 		return
 	}
 
-	tokenString, err := auth.MakeJWT(user.ID, cfg.tokenSecret, 3600*time.Second)
+	cfg.issueTokens(w, r, user)
+}
+
+// issueTokens responds with an access token and a refresh token for user, the end of a successful login.
+func (cfg *apiConfig) issueTokens(w http.ResponseWriter, r *http.Request, user database.User) {
+	type response struct {
+		User
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	tokenString, err := cfg.jwtKeys.MakeJWT(user.ID, 3600*time.Second)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Cannot create JWT", err)
+		respondWithProblem(w, r, problemInternal, "Cannot create JWT", err)
 		return
 	}
 
 	refreshToken, _ := auth.MakeRefreshToken()
 
-	_, err = cfg.dbQueries.RefreshToken(r.Context(), database.RefreshTokenParams{
-		Token:  refreshToken,
-		UserID: user.ID,
+	// Every login starts a new token family, /api/refresh rotates tokens within it.
+	_, err = cfg.store.RefreshToken(r.Context(), database.RefreshTokenParams{
+		TokenHash: auth.HashRefreshToken(refreshToken),
+		UserID:    user.ID,
+		FamilyID:  uuid.New(),
 	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not create entry in refresh_token table", err)
+		respondWithProblem(w, r, problemInternal, "Could not create entry in refresh_token table", err)
 		return
 	}
 
+	cfg.metrics.Logins.WithLabelValues("succeeded").Inc()
 	respondWithJson(w, http.StatusOK, response{
-		User: User{
-			ID:          user.ID,
-			CreatedAt:   user.CreatedAt,
-			UpdatedAt:   user.UpdatedAt,
-			Email:       user.Email,
-			IsChirpyRed: user.IsChirpyRed,
-		},
+		User:         newUser(user),
 		Token:        tokenString,
 		RefreshToken: refreshToken,
 	})
 }
+
+// loginParams doesn't check the password policy, see validatePassword.
+type loginParams struct {
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+func (p loginParams) validate() []fieldError {
+	errs := fieldErrors()
+	if p.Email == "" {
+		errs = append(errs, fieldError{Field: "email", Message: "is required"})
+	}
+	if p.Password == "" {
+		errs = append(errs, fieldError{Field: "password", Message: "is required"})
+	}
+	return errs
+}
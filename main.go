@@ -1,138 +1,268 @@
 package main
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
 	"sync/atomic"
+	"syscall"
+	"time"
 
-	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/config"
+	"github.com/PavelVaavra/http-server/internal/mailer"
+	"github.com/PavelVaavra/http-server/internal/metrics"
+	"github.com/PavelVaavra/http-server/internal/store"
 	"github.com/joho/godotenv"
-	_ "github.com/lib/pq"
 )
 
 func main() {
 	godotenv.Load()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, nil)))
 
-	dbURL := os.Getenv("DB_URL")
-	db, err := sql.Open("postgres", dbURL)
+	cfg, err := config.Load(os.Args[1:], os.Getenv)
 	if err != nil {
-		log.Printf("Error opening db %v\n", err)
+		fatal("Invalid configuration", err)
 	}
-	dbQueries := database.New(db)
+	// The config goes to stderr, so stdout only has JSON log lines.
+	fmt.Fprintln(os.Stderr, "Effective configuration:")
+	cfg.Print(os.Stderr)
 
-	platform := os.Getenv("PLATFORM")
-	tokenSecret := os.Getenv("TOKEN_SECRET")
-	polkaKey := os.Getenv("POLKA_KEY")
+	if cfg.DBURL == "memory://" {
+		slog.Warn("Using in-memory store, data is lost on restart")
+	}
+	db, dialect, err := store.OpenDB(cfg.DBURL)
+	if err != nil {
+		fatal("Error opening db", err)
+	}
+	if db != nil {
+		err = pingDB(db)
+		if err != nil {
+			fatal("Database is unreachable", err)
+		}
+	}
 
-	const filepathRoot = "."
-	const port = "8080"
+	if len(cfg.Args) > 0 && cfg.Args[0] == "migrate" {
+		err := runMigrateCommand(context.Background(), db, dialect, cfg.Args[1:])
+		if err != nil {
+			fatal("Error migrating db", err)
+		}
+		return
+	}
+	err = prepareSchema(context.Background(), db, dialect, cfg.Migrate)
+	if err != nil {
+		fatal("Error checking db schema", err)
+	}
+	dataStore := store.New(db, dialect)
 
-	apiCfg := apiConfig{
-		dbQueries:   dbQueries,
-		platform:    platform,
-		tokenSecret: tokenSecret,
-		polkaKey:    polkaKey,
+	jwtKeys := auth.NewKeySet(cfg.TokenSecret)
+	validator := auth.DefaultValidator()
+	validator.Issuer = cfg.JWTIssuer
+	validator.Audiences = cfg.JWTAudiences
+	validator.Leeway = cfg.JWTLeeway
+	err = jwtKeys.SetValidator(validator)
+	if err != nil {
+		fatal("Invalid JWT validator configuration", err)
+	}
+	if cfg.JWTSigningKeyFile != "" {
+		err := jwtKeys.LoadSigningKey(cfg.JWTSigningKeyFile)
+		if err != nil {
+			fatal("Error loading JWT signing key", err)
+		}
+		jwtKeys.AcceptHS256(cfg.JWTAcceptHS256)
+	}
+	for _, path := range cfg.JWTVerificationKeyFiles {
+		err := jwtKeys.LoadVerificationKey(path)
+		if err != nil {
+			fatal("Error loading JWT verification key", err)
+		}
 	}
-	mux := http.NewServeMux()
 
-	mux.Handle("/app/", apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
-	mux.HandleFunc("GET /api/healthz", serverStatus)
-	mux.HandleFunc("GET /admin/metrics", apiCfg.metricsPrint)
-	mux.HandleFunc("GET /api/chirps", apiCfg.getAllChirps)
-	mux.HandleFunc("GET /api/chirps/{chirpID}", apiCfg.getChirp)
-	mux.HandleFunc("DELETE /api/chirps/{chirpID}", apiCfg.deleteChirp)
-	mux.HandleFunc("POST /admin/reset", apiCfg.metricsReset)
-	mux.HandleFunc("POST /api/users", apiCfg.createUsers)
-	mux.HandleFunc("PUT /api/users", apiCfg.updateUsers)
-	mux.HandleFunc("POST /api/chirps", apiCfg.createChirps)
-	mux.HandleFunc("POST /api/login", apiCfg.login)
-	mux.HandleFunc("POST /api/refresh", apiCfg.refresh)
-	mux.HandleFunc("POST /api/revoke", apiCfg.revoke)
-	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.webhooks)
+	mail, err := mailer.New(cfg.MailerURL, cfg.MailFrom)
+	if err != nil {
+		fatal("Invalid mailer configuration", err)
+	}
 
+	apiCfg := apiConfig{
+		metrics:         metrics.New(db),
+		store:           dataStore,
+		platform:        cfg.Platform,
+		jwtKeys:         jwtKeys,
+		polkaKeys:       append([]string{cfg.PolkaKey}, cfg.PolkaPreviousKeys...),
+		adminKey:        cfg.AdminKey,
+		webhookClient:   newWebhookClient(cfg.Platform == "dev"),
+		mailer:          mail,
+		tokenSecret:     cfg.TokenSecret,
+		requireVerified: cfg.RequireVerifiedEmail,
+	}
 	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: mux,
+		Addr:              ":" + cfg.Port,
+		Handler:           apiCfg.routes(cfg.FilepathRoot),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
 	}
 
-	fmt.Printf("Serving files from %v on port: %v\n", filepathRoot, port)
-	server.ListenAndServe()
-}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
-	if err != nil {
-		log.Println(err)
-	}
-	if code > 499 {
-		log.Printf("Responding with 5XX error: %s", msg)
+	// The loops are background work too, so a delivery in flight records its attempt before the database is closed.
+	apiCfg.background.Add(2)
+	go func() {
+		defer apiCfg.background.Done()
+		apiCfg.sweepSubscriptions(ctx, subscriptionSweepInterval)
+	}()
+	go func() {
+		defer apiCfg.background.Done()
+		apiCfg.dispatchWebhooks(ctx, webhookDispatchInterval)
+	}()
+
+	slog.Info("Serving", "filepath_root", cfg.FilepathRoot, "port", cfg.Port)
+	err = serve(ctx, server)
+	apiCfg.background.Wait()
+	if db != nil {
+		db.Close()
 	}
-	type errorResponse struct {
-		Error string `json:"error"`
+	if err != nil {
+		fatal("Error serving", err)
 	}
-	respondWithJson(w, code, errorResponse{
-		Error: msg,
-	})
 }
 
-func respondWithJson(w http.ResponseWriter, code int, payload interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	dat, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("Error marshalling JSON: %s", err)
-		w.WriteHeader(500)
-		return
-	}
-	w.WriteHeader(code)
-	w.Write(dat)
+// fatal logs msg with err and exits with status 1.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
 
-func serverStatus(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte("OK"))
+const (
+	readHeaderTimeout = 5 * time.Second
+	readTimeout       = 15 * time.Second
+	writeTimeout      = 30 * time.Second
+	idleTimeout       = 120 * time.Second
+	// shutdownTimeout is how long requests in flight get to finish after SIGINT or SIGTERM.
+	shutdownTimeout = 20 * time.Second
+	pingTimeout     = 5 * time.Second
+)
+
+// pingDB checks the database is reachable, sql.Open doesn't connect.
+func pingDB(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return db.PingContext(ctx)
 }
 
-type apiConfig struct {
-	fileserverHits atomic.Int32
-	dbQueries      *database.Queries
-	platform       string
-	tokenSecret    string
-	polkaKey       string
+// serve runs server until ctx is cancelled. Then it stops accepting connections and waits up to shutdownTimeout
+// for the requests in flight.
+func serve(ctx context.Context, server *http.Server) error {
+	listener, err := net.Listen("tcp", server.Addr)
+	if err != nil {
+		return fmt.Errorf("could not listen on %v: %w", server.Addr, err)
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- server.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for requests in flight")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return server.Shutdown(shutdownCtx)
 }
 
-func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.fileserverHits.Add(1)
-		next.ServeHTTP(w, r)
-	})
+// routes registers every endpoint. It is separate from main so tests can serve the whole API with httptest.
+func (cfg *apiConfig) routes(filepathRoot string) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("/app/", cfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))))
+	mux.HandleFunc("GET /api/healthz", serverStatus)
+	mux.HandleFunc("GET /.well-known/jwks.json", cfg.jwks)
+	mux.HandleFunc("GET /admin/metrics", cfg.metricsPrint)
+	mux.Handle("GET /metrics", cfg.metrics.Handler())
+	mux.HandleFunc("GET /api/chirps", cfg.getAllChirps)
+	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirp)
+	mux.HandleFunc("PUT /api/chirps/{chirpID}", cfg.requireAuth(cfg.updateChirp))
+	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.requireAuth(cfg.deleteChirp))
+	mux.HandleFunc("GET /api/chirps/{chirpID}/revisions", cfg.getChirpRevisions)
+	mux.HandleFunc("GET /api/chirps/{chirpID}/thread", cfg.getChirpThread)
+	mux.HandleFunc("POST /admin/reset", cfg.metricsReset)
+	mux.HandleFunc("GET /admin/webhooks/events", cfg.requireAdmin(cfg.getWebhookEvents))
+	mux.HandleFunc("POST /admin/webhooks/events/{eventID}/replay", cfg.requireAdmin(cfg.replayWebhookEvent))
+	mux.HandleFunc("POST /admin/webhooks/endpoints", cfg.requireAdmin(cfg.createWebhookEndpoint))
+	mux.HandleFunc("GET /admin/webhooks/endpoints", cfg.requireAdmin(cfg.getWebhookEndpoints))
+	mux.HandleFunc("DELETE /admin/webhooks/endpoints/{endpointID}", cfg.requireAdmin(cfg.deleteWebhookEndpoint))
+	mux.HandleFunc("GET /admin/webhooks/endpoints/{endpointID}/deliveries", cfg.requireAdmin(cfg.getWebhookDeliveries))
+	mux.HandleFunc("GET /admin/webhooks/deliveries/{deliveryID}", cfg.requireAdmin(cfg.getWebhookDelivery))
+	mux.HandleFunc("POST /api/users", cfg.createUsers)
+	mux.HandleFunc("PUT /api/users", cfg.requireAuth(cfg.updateUsers))
+	mux.HandleFunc("POST /api/users/verify", cfg.verifyEmail)
+	mux.HandleFunc("POST /api/users/verify/resend", cfg.requireAuth(cfg.resendVerificationEmail))
+	mux.HandleFunc("POST /api/mfa/totp", cfg.requireAuth(cfg.enrollTOTP))
+	mux.HandleFunc("POST /api/mfa/totp/confirm", cfg.requireAuth(cfg.confirmTOTP))
+	mux.HandleFunc("POST /api/mfa/totp/disable", cfg.requireAuth(cfg.disableTOTP))
+	mux.HandleFunc("GET /api/users/me/subscription", cfg.requireAuth(cfg.getSubscription))
+	mux.HandleFunc("POST /api/users/{userID}/follow", cfg.requireAuth(cfg.followUser))
+	mux.HandleFunc("DELETE /api/users/{userID}/follow", cfg.requireAuth(cfg.unfollowUser))
+	mux.HandleFunc("GET /api/users/{userID}/followers", cfg.getFollowers)
+	mux.HandleFunc("GET /api/users/{userID}/following", cfg.getFollowing)
+	mux.HandleFunc("GET /api/timeline", cfg.requireAuth(cfg.getTimeline))
+	mux.HandleFunc("POST /api/chirps", cfg.requireAuth(cfg.createChirps))
+	mux.HandleFunc("POST /api/login", cfg.login)
+	mux.HandleFunc("POST /api/login/mfa", cfg.loginMFA)
+	mux.HandleFunc("POST /api/password/forgot", cfg.forgotPassword)
+	mux.HandleFunc("POST /api/password/reset", cfg.resetPassword)
+	mux.HandleFunc("POST /api/refresh", cfg.refresh)
+	mux.HandleFunc("POST /api/revoke", cfg.revoke)
+	mux.HandleFunc("POST /api/polka/webhooks", cfg.webhooks)
+	mux.HandleFunc("POST /api/webhooks/endpoints", cfg.requireAuth(cfg.createWebhookEndpoint))
+	mux.HandleFunc("GET /api/webhooks/endpoints", cfg.requireAuth(cfg.getWebhookEndpoints))
+	mux.HandleFunc("DELETE /api/webhooks/endpoints/{endpointID}", cfg.requireAuth(cfg.deleteWebhookEndpoint))
+	mux.HandleFunc("GET /api/webhooks/endpoints/{endpointID}/deliveries", cfg.requireAuth(cfg.getWebhookDeliveries))
+	mux.HandleFunc("GET /api/webhooks/deliveries/{deliveryID}", cfg.requireAuth(cfg.getWebhookDelivery))
+
+	return logRequests(cfg.metrics.Middleware(mux))
 }
 
-func (cfg *apiConfig) metricsPrint(w http.ResponseWriter, _ *http.Request) {
-	html := fmt.Sprintf(`<html>
-<body>
-    <h1>Welcome, Chirpy Admin</h1>
-    <p>Chirpy has been visited %d times!</p>
-  </body>
-</html>`, cfg.fileserverHits.Load())
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+func serverStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(html))
+	w.Write([]byte("OK"))
 }
 
-func (cfg *apiConfig) metricsReset(w http.ResponseWriter, r *http.Request) {
-	cfg.fileserverHits.Store(0)
-	if cfg.platform != "dev" {
-		respondWithError(w, http.StatusForbidden, "Users can be deleted only in dev platform.", nil)
-		return
-	}
-	err := cfg.dbQueries.DeleteAllUsers(r.Context())
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not delete users from the table", err)
-		return
-	}
-	w.WriteHeader(http.StatusOK)
+type apiConfig struct {
+	metrics *metrics.Metrics
+	// fileserverHitsAtReset is the fileserver hits counter at the last POST /admin/reset. Prometheus counters never
+	// go down, so /admin/metrics shows the hits since then.
+	fileserverHitsAtReset atomic.Int64
+	store                 store.Store
+	platform              string
+	jwtKeys               *auth.KeySet
+	// polkaKeys are the keys Polka may sign webhooks with, the current one first.
+	polkaKeys []string
+	// adminKey authorizes requireAdmin, the admin endpoints are disabled if it's empty.
+	adminKey string
+	// webhookClient sends the outbound webhooks, see deliverWebhooks.
+	webhookClient *http.Client
+	mailer        mailer.Mailer
+	// tokenSecret signs the tokens of verification emails and of logins waiting for the second factor, see
+	// auth.MakeVerificationToken and auth.MakeMFAToken.
+	tokenSecret string
+	// requireVerified stops users from chirping until they verify their email.
+	requireVerified bool
+	// background tracks the work requests hand off to finish after responding and the background loops, main waits
+	// for it before closing the database.
+	background sync.WaitGroup
 }
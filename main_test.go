@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestServePortTaken(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	server := &http.Server{Addr: listener.Addr().String()}
+	err = serve(context.Background(), server)
+	if err == nil {
+		t.Errorf("serve on a taken port returns no error")
+	}
+}
+
+func TestServeShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	server := &http.Server{Addr: "127.0.0.1:0", Handler: http.NotFoundHandler()}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- serve(ctx, server)
+	}()
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("serve returns an error %v", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Errorf("serve doesn't return after ctx is cancelled")
+	}
+}
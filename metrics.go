@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+)
+
+func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg.metrics.FileserverHits.Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// metricsPrint renders the chirpy_ counters and gauges of the Prometheus registry, GET /metrics has everything.
+func (cfg *apiConfig) metricsPrint(w http.ResponseWriter, r *http.Request) {
+	samples, err := cfg.metrics.Samples("chirpy_")
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not gather metrics", err)
+		return
+	}
+
+	hits := int64(0)
+	rows := strings.Builder{}
+	for _, sample := range samples {
+		if sample.Name == "chirpy_fileserver_hits_total" {
+			hits = int64(sample.Value) - cfg.fileserverHitsAtReset.Load()
+		}
+		fmt.Fprintf(&rows, "      <tr><td>%s%s</td><td>%v</td></tr>\n", html.EscapeString(sample.Name), html.EscapeString(sample.Labels), sample.Value)
+	}
+
+	page := fmt.Sprintf(`<html>
+<body>
+    <h1>Welcome, Chirpy Admin</h1>
+    <p>Chirpy has been visited %d times!</p>
+    <table>
+%s    </table>
+  </body>
+</html>`, hits, rows.String())
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(page))
+}
+
+func (cfg *apiConfig) metricsReset(w http.ResponseWriter, r *http.Request) {
+	samples, _ := cfg.metrics.Samples("chirpy_fileserver_hits_total")
+	for _, sample := range samples {
+		cfg.fileserverHitsAtReset.Store(int64(sample.Value))
+	}
+	if cfg.platform != "dev" {
+		respondWithProblem(w, r, problemNotDevPlatform, "Users can be deleted only in dev platform.", nil)
+		return
+	}
+	err := cfg.store.DeleteAllUsers(r.Context())
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not delete users from the table", err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// totpIssuer names Chirpy in authenticator apps.
+	totpIssuer = "Chirpy"
+	// mfaTokenTTL is how long a login waits for the second factor after the password was right.
+	mfaTokenTTL = 5 * time.Minute
+	// recoveryCodeCount is how many recovery codes a user gets when they enable TOTP.
+	recoveryCodeCount = 10
+	// totpMaxAttempts wrong codes in a row lock the second factor for totpLockout, so 6 digits can't be guessed.
+	totpMaxAttempts = 5
+	totpLockout     = 15 * time.Minute
+)
+
+// TOTPEnrollment is shown once, the user adds the secret to an authenticator app, usually as a QR code of the URI.
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+}
+
+type recoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// mfaChallenge is the response of POST /api/login for a user with TOTP.
+type mfaChallenge struct {
+	MFARequired bool      `json:"mfa_required"`
+	MFAToken    string    `json:"mfa_token"`
+	ExpiresAt   time.Time `json:"mfa_token_expires_at"`
+}
+
+type totpCodeParams struct {
+	Code string `json:"code"`
+}
+
+func (p totpCodeParams) validate() []fieldError {
+	return fieldErrors(fieldError{Field: "code", Message: validateCode(p.Code)})
+}
+
+// disableTOTPParams re-authenticates the user, with the password and a TOTP or recovery code.
+type disableTOTPParams struct {
+	Password string `json:"password"`
+	Code     string `json:"code"`
+}
+
+func (p disableTOTPParams) validate() []fieldError {
+	passwordMessage := ""
+	if p.Password == "" {
+		passwordMessage = "is required"
+	}
+	return fieldErrors(
+		fieldError{Field: "password", Message: passwordMessage},
+		fieldError{Field: "code", Message: validateCode(p.Code)},
+	)
+}
+
+type loginMFAParams struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+func (p loginMFAParams) validate() []fieldError {
+	tokenMessage := ""
+	if p.MFAToken == "" {
+		tokenMessage = "is required"
+	}
+	return fieldErrors(
+		fieldError{Field: "mfa_token", Message: tokenMessage},
+		fieldError{Field: "code", Message: validateCode(p.Code)},
+	)
+}
+
+func validateCode(code string) string {
+	if strings.TrimSpace(code) == "" {
+		return "is required"
+	}
+	return ""
+}
+
+func (cfg *apiConfig) totpEnabled(ctx context.Context, userId uuid.UUID) (bool, error) {
+	secret, err := cfg.store.GetTOTPSecret(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return secret.EnabledAt.Valid, err
+}
+
+// POST /api/mfa/totp starts the TOTP enrollment of the logged in user with a new secret. TOTP is enabled only when
+// POST /api/mfa/totp/confirm gets a first code, until then enrolling again replaces the secret.
+func (cfg *apiConfig) enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	user, err := cfg.store.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get user", err)
+		return
+	}
+
+	secret := auth.MakeTOTPSecret()
+	_, err = cfg.store.UpsertTOTPSecret(r.Context(), database.UpsertTOTPSecretParams{UserID: userId, Secret: secret})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemMFAAlreadyEnabled, "Disable two-factor authentication before enrolling again", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not store TOTP secret", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusCreated, TOTPEnrollment{
+		Secret:     secret,
+		OtpauthURI: auth.TOTPURI(secret, totpIssuer, user.Email),
+	})
+}
+
+// POST /api/mfa/totp/confirm enables TOTP with a first code from the authenticator app, which proves the app has the
+// secret. It responds with the recovery codes, they are only stored hashed and can't be shown again.
+func (cfg *apiConfig) confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	params := totpCodeParams{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	secret, err := cfg.store.GetTOTPSecret(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemMFANotEnabled, "Start the enrollment with POST /api/mfa/totp first", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get TOTP secret", err)
+		return
+	}
+	if secret.EnabledAt.Valid {
+		respondWithProblem(w, r, problemMFAAlreadyEnabled, "Two-factor authentication is enabled already", nil)
+		return
+	}
+
+	step, err := auth.ValidateTOTP(secret.Secret, strings.TrimSpace(params.Code), time.Now())
+	if errors.Is(err, auth.ErrTOTPCodeInvalid) {
+		respondWithProblem(w, r, problemInvalidMFACode, "Code doesn't match, check the clock of the device", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not check code", err)
+		return
+	}
+
+	codes := auth.MakeRecoveryCodes(recoveryCodeCount)
+	err = cfg.store.InTx(r.Context(), func(q database.Querier) error {
+		enabled, err := q.EnableTOTP(r.Context(), database.EnableTOTPParams{UserID: userId, Step: step})
+		if err != nil {
+			return err
+		}
+		if enabled == 0 {
+			return sql.ErrNoRows
+		}
+		err = q.DeleteRecoveryCodes(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		for _, code := range codes {
+			err = q.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{CodeHash: auth.HashRecoveryCode(code), UserID: userId})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemMFAAlreadyEnabled, "Two-factor authentication is enabled already", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not enable TOTP", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, recoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// POST /api/mfa/totp/disable turns TOTP off and deletes the recovery codes. An access token isn't enough, the user
+// logs in again with the password and a TOTP or recovery code.
+func (cfg *apiConfig) disableTOTP(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	params := disableTOTPParams{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	user, err := cfg.store.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get user", err)
+		return
+	}
+	match, err := auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	if err != nil || !match {
+		respondWithProblem(w, r, problemInvalidCredentials, "Incorrect password", err)
+		return
+	}
+	if !cfg.checkSecondFactor(w, r, userId, params.Code) {
+		return
+	}
+
+	err = cfg.store.InTx(r.Context(), func(q database.Querier) error {
+		err := q.DeleteTOTPSecret(r.Context(), userId)
+		if err != nil {
+			return err
+		}
+		return q.DeleteRecoveryCodes(r.Context(), userId)
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not disable TOTP", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// POST /api/login/mfa is the second step of a login with TOTP. It exchanges the MFA token of POST /api/login and a
+// TOTP or recovery code for an access token and a refresh token.
+func (cfg *apiConfig) loginMFA(w http.ResponseWriter, r *http.Request) {
+	params := loginMFAParams{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	userId, err := auth.MFATokenUser(params.MFAToken)
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidMFAToken, "MFA token is malformed", err)
+		return
+	}
+	user, err := cfg.store.GetUserById(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemInvalidMFAToken, "MFA token belongs to no user", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get user", err)
+		return
+	}
+	err = auth.ValidateMFAToken(cfg.tokenSecret, params.MFAToken, user.HashedPassword, time.Now())
+	if errors.Is(err, auth.ErrMFATokenExpired) {
+		respondWithProblem(w, r, problemInvalidMFAToken, "MFA token expired, log in again", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidMFAToken, "MFA token is wrong or the password changed since the login", err)
+		return
+	}
+
+	if !cfg.checkSecondFactor(w, r, user.ID, params.Code) {
+		cfg.metrics.Logins.WithLabelValues("failed").Inc()
+		return
+	}
+
+	cfg.issueTokens(w, r, user)
+}
+
+// checkSecondFactor accepts code if it is a TOTP code which wasn't used yet or an unused recovery code of the user.
+// Every attempt is counted before the code is checked, and the lock is checked again when the code is used, so
+// concurrent requests can't check more than totpMaxAttempts codes. If the code isn't accepted, the error response is
+// already written and ok is false.
+func (cfg *apiConfig) checkSecondFactor(w http.ResponseWriter, r *http.Request, userId uuid.UUID, code string) (ok bool) {
+	secret, err := cfg.store.GetTOTPSecret(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !secret.EnabledAt.Valid) {
+		respondWithProblem(w, r, problemMFANotEnabled, "Two-factor authentication isn't enabled", err)
+		return false
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get TOTP secret", err)
+		return false
+	}
+
+	now := time.Now()
+	if secret.LockedUntil.Valid && now.Before(secret.LockedUntil.Time) {
+		respondMFALocked(w, r, secret.LockedUntil.Time.Sub(now))
+		return false
+	}
+	started, err := cfg.store.StartTOTPAttempt(r.Context(), database.StartTOTPAttemptParams{
+		UserID:      userId,
+		MaxAttempts: totpMaxAttempts,
+		Now:         now.UTC(),
+		StaleBefore: now.UTC().Add(-totpLockout),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not count attempt", err)
+		return false
+	}
+	if started == 0 {
+		// The other attempts are still being checked, one of them will lock.
+		respondMFALocked(w, r, totpLockout)
+		return false
+	}
+
+	accepted, err := cfg.useSecondFactor(r.Context(), secret, strings.TrimSpace(code), now)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not check code", err)
+		return false
+	}
+	if !accepted {
+		_, err = cfg.store.RecordTOTPFailure(r.Context(), database.RecordTOTPFailureParams{
+			UserID:      userId,
+			MaxAttempts: totpMaxAttempts,
+			LockUntil:   now.UTC().Add(totpLockout),
+		})
+		if err != nil {
+			respondWithProblem(w, r, problemInternal, "Could not record failed code", err)
+			return false
+		}
+		respondWithProblem(w, r, problemInvalidMFACode, "Code is wrong, expired or used already", nil)
+		return false
+	}
+	return true
+}
+
+func respondMFALocked(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	respondWithProblem(w, r, problemMFALocked, "Too many wrong codes, try again later", nil)
+}
+
+// useSecondFactor marks a TOTP code's step or a recovery code used, so neither works twice. It doesn't accept any code
+// while the second factor is locked.
+func (cfg *apiConfig) useSecondFactor(ctx context.Context, secret database.TotpSecret, code string, now time.Time) (bool, error) {
+	step, err := auth.ValidateTOTP(secret.Secret, code, now)
+	if err == nil {
+		used, err := cfg.store.UseTOTPStep(ctx, database.UseTOTPStepParams{
+			UserID: secret.UserID,
+			Step:   step,
+			Now:    now.UTC(),
+		})
+		return used == 1, err
+	}
+	if !errors.Is(err, auth.ErrTOTPCodeInvalid) {
+		return false, err
+	}
+
+	used, err := cfg.store.UseRecoveryCode(ctx, database.UseRecoveryCodeParams{
+		UserID:   secret.UserID,
+		CodeHash: auth.HashRecoveryCode(code),
+		Now:      now.UTC(),
+	})
+	if err != nil || used == 0 {
+		return false, err
+	}
+	return true, cfg.store.ClearTOTPFailures(ctx, secret.UserID)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/PavelVaavra/http-server/internal/migrate"
+	"github.com/PavelVaavra/http-server/internal/store"
+)
+
+// runMigrateCommand handles `migrate status|up|down`.
+func runMigrateCommand(ctx context.Context, db *sql.DB, dialect store.Dialect, args []string) error {
+	if db == nil {
+		return errors.New("the in-memory store has no schema to migrate")
+	}
+	if len(args) != 1 {
+		return errors.New("usage: migrate status|up|down")
+	}
+	m, err := migrate.New(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		return m.Status(ctx, os.Stdout)
+	case "up":
+		return m.Up(ctx, os.Stdout)
+	case "down":
+		return m.Down(ctx, os.Stdout)
+	default:
+		return fmt.Errorf("unknown migrate command %q, usage: migrate status|up|down", args[0])
+	}
+}
+
+// prepareSchema applies the pending migrations if migrateOnBoot is set. Either way, the server doesn't start on a
+// schema it wasn't built for.
+func prepareSchema(ctx context.Context, db *sql.DB, dialect store.Dialect, migrateOnBoot bool) error {
+	if db == nil {
+		return nil
+	}
+	m, err := migrate.New(db, dialect)
+	if err != nil {
+		return err
+	}
+	if migrateOnBoot {
+		err = m.Up(ctx, os.Stdout)
+		if err != nil {
+			return err
+		}
+	}
+	err = m.Check(ctx)
+	if errors.Is(err, migrate.ErrSchemaDrift) {
+		return fmt.Errorf("%w, run with -migrate or `migrate up`", err)
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/PavelVaavra/http-server/internal/pagination"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 100
+)
+
+// page holds the limit and cursor query parameters of a paginated endpoint.
+type page struct {
+	limit  int
+	cursor pagination.Cursor
+}
+
+// parsePage reads ?limit=...&cursor=... from the request. If they are invalid, the error response is already written and ok is false.
+func parsePage(w http.ResponseWriter, r *http.Request) (p page, ok bool) {
+	query := r.URL.Query()
+
+	p.limit = defaultPageLimit
+	if l := query.Get("limit"); l != "" {
+		limit, err := strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxPageLimit {
+			respondWithProblem(w, r, problemInvalidParameter, "Invalid limit, use a number between 1 and "+strconv.Itoa(maxPageLimit), err, fieldError{Field: "limit", Message: "has to be a number between 1 and " + strconv.Itoa(maxPageLimit)})
+			return page{}, false
+		}
+		p.limit = limit
+	}
+
+	if c := query.Get("cursor"); c != "" {
+		cursor, err := pagination.DecodeCursor(c)
+		if err != nil {
+			respondWithProblem(w, r, problemInvalidParameter, "Invalid cursor", err, fieldError{Field: "cursor", Message: "isn't a cursor returned by a previous page"})
+			return page{}, false
+		}
+		p.cursor = cursor
+	}
+
+	return p, true
+}
+
+// fetchLimit is passed to SQL LIMIT, the one extra row tells us whether there is a next page.
+func (p page) fetchLimit() int32 {
+	return int32(p.limit + 1)
+}
+
+func (p page) cursorCreatedAt() sql.NullTime {
+	return sql.NullTime{Time: p.cursor.CreatedAt, Valid: !p.cursor.CreatedAt.IsZero()}
+}
+
+func (p page) cursorID() uuid.NullUUID {
+	return uuid.NullUUID{UUID: p.cursor.ID, Valid: p.cursor.ID != uuid.Nil}
+}
+
+// setNextLink sets the Link header to the current URL with the cursor (and limit) replaced by the next page.
+func setNextLink(w http.ResponseWriter, r *http.Request, nextCursor string, limit int) {
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", nextCursor)
+	query.Set("limit", strconv.Itoa(limit))
+	next.RawQuery = query.Encode()
+	w.Header().Set("Link", "<"+next.RequestURI()+`>; rel="next"`)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/mailer"
+)
+
+const (
+	// passwordResetTTL is how long the token of a password reset email is valid.
+	passwordResetTTL = time.Hour
+	// passwordResetInterval is how long a user waits before another password reset email, so the forgot endpoint
+	// can't flood an inbox.
+	passwordResetInterval = time.Minute
+	// passwordResetMailTimeout is how long sending a password reset email may take after the response.
+	passwordResetMailTimeout = 30 * time.Second
+)
+
+type forgotPasswordParams struct {
+	Email string `json:"email"`
+}
+
+func (p forgotPasswordParams) validate() []fieldError {
+	return fieldErrors(fieldError{Field: "email", Message: validateEmail(p.Email)})
+}
+
+// POST /api/password/forgot emails a password reset token to the user with the email. It responds with 202 whether
+// or not there is such a user, and whether or not an email was sent, so it can't be used to find accounts. The user
+// is looked up and emailed after the response, so it doesn't take longer for existing accounts either.
+func (cfg *apiConfig) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	params := forgotPasswordParams{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	logger := requestLogger(r)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(r.Context()), passwordResetMailTimeout)
+	cfg.background.Add(1)
+	go func() {
+		defer cfg.background.Done()
+		defer cancel()
+		user, err := cfg.store.GetUserByEmail(ctx, params.Email)
+		if errors.Is(err, sql.ErrNoRows) {
+			return
+		}
+		if err != nil {
+			logger.Error("Could not get user for password reset", "error", err)
+			return
+		}
+		err = cfg.mailPasswordReset(ctx, user)
+		if err != nil {
+			logger.Error("Could not send password reset email", "user_id", user.ID, "error", err)
+		}
+	}()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// mailPasswordReset stores a new reset token for user and emails it, unless the user got one within
+// passwordResetInterval.
+func (cfg *apiConfig) mailPasswordReset(ctx context.Context, user database.User) error {
+	now := time.Now().UTC()
+	recent, err := cfg.store.CountPasswordResetsSince(ctx, database.CountPasswordResetsSinceParams{
+		UserID: user.ID,
+		Since:  now.Add(-passwordResetInterval),
+	})
+	if err != nil || recent > 0 {
+		return err
+	}
+
+	// Reset tokens are random like refresh tokens, so they are stored as a plain SHA-256 digest the same way.
+	token, _ := auth.MakeRefreshToken()
+	_, err = cfg.store.CreatePasswordReset(ctx, database.CreatePasswordResetParams{
+		TokenHash: auth.HashRefreshToken(token),
+		UserID:    user.ID,
+		ExpiresAt: now.Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your Chirpy password",
+		Body: "Someone asked to reset the password of your Chirpy account.\n\n" +
+			"Send this token with a new password to POST /api/password/reset within an hour:\n\n" +
+			token + "\n\n" +
+			"If it wasn't you, ignore this email, your password stays the same.",
+	})
+}
+
+type resetPasswordParams struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+func (p resetPasswordParams) validate() []fieldError {
+	tokenMessage := ""
+	if p.Token == "" {
+		tokenMessage = "is required"
+	}
+	return fieldErrors(
+		fieldError{Field: "token", Message: tokenMessage},
+		fieldError{Field: "password", Message: validatePassword(p.Password)},
+	)
+}
+
+// POST /api/password/reset sets a new password with the token of a password reset email. The token works once, and
+// the other reset tokens and all refresh tokens of the user stop working, so every session has to log in again.
+func (cfg *apiConfig) resetPassword(w http.ResponseWriter, r *http.Request) {
+	params := resetPasswordParams{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	hash, err := auth.HashPassword(params.Password)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not hash password", err)
+		return
+	}
+
+	err = cfg.store.InTx(r.Context(), func(q database.Querier) error {
+		reset, err := q.UsePasswordReset(r.Context(), database.UsePasswordResetParams{
+			TokenHash: auth.HashRefreshToken(params.Token),
+			Now:       time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		err = q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{ID: reset.UserID, HashedPassword: hash})
+		if err != nil {
+			return err
+		}
+		err = q.InvalidatePasswordResets(r.Context(), reset.UserID)
+		if err != nil {
+			return err
+		}
+		return q.RevokeUserRefreshTokens(r.Context(), reset.UserID)
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemInvalidResetToken, "Reset token is unknown, used or expired, ask for a new one", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not reset password", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
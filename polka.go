@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	polkaSignatureHeader = "Polka-Signature"
+	// polkaSignatureTolerance is how far the timestamp of a webhook may be from our clock. Older webhooks are
+	// rejected, so a captured request can only be replayed within this window.
+	polkaSignatureTolerance = 5 * time.Minute
+)
+
+// - Add a POST /api/polka/webhooks endpoint. It should accept a request of this shape:
+// {
+//   "id": "evt_3b1f0c2a",
+//   "event": "user.upgraded",
+//   "data": {
+//     "user_id": "3311741c-680c-4546-99f3-fc9efac2036c"
+//   }
+// }
+
+// - If the event isn't about a Chirpy Red subscription, the endpoint should immediately respond with a 204 status code - we don't care about
+// any other events.
+// - user.upgraded, user.renewed, user.payment_failed and user.downgraded change the subscription of the user, see applySubscriptionEvent.
+// - If the subscription is updated successfully, the endpoint should respond with a 204 status code and an empty response body. If the user
+// can't be found, the endpoint should respond with a 404 status code.
+
+// Polka signs every webhook with the Polka-Signature header, see auth.SignWebhook. The signature covers the timestamp
+// and the body, which contains the event id. Every event is stored in the webhook_events inbox before it is processed,
+// so Polka retries and replays of a processed event are answered with 204 without applying it again, and failed
+// events can be replayed from /admin/webhooks/events.
+func (cfg *apiConfig) webhooks(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodyBytes)
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithDecodeError(w, r, err)
+		return
+	}
+
+	err = auth.VerifyWebhook(r.Header.Get(polkaSignatureHeader), body, cfg.polkaKeys, time.Now(), polkaSignatureTolerance)
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidSignature, "Could not verify Polka-Signature: "+err.Error(), err)
+		return
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	params := polkaWebhookParams{}
+	if !decodeExternalJSON(w, r, &params) {
+		return
+	}
+
+	event, err := cfg.store.CreateWebhookEvent(r.Context(), database.CreateWebhookEventParams{
+		EventID: params.ID,
+		Event:   params.Event,
+		Payload: string(body),
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		// The event id is in the inbox already.
+		event, err = cfg.store.GetWebhookEventByEventID(r.Context(), params.ID)
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not store webhook event", err)
+		return
+	}
+	if event.Status == webhookEventProcessed {
+		requestLogger(r).Info("Webhook event was processed before", "event_id", event.EventID)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	err = cfg.processWebhookEvent(r.Context(), event)
+	if errors.Is(err, errUnknownUser) {
+		respondWithProblem(w, r, problemUserNotFound, "User not found", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not process webhook event", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// processWebhookEvent applies an event of the inbox. Marking it processed and applying it happen in one transaction,
+// and the UPDATE locks the row until the transaction ends, so concurrent deliveries of the same event apply it once.
+// If applying fails, the event is marked failed with the error and its attempts are counted.
+func (cfg *apiConfig) processWebhookEvent(ctx context.Context, event database.WebhookEvent) error {
+	params := polkaWebhookParams{}
+	err := json.Unmarshal([]byte(event.Payload), &params)
+	label := ""
+	if err == nil {
+		err = cfg.store.InTx(ctx, func(q database.Querier) error {
+			marked, err := q.MarkWebhookEventProcessed(ctx, event.ID)
+			if err != nil || marked == 0 {
+				return err
+			}
+			if !isSubscriptionEvent(params.Event) {
+				label = "ignored"
+				return nil
+			}
+			label = params.Event
+			return applySubscriptionEvent(ctx, q, params.Event, params.Data.UserId, time.Now())
+		})
+	}
+	if err != nil {
+		failErr := cfg.store.MarkWebhookEventFailed(ctx, database.MarkWebhookEventFailedParams{
+			ID:        event.ID,
+			LastError: sql.NullString{String: err.Error(), Valid: true},
+		})
+		return errors.Join(err, failErr)
+	}
+
+	if label != "" {
+		cfg.metrics.WebhooksProcessed.WithLabelValues(label).Inc()
+	}
+	return nil
+}
+
+type polkaWebhookParams struct {
+	ID    string `json:"id"`
+	Event string `json:"event"`
+	Data  struct {
+		UserId uuid.UUID `json:"user_id"`
+	} `json:"data"`
+}
+
+// validate only requires what Chirpy reads, other events may come with any data.
+func (p polkaWebhookParams) validate() []fieldError {
+	errs := fieldErrors()
+	if p.ID == "" {
+		errs = append(errs, fieldError{Field: "id", Message: "is required"})
+	}
+	if p.Event == "" {
+		errs = append(errs, fieldError{Field: "event", Message: "is required"})
+	}
+	if isSubscriptionEvent(p.Event) && p.Data.UserId == uuid.Nil {
+		errs = append(errs, fieldError{Field: "data.user_id", Message: "is required"})
+	}
+	return errs
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// problemTypeBase prefixes the code of a problem to make its RFC 9457 type URI.
+const problemTypeBase = "urn:chirpy:problem:"
+
+// problemType is one kind of error response. Its code is stable, so clients can branch on it instead of matching
+// the detail text, which may change.
+type problemType struct {
+	status int
+	code   string
+	title  string
+}
+
+var (
+	problemInvalidJSON              = problemType{http.StatusBadRequest, "invalid_json", "Request body isn't valid JSON"}
+	problemValidation               = problemType{http.StatusBadRequest, "validation_failed", "Request has invalid fields"}
+	problemInvalidParameter         = problemType{http.StatusBadRequest, "invalid_parameter", "Path or query parameter is invalid"}
+	problemChirpTooLong             = problemType{http.StatusBadRequest, "chirp_too_long", "Chirp is too long"}
+	problemReplyToMissing           = problemType{http.StatusBadRequest, "reply_to_not_found", "Chirp you reply to doesn't exist"}
+	problemFollowSelf               = problemType{http.StatusBadRequest, "follow_self", "User can't follow themselves"}
+	problemInvalidVerificationToken = problemType{http.StatusBadRequest, "invalid_verification_token", "Verification token is invalid or expired"}
+	problemInvalidResetToken        = problemType{http.StatusBadRequest, "invalid_reset_token", "Password reset token is invalid, used or expired"}
+	problemUnauthenticated          = problemType{http.StatusUnauthorized, "unauthenticated", "Access token is missing"}
+	problemInvalidToken             = problemType{http.StatusUnauthorized, "invalid_token", "Access token isn't valid"}
+	problemTokenExpired             = problemType{http.StatusUnauthorized, "token_expired", "Access token expired"}
+	problemInvalidCredentials       = problemType{http.StatusUnauthorized, "invalid_credentials", "Incorrect email or password"}
+	problemInvalidMFAToken          = problemType{http.StatusUnauthorized, "invalid_mfa_token", "MFA token is invalid or expired, log in again"}
+	problemInvalidMFACode           = problemType{http.StatusUnauthorized, "invalid_mfa_code", "Two-factor code is wrong"}
+	problemInvalidRefreshToken      = problemType{http.StatusUnauthorized, "invalid_refresh_token", "Refresh token is missing, unknown, expired or revoked"}
+	problemInvalidAdminKey          = problemType{http.StatusUnauthorized, "invalid_admin_key", "Admin key is missing or wrong"}
+	problemInvalidSignature         = problemType{http.StatusUnauthorized, "invalid_signature", "Webhook signature is missing, expired or wrong"}
+	problemNotChirpAuthor           = problemType{http.StatusForbidden, "not_chirp_author", "Only the author can change a chirp"}
+	problemNotDevPlatform           = problemType{http.StatusForbidden, "not_dev_platform", "Only allowed on the dev platform"}
+	problemEmailNotVerified         = problemType{http.StatusForbidden, "email_not_verified", "Email has to be verified first"}
+	problemBodyTooLarge             = problemType{http.StatusRequestEntityTooLarge, "body_too_large", "Request body is too large"}
+	problemUnsupportedMediaType     = problemType{http.StatusUnsupportedMediaType, "unsupported_media_type", "Request body has to be JSON"}
+	problemWebhookEventProcessed    = problemType{http.StatusConflict, "webhook_event_processed", "Webhook event was processed already"}
+	problemEmailAlreadyVerified     = problemType{http.StatusConflict, "email_already_verified", "Email is verified already"}
+	problemMFAAlreadyEnabled        = problemType{http.StatusConflict, "mfa_already_enabled", "Two-factor authentication is enabled already"}
+	problemMFANotEnabled            = problemType{http.StatusConflict, "mfa_not_enabled", "Two-factor authentication isn't enabled"}
+	problemEmailTaken               = problemType{http.StatusConflict, "email_taken", "Email is used by another user"}
+	problemVerificationThrottled    = problemType{http.StatusTooManyRequests, "verification_email_throttled", "Verification email was sent recently"}
+	problemMFALocked                = problemType{http.StatusTooManyRequests, "mfa_locked", "Too many wrong two-factor codes"}
+	problemChirpNotFound            = problemType{http.StatusNotFound, "chirp_not_found", "Chirp not found"}
+	problemSubscriptionNotFound     = problemType{http.StatusNotFound, "subscription_not_found", "User has no subscription"}
+	problemWebhookEventNotFound     = problemType{http.StatusNotFound, "webhook_event_not_found", "Webhook event not found"}
+	problemWebhookEndpointNotFound  = problemType{http.StatusNotFound, "webhook_endpoint_not_found", "Webhook endpoint not found"}
+	problemWebhookDeliveryNotFound  = problemType{http.StatusNotFound, "webhook_delivery_not_found", "Webhook delivery not found"}
+	problemUserNotFound             = problemType{http.StatusNotFound, "user_not_found", "User not found"}
+	problemInternal                 = problemType{http.StatusInternalServerError, "internal_error", "Internal server error"}
+)
+
+// problem is an RFC 9457 problem details response, with the stable code and the request id as extension members.
+type problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError says what is wrong with one field of the request body or one parameter.
+type fieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// respondWithProblem logs err and responds with an application/problem+json body for p. detail is shown to the client,
+// err only goes to the log.
+func respondWithProblem(w http.ResponseWriter, r *http.Request, p problemType, detail string, err error, fields ...fieldError) {
+	logger := requestLogger(r).With("status", p.status, "code", p.code, "detail", detail)
+	if p.status > 499 {
+		logger.Error("Responding with 5XX error", "error", err)
+	} else if err != nil {
+		logger.Warn("Request failed", "error", err)
+	}
+
+	writeJSON(w, p.status, "application/problem+json", problem{
+		Type:      problemTypeBase + p.code,
+		Title:     p.title,
+		Status:    p.status,
+		Detail:    detail,
+		Instance:  r.URL.Path,
+		Code:      p.code,
+		RequestID: requestID(r),
+		Errors:    fields,
+	})
+}
+
+func respondWithJson(w http.ResponseWriter, code int, payload interface{}) {
+	writeJSON(w, code, "application/json", payload)
+}
+
+func writeJSON(w http.ResponseWriter, code int, contentType string, payload interface{}) {
+	w.Header().Set("Content-Type", contentType)
+	dat, err := json.Marshal(payload)
+	if err != nil {
+		slog.Error("Error marshalling JSON", "error", err)
+		w.WriteHeader(500)
+		return
+	}
+	w.WriteHeader(code)
+	w.Write(dat)
+}
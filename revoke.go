@@ -16,13 +16,13 @@ import (
 func (cfg *apiConfig) revoke(w http.ResponseWriter, r *http.Request) {
 	refreshToken, err := auth.GetBearerToken(r.Header)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "No refresh token in the header", err)
+		respondWithProblem(w, r, problemInvalidRefreshToken, "No refresh token in the header", err)
 		return
 	}
 
-	err = cfg.dbQueries.RevokeRefreshToken(r.Context(), refreshToken)
+	err = cfg.store.RevokeRefreshToken(r.Context(), auth.HashRefreshToken(refreshToken))
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Error while revoking refresh token (error update refresh_token table)", err)
+		respondWithProblem(w, r, problemInternal, "Could not revoke refresh token", err)
 		return
 	}
 
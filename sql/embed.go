@@ -0,0 +1,14 @@
+// Package sql embeds the goose migrations, so the server binary can migrate its database without the sql directory.
+package sql
+
+import "embed"
+
+// PostgresMigrations holds sql/schema.
+//
+//go:embed schema/*.sql
+var PostgresMigrations embed.FS
+
+// SQLiteMigrations holds sql/sqlite/schema.
+//
+//go:embed sqlite/schema/*.sql
+var SQLiteMigrations embed.FS
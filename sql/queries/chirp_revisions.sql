@@ -0,0 +1,17 @@
+-- CreateChirpRevision saves the current body of the chirp, unless it was deleted. It locks the chirp, so a concurrent
+-- edit waits and then saves the body this one sets.
+-- name: CreateChirpRevision :one
+INSERT INTO chirp_revisions (id, created_at, chirp_id, body)
+SELECT gen_random_uuid(), NOW(), chirps.id, chirps.body FROM chirps
+WHERE chirps.id = sqlc.arg('chirp_id') AND chirps.deleted_at IS NULL
+FOR UPDATE
+RETURNING *;
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = $1
+ORDER BY created_at, id;
+
+-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = $1;
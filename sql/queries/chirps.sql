@@ -1,23 +1,80 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
 VALUES (
-    gen_random_uuid(), NOW(), NOW(), $1, $2
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3
 )
 RETURNING *;
 
--- name: ListChirps :many
+-- name: ListChirpsAsc :many
 SELECT * FROM chirps
-ORDER BY created_at;
+WHERE deleted_at IS NULL
+AND (sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id')::uuid)
+AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at, id
+LIMIT $1;
 
--- name: ListChirpsByUserId :many
+-- name: ListChirpsDesc :many
 SELECT * FROM chirps
-WHERE user_id = $1
-ORDER BY created_at;
+WHERE deleted_at IS NULL
+AND (sqlc.narg('user_id')::uuid IS NULL OR user_id = sqlc.narg('user_id')::uuid)
+AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $1;
 
 -- name: GetChirp :one
 SELECT * FROM chirps
-WHERE id = $1;
+WHERE id = $1 AND deleted_at IS NULL;
 
--- name: DeleteChirp :exec
+-- DeleteChirp returns 0 if the chirp has replies, such a chirp is tombstoned instead.
+-- name: DeleteChirp :execrows
 DELETE FROM chirps
-WHERE id = $1;
\ No newline at end of file
+WHERE chirps.id = $1 AND NOT EXISTS (
+    SELECT 1 FROM chirps AS replies
+    WHERE replies.in_reply_to = chirps.id
+);
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET updated_at = NOW(), body = $1
+WHERE id = $2 AND deleted_at IS NULL
+RETURNING *;
+
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET updated_at = NOW(), deleted_at = NOW(), body = ''
+WHERE id = $1;
+
+-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.created_at, parent.updated_at, parent.body, parent.user_id, parent.in_reply_to, parent.deleted_at,
+        1 AS depth
+    FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = $1
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at,
+        a.depth + 1
+    FROM chirps c
+    JOIN ancestors a ON a.in_reply_to = c.id
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at FROM ancestors
+ORDER BY depth DESC;
+
+-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at,
+        0 AS depth
+    FROM chirps
+    WHERE chirps.id = $1
+    UNION ALL
+    SELECT c.id, c.created_at, c.updated_at, c.body, c.user_id, c.in_reply_to, c.deleted_at,
+        d.depth + 1
+    FROM chirps c
+    JOIN descendants d ON c.in_reply_to = d.id
+    WHERE d.depth < sqlc.arg('max_depth')::int
+)
+SELECT id, created_at, updated_at, body, user_id, in_reply_to, deleted_at, depth FROM descendants
+ORDER BY depth, created_at, id
+LIMIT sqlc.arg('max_rows');
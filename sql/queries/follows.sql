@@ -0,0 +1,36 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    $1, $2, NOW()
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = $1 AND followee_id = $2;
+
+-- name: ListFollowers :many
+SELECT follower_id AS user_id, created_at FROM follows
+WHERE followee_id = $1
+AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, follower_id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at, follower_id
+LIMIT $2;
+
+-- name: ListFollowing :many
+SELECT followee_id AS user_id, created_at FROM follows
+WHERE follower_id = $1
+AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, followee_id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at, followee_id
+LIMIT $2;
+
+-- name: ListTimeline :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = $1
+AND chirps.deleted_at IS NULL
+AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (chirps.created_at, chirps.id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT $2;
@@ -0,0 +1,22 @@
+-- name: CreatePasswordReset :one
+INSERT INTO password_resets (token_hash, created_at, user_id, expires_at)
+VALUES (
+    $1, NOW(), $2, $3
+)
+RETURNING *;
+
+-- name: CountPasswordResetsSince :one
+SELECT COUNT(*) FROM password_resets
+WHERE user_id = $1 AND created_at >= sqlc.arg('since')::timestamp;
+
+-- UsePasswordReset returns no row if the token is unknown, used or expired at now.
+-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = NOW()
+WHERE token_hash = $1 AND used_at IS NULL AND expires_at > sqlc.arg('now')::timestamp
+RETURNING *;
+
+-- name: InvalidatePasswordResets :exec
+UPDATE password_resets
+SET used_at = NOW()
+WHERE user_id = $1 AND used_at IS NULL;
@@ -0,0 +1,19 @@
+-- name: CreateRecoveryCode :exec
+INSERT INTO recovery_codes (code_hash, created_at, user_id)
+VALUES (
+    $1, NOW(), $2
+);
+
+-- UseRecoveryCode returns 0 if the code is unknown or used, or the second factor is locked.
+-- name: UseRecoveryCode :execrows
+UPDATE recovery_codes
+SET used_at = NOW()
+WHERE recovery_codes.user_id = sqlc.arg('user_id') AND code_hash = sqlc.arg('code_hash') AND used_at IS NULL
+AND recovery_codes.user_id NOT IN (
+    SELECT totp_secrets.user_id FROM totp_secrets
+    WHERE totp_secrets.locked_until > sqlc.arg('now')::timestamp
+);
+
+-- name: DeleteRecoveryCodes :exec
+DELETE FROM recovery_codes
+WHERE user_id = $1;
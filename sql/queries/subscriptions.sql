@@ -0,0 +1,40 @@
+-- name: CreateSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, current_period_start, current_period_end)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, 'active', $2, $3
+)
+RETURNING *;
+
+-- name: GetOpenSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1 AND status IN ('active', 'past_due');
+
+-- name: GetLatestSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT 1;
+
+-- name: RenewSubscription :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'active', current_period_start = $2, current_period_end = $3
+WHERE id = $1
+RETURNING *;
+
+-- name: MarkSubscriptionPastDue :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'past_due'
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelSubscription :one
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'canceled', ended_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ExpireSubscriptions :many
+UPDATE subscriptions
+SET updated_at = NOW(), status = 'expired', ended_at = NOW()
+WHERE status IN ('active', 'past_due') AND current_period_end < sqlc.arg('ended_before')
+RETURNING *;
@@ -0,0 +1,57 @@
+-- A new enrollment replaces one which wasn't confirmed, it returns no row if TOTP is enabled already.
+-- name: UpsertTOTPSecret :one
+INSERT INTO totp_secrets (user_id, created_at, updated_at, secret)
+VALUES (
+    $1, NOW(), NOW(), $2
+)
+ON CONFLICT (user_id) DO UPDATE
+SET created_at = NOW(), updated_at = NOW(), secret = excluded.secret,
+    last_used_step = NULL, failed_attempts = 0, locked_until = NULL
+WHERE totp_secrets.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetTOTPSecret :one
+SELECT * FROM totp_secrets
+WHERE user_id = $1;
+
+-- name: EnableTOTP :execrows
+UPDATE totp_secrets
+SET updated_at = NOW(), enabled_at = NOW(), last_used_step = sqlc.arg('step')::bigint
+WHERE user_id = $1 AND enabled_at IS NULL;
+
+-- UseTOTPStep returns 0 if a code of the step or a later one was used already, or the second factor is locked.
+-- name: UseTOTPStep :execrows
+UPDATE totp_secrets
+SET updated_at = NOW(), last_used_step = sqlc.arg('step')::bigint, failed_attempts = 0
+WHERE user_id = $1 AND (last_used_step IS NULL OR last_used_step < sqlc.arg('step')::bigint)
+AND (locked_until IS NULL OR locked_until <= sqlc.arg('now')::timestamp);
+
+-- name: ClearTOTPFailures :exec
+UPDATE totp_secrets
+SET updated_at = NOW(), failed_attempts = 0
+WHERE user_id = $1;
+
+-- StartTOTPAttempt counts an attempt before its code is checked, so concurrent requests can't check more than
+-- max_attempts codes before the lock. It returns 0 if the second factor is locked or max_attempts attempts are counted
+-- already. Attempts counted before stale_before, which were never recorded as failed, don't count anymore.
+-- name: StartTOTPAttempt :execrows
+UPDATE totp_secrets
+SET updated_at = NOW(),
+    failed_attempts = CASE WHEN failed_attempts >= sqlc.arg('max_attempts')::int THEN 1 ELSE failed_attempts + 1 END
+WHERE user_id = $1 AND enabled_at IS NOT NULL
+AND (locked_until IS NULL OR locked_until <= sqlc.arg('now')::timestamp)
+AND (failed_attempts < sqlc.arg('max_attempts')::int OR updated_at < sqlc.arg('stale_before')::timestamp);
+
+-- RecordTOTPFailure locks the second factor until lock_until once max_attempts failed attempts are counted, and
+-- starts counting again.
+-- name: RecordTOTPFailure :one
+UPDATE totp_secrets
+SET updated_at = NOW(),
+    failed_attempts = CASE WHEN failed_attempts >= sqlc.arg('max_attempts')::int THEN 0 ELSE failed_attempts END,
+    locked_until = CASE WHEN failed_attempts >= sqlc.arg('max_attempts')::int THEN sqlc.arg('lock_until')::timestamp ELSE locked_until END
+WHERE user_id = $1
+RETURNING *;
+
+-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets
+WHERE user_id = $1;
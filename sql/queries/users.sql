@@ -12,13 +12,39 @@ DELETE FROM users;
 SELECT * FROM users
 WHERE email = $1;
 
+-- A new email isn't verified.
 -- name: UpdateUser :one
 UPDATE users
-SET updated_at = NOW(), email = $1, hashed_password = $2
+SET updated_at = NOW(), email = $1, hashed_password = $2,
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at END,
+    verification_sent_at = CASE WHEN email = $1 THEN verification_sent_at END
 WHERE id = $3
 RETURNING *;
 
--- name: UpdateUserChirpyRed :exec
+-- name: SetUserChirpyRed :execrows
 UPDATE users
-SET is_chirpy_red = TRUE
-WHERE id = $1;
\ No newline at end of file
+SET updated_at = NOW(), is_chirpy_red = $2
+WHERE id = $1;
+
+-- name: GetUserById :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- The email is checked, so a verification of an email the user changed since doesn't count.
+-- name: VerifyUserEmail :one
+UPDATE users
+SET updated_at = NOW(), email_verified_at = COALESCE(email_verified_at, NOW())
+WHERE id = $1 AND email = $2
+RETURNING *;
+
+-- MarkVerificationSent returns 0 if the email is verified or the last verification email was sent after sent_before.
+-- name: MarkVerificationSent :execrows
+UPDATE users
+SET verification_sent_at = NOW()
+WHERE id = $1 AND email_verified_at IS NULL
+AND (verification_sent_at IS NULL OR verification_sent_at < sqlc.arg('sent_before')::timestamp);
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET updated_at = NOW(), hashed_password = $2
+WHERE id = $1;
@@ -0,0 +1,49 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'pending', 0, $4
+)
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1;
+
+-- ClaimWebhookDeliveries leases the due deliveries until lease_until, so no other instance sends them meanwhile.
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET updated_at = NOW(), next_attempt_at = sqlc.arg('lease_until')
+WHERE id IN (
+    SELECT d.id FROM webhook_deliveries d
+    WHERE d.status = 'pending' AND d.next_attempt_at <= sqlc.arg('now')
+    ORDER BY d.next_attempt_at
+    LIMIT sqlc.arg('limit')
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: UpdateWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET updated_at = NOW(), status = $2, attempts = attempts + 1, next_attempt_at = $3, last_attempt_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = $1
+AND (sqlc.narg('before_created_at')::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg('before_created_at')::timestamp, sqlc.narg('before_id')::uuid))
+ORDER BY created_at DESC, id DESC
+LIMIT $2;
+
+-- name: CreateWebhookDeliveryAttempt :one
+INSERT INTO webhook_delivery_attempts (id, created_at, delivery_id, attempt, status_code, error, duration_ms)
+VALUES (
+    gen_random_uuid(), NOW(), $1, $2, $3, $4, $5
+)
+RETURNING *;
+
+-- name: ListWebhookDeliveryAttempts :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = $1
+ORDER BY attempt;
@@ -0,0 +1,24 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, events)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE user_id IS NOT DISTINCT FROM sqlc.narg('user_id')::uuid
+ORDER BY created_at, id;
+
+-- name: ListWebhookEndpointsForUser :many
+SELECT * FROM webhook_endpoints
+WHERE user_id IS NULL OR user_id = $1
+ORDER BY created_at, id;
+
+-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints
+WHERE id = $1;
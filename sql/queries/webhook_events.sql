@@ -0,0 +1,33 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, created_at, updated_at, event_id, event, payload, status, attempts)
+VALUES (
+    gen_random_uuid(), NOW(), NOW(), $1, $2, $3, 'pending', 0
+)
+ON CONFLICT (event_id) DO NOTHING
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = $1;
+
+-- name: GetWebhookEventByEventID :one
+SELECT * FROM webhook_events
+WHERE event_id = $1;
+
+-- name: MarkWebhookEventProcessed :execrows
+UPDATE webhook_events
+SET updated_at = NOW(), status = 'processed', attempts = attempts + 1, last_error = NULL, processed_at = NOW()
+WHERE id = $1 AND status <> 'processed';
+
+-- name: MarkWebhookEventFailed :exec
+UPDATE webhook_events
+SET updated_at = NOW(), status = 'failed', attempts = attempts + 1, last_error = $2
+WHERE id = $1 AND status <> 'processed';
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE status = $1
+AND (sqlc.narg('after_created_at')::timestamp IS NULL
+    OR (created_at, id) > (sqlc.narg('after_created_at')::timestamp, sqlc.narg('after_id')::uuid))
+ORDER BY created_at, id
+LIMIT $2;
@@ -0,0 +1,13 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN in_reply_to UUID DEFAULT NULL REFERENCES chirps(id) ON DELETE SET NULL,
+ADD COLUMN deleted_at TIMESTAMP DEFAULT NULL;
+
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to);
+
+-- +goose Down
+DROP INDEX chirps_in_reply_to_idx;
+
+ALTER TABLE chirps
+DROP COLUMN deleted_at,
+DROP COLUMN in_reply_to;
@@ -0,0 +1,13 @@
+-- +goose Up
+UPDATE refresh_tokens
+SET token = encode(sha256(convert_to(token, 'UTF8')), 'hex');
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token TO token_hash;
+
+-- +goose Down
+-- Digests can't be turned back into tokens, every session has to log in again.
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens
+RENAME COLUMN token_hash TO token;
@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE webhook_events (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    event_id TEXT NOT NULL UNIQUE,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'processed', 'failed')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT DEFAULT NULL,
+    processed_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX webhook_events_status_created_at_id_idx ON webhook_events (status, created_at, id);
+
+-- +goose Down
+DROP TABLE webhook_events;
@@ -0,0 +1,48 @@
+-- +goose Up
+CREATE TABLE webhook_endpoints (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    -- user_id is NULL for endpoints an admin registered, they receive the events of every user.
+    user_id UUID DEFAULT NULL REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    -- events is a comma separated list like 'chirp.created,chirp.deleted'.
+    events TEXT NOT NULL
+);
+
+CREATE INDEX webhook_endpoints_user_id_created_at_idx ON webhook_endpoints (user_id, created_at);
+
+CREATE TABLE webhook_deliveries (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    endpoint_id UUID NOT NULL REFERENCES webhook_endpoints(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    status TEXT NOT NULL CHECK (status IN ('pending', 'succeeded', 'dead')),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP NOT NULL,
+    last_attempt_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX webhook_deliveries_next_attempt_at_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_endpoint_id_created_at_id_idx ON webhook_deliveries (endpoint_id, created_at, id);
+
+CREATE TABLE webhook_delivery_attempts (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    delivery_id UUID NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    -- status_code is NULL if there was no response, error says why.
+    status_code INTEGER DEFAULT NULL,
+    error TEXT DEFAULT NULL,
+    duration_ms INTEGER NOT NULL
+);
+
+CREATE INDEX webhook_delivery_attempts_delivery_id_attempt_idx ON webhook_delivery_attempts (delivery_id, attempt);
+
+-- +goose Down
+DROP TABLE webhook_delivery_attempts;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_endpoints;
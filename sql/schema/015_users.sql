@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN email_verified_at TIMESTAMP DEFAULT NULL,
+ADD COLUMN verification_sent_at TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN email_verified_at,
+DROP COLUMN verification_sent_at;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- A password reset token is mailed to the user, only its SHA-256 digest is stored. used_at is set when the token
+-- resets the password, or when another token of the user does, so every token works once.
+CREATE TABLE password_resets (
+    token_hash TEXT NOT NULL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX password_resets_user_id_created_at_idx ON password_resets (user_id, created_at);
+
+-- +goose Down
+DROP TABLE password_resets;
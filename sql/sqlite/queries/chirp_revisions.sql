@@ -0,0 +1,16 @@
+-- CreateChirpRevision saves the current body of the chirp, unless it was deleted. SQLite runs one write at a time, so no edit can come
+-- between reading the body and the insert.
+-- name: CreateChirpRevision :one
+INSERT INTO chirp_revisions (id, created_at, chirp_id, body)
+SELECT sqlc.arg('id'), strftime('%Y-%m-%d %H:%M:%f', 'now'), chirps.id, chirps.body FROM chirps
+WHERE chirps.id = sqlc.arg('chirp_id') AND chirps.deleted_at IS NULL
+RETURNING *;
+
+-- name: ListChirpRevisions :many
+SELECT * FROM chirp_revisions
+WHERE chirp_id = ?
+ORDER BY created_at, id;
+
+-- name: DeleteChirpRevisions :exec
+DELETE FROM chirp_revisions
+WHERE chirp_id = ?;
@@ -0,0 +1,78 @@
+-- name: CreateChirp :one
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, in_reply_to)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?
+)
+RETURNING *;
+
+-- name: ListChirpsAsc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (CAST(sqlc.narg('user_id') AS TEXT) IS NULL OR user_id = CAST(sqlc.narg('user_id') AS TEXT))
+AND (CAST(sqlc.narg('after_created_at') AS TEXT) IS NULL
+    OR (created_at, id) > (CAST(sqlc.narg('after_created_at') AS TEXT), CAST(sqlc.narg('after_id') AS TEXT)))
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
+
+-- name: ListChirpsDesc :many
+SELECT * FROM chirps
+WHERE deleted_at IS NULL
+AND (CAST(sqlc.narg('user_id') AS TEXT) IS NULL OR user_id = CAST(sqlc.narg('user_id') AS TEXT))
+AND (CAST(sqlc.narg('before_created_at') AS TEXT) IS NULL
+    OR (created_at, id) < (CAST(sqlc.narg('before_created_at') AS TEXT), CAST(sqlc.narg('before_id') AS TEXT)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: GetChirp :one
+SELECT * FROM chirps
+WHERE id = ? AND deleted_at IS NULL;
+
+-- DeleteChirp returns 0 if the chirp has replies, such a chirp is tombstoned instead.
+-- name: DeleteChirp :execrows
+DELETE FROM chirps
+WHERE chirps.id = ? AND NOT EXISTS (
+    SELECT 1 FROM chirps AS replies
+    WHERE replies.in_reply_to = chirps.id
+);
+
+-- name: UpdateChirp :one
+UPDATE chirps
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), body = ?
+WHERE id = ? AND deleted_at IS NULL
+RETURNING *;
+
+-- name: TombstoneChirp :exec
+UPDATE chirps
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), deleted_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), body = ''
+WHERE id = ?;
+
+-- name: ListChirpAncestors :many
+WITH RECURSIVE ancestors AS (
+    SELECT parent.id, parent.in_reply_to, 1 AS depth
+    FROM chirps parent
+    JOIN chirps child ON child.in_reply_to = parent.id
+    WHERE child.id = sqlc.arg('id')
+    UNION ALL
+    SELECT c.id, c.in_reply_to, ancestors.depth + 1
+    FROM chirps c
+    JOIN ancestors ON ancestors.in_reply_to = c.id
+)
+SELECT chirps.* FROM ancestors
+JOIN chirps ON chirps.id = ancestors.id
+ORDER BY ancestors.depth DESC;
+
+-- name: ListChirpDescendants :many
+WITH RECURSIVE descendants AS (
+    SELECT id, 0 AS depth
+    FROM chirps
+    WHERE chirps.id = sqlc.arg('id')
+    UNION ALL
+    SELECT c.id, descendants.depth + 1
+    FROM chirps c
+    JOIN descendants ON c.in_reply_to = descendants.id
+    WHERE descendants.depth < CAST(sqlc.arg('max_depth') AS INTEGER)
+)
+SELECT chirps.*, CAST(descendants.depth AS INTEGER) AS depth FROM descendants
+JOIN chirps ON chirps.id = descendants.id
+ORDER BY descendants.depth, chirps.created_at, chirps.id
+LIMIT sqlc.arg('max_rows');
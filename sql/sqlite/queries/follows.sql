@@ -0,0 +1,36 @@
+-- name: FollowUser :exec
+INSERT INTO follows (follower_id, followee_id, created_at)
+VALUES (
+    ?, ?, strftime('%Y-%m-%d %H:%M:%f', 'now')
+)
+ON CONFLICT DO NOTHING;
+
+-- name: UnfollowUser :exec
+DELETE FROM follows
+WHERE follower_id = ? AND followee_id = ?;
+
+-- name: ListFollowers :many
+SELECT follower_id AS user_id, created_at FROM follows
+WHERE followee_id = sqlc.arg('followee_id')
+AND (CAST(sqlc.narg('after_created_at') AS TEXT) IS NULL
+    OR (created_at, follower_id) > (CAST(sqlc.narg('after_created_at') AS TEXT), CAST(sqlc.narg('after_id') AS TEXT)))
+ORDER BY created_at, follower_id
+LIMIT sqlc.arg('limit');
+
+-- name: ListFollowing :many
+SELECT followee_id AS user_id, created_at FROM follows
+WHERE follower_id = sqlc.arg('follower_id')
+AND (CAST(sqlc.narg('after_created_at') AS TEXT) IS NULL
+    OR (created_at, followee_id) > (CAST(sqlc.narg('after_created_at') AS TEXT), CAST(sqlc.narg('after_id') AS TEXT)))
+ORDER BY created_at, followee_id
+LIMIT sqlc.arg('limit');
+
+-- name: ListTimeline :many
+SELECT chirps.* FROM chirps
+JOIN follows ON follows.followee_id = chirps.user_id
+WHERE follows.follower_id = sqlc.arg('follower_id')
+AND chirps.deleted_at IS NULL
+AND (CAST(sqlc.narg('before_created_at') AS TEXT) IS NULL
+    OR (chirps.created_at, chirps.id) < (CAST(sqlc.narg('before_created_at') AS TEXT), CAST(sqlc.narg('before_id') AS TEXT)))
+ORDER BY chirps.created_at DESC, chirps.id DESC
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,22 @@
+-- name: CreatePasswordReset :one
+INSERT INTO password_resets (token_hash, created_at, user_id, expires_at)
+VALUES (
+    sqlc.arg('token_hash'), strftime('%Y-%m-%d %H:%M:%f', 'now'), sqlc.arg('user_id'), CAST(sqlc.arg('expires_at') AS TEXT)
+)
+RETURNING *;
+
+-- name: CountPasswordResetsSince :one
+SELECT COUNT(*) FROM password_resets
+WHERE user_id = sqlc.arg('user_id') AND created_at >= CAST(sqlc.arg('since') AS TEXT);
+
+-- UsePasswordReset returns no row if the token is unknown, used or expired at now.
+-- name: UsePasswordReset :one
+UPDATE password_resets
+SET used_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE token_hash = sqlc.arg('token_hash') AND used_at IS NULL AND expires_at > CAST(sqlc.arg('now') AS TEXT)
+RETURNING *;
+
+-- name: InvalidatePasswordResets :exec
+UPDATE password_resets
+SET used_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE user_id = ? AND used_at IS NULL;
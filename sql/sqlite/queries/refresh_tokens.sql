@@ -0,0 +1,30 @@
+-- name: RefreshToken :one
+INSERT INTO refresh_tokens (token_hash, created_at, updated_at, user_id, expires_at, revoked_at, family_id)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, strftime('%Y-%m-%d %H:%M:%f', 'now', '+60 days'), NULL, ?
+)
+RETURNING *;
+
+-- name: GetRefreshToken :one
+SELECT * FROM refresh_tokens
+WHERE token_hash = ?;
+
+-- name: RevokeRefreshToken :exec
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE token_hash = ?;
+
+-- name: RevokeActiveRefreshToken :execrows
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE token_hash = ? AND revoked_at IS NULL;
+
+-- name: RevokeRefreshTokenFamily :exec
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE family_id = ? AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :exec
+UPDATE refresh_tokens
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), revoked_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE user_id = ? AND revoked_at IS NULL;
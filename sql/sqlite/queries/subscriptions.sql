@@ -0,0 +1,42 @@
+-- name: CreateSubscription :one
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, current_period_start, current_period_end)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, 'active',
+    CAST(sqlc.arg('current_period_start') AS TEXT), CAST(sqlc.arg('current_period_end') AS TEXT)
+)
+RETURNING *;
+
+-- name: GetOpenSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = ? AND status IN ('active', 'past_due');
+
+-- name: GetLatestSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = ?
+ORDER BY created_at DESC, id DESC
+LIMIT 1;
+
+-- name: RenewSubscription :one
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'active',
+    current_period_start = CAST(sqlc.arg('current_period_start') AS TEXT), current_period_end = CAST(sqlc.arg('current_period_end') AS TEXT)
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: MarkSubscriptionPastDue :one
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'past_due'
+WHERE id = ?
+RETURNING *;
+
+-- name: CancelSubscription :one
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'canceled', ended_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = ?
+RETURNING *;
+
+-- name: ExpireSubscriptions :many
+UPDATE subscriptions
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'expired', ended_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE status IN ('active', 'past_due') AND current_period_end < CAST(sqlc.arg('ended_before') AS TEXT)
+RETURNING *;
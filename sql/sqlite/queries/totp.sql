@@ -0,0 +1,58 @@
+-- A new enrollment replaces one which wasn't confirmed, it returns no row if TOTP is enabled already.
+-- name: UpsertTOTPSecret :one
+INSERT INTO totp_secrets (user_id, created_at, updated_at, secret)
+VALUES (
+    sqlc.arg('user_id'), strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), sqlc.arg('secret')
+)
+ON CONFLICT (user_id) DO UPDATE
+SET created_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), secret = excluded.secret,
+    last_used_step = NULL, failed_attempts = 0, locked_until = NULL
+WHERE totp_secrets.enabled_at IS NULL
+RETURNING *;
+
+-- name: GetTOTPSecret :one
+SELECT * FROM totp_secrets
+WHERE user_id = ?;
+
+-- name: EnableTOTP :execrows
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), enabled_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    last_used_step = CAST(sqlc.arg('step') AS INTEGER)
+WHERE user_id = sqlc.arg('user_id') AND enabled_at IS NULL;
+
+-- UseTOTPStep returns 0 if a code of the step or a later one was used already, or the second factor is locked.
+-- name: UseTOTPStep :execrows
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), last_used_step = CAST(sqlc.arg('step') AS INTEGER), failed_attempts = 0
+WHERE user_id = sqlc.arg('user_id') AND (last_used_step IS NULL OR last_used_step < CAST(sqlc.arg('step') AS INTEGER))
+AND (locked_until IS NULL OR locked_until <= CAST(sqlc.arg('now') AS TEXT));
+
+-- name: ClearTOTPFailures :exec
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), failed_attempts = 0
+WHERE user_id = ?;
+
+-- StartTOTPAttempt counts an attempt before its code is checked, so concurrent requests can't check more than
+-- max_attempts codes before the lock. It returns 0 if the second factor is locked or max_attempts attempts are counted
+-- already. Attempts counted before stale_before, which were never recorded as failed, don't count anymore.
+-- name: StartTOTPAttempt :execrows
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    failed_attempts = CASE WHEN failed_attempts >= CAST(sqlc.arg('max_attempts') AS INTEGER) THEN 1 ELSE failed_attempts + 1 END
+WHERE user_id = sqlc.arg('user_id') AND enabled_at IS NOT NULL
+AND (locked_until IS NULL OR locked_until <= CAST(sqlc.arg('now') AS TEXT))
+AND (failed_attempts < CAST(sqlc.arg('max_attempts') AS INTEGER) OR updated_at < CAST(sqlc.arg('stale_before') AS TEXT));
+
+-- RecordTOTPFailure locks the second factor until lock_until once max_attempts failed attempts are counted, and
+-- starts counting again.
+-- name: RecordTOTPFailure :one
+UPDATE totp_secrets
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    failed_attempts = CASE WHEN failed_attempts >= CAST(sqlc.arg('max_attempts') AS INTEGER) THEN 0 ELSE failed_attempts END,
+    locked_until = CASE WHEN failed_attempts >= CAST(sqlc.arg('max_attempts') AS INTEGER) THEN CAST(sqlc.arg('lock_until') AS TEXT) ELSE locked_until END
+WHERE user_id = sqlc.arg('user_id')
+RETURNING *;
+
+-- name: DeleteTOTPSecret :exec
+DELETE FROM totp_secrets
+WHERE user_id = ?;
@@ -0,0 +1,51 @@
+-- name: CreateUser :one
+INSERT INTO users (id, created_at, updated_at, email, hashed_password)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?
+)
+RETURNING *;
+
+-- name: DeleteAllUsers :exec
+DELETE FROM users;
+
+-- name: GetUserByEmail :one
+SELECT * FROM users
+WHERE email = ?;
+
+-- A new email isn't verified.
+-- name: UpdateUser :one
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), email = sqlc.arg('email'), hashed_password = sqlc.arg('hashed_password'),
+    email_verified_at = CASE WHEN email = sqlc.arg('email') THEN email_verified_at END,
+    verification_sent_at = CASE WHEN email = sqlc.arg('email') THEN verification_sent_at END
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: SetUserChirpyRed :execrows
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), is_chirpy_red = sqlc.arg('is_chirpy_red')
+WHERE id = sqlc.arg('id');
+
+-- name: GetUserById :one
+SELECT * FROM users
+WHERE id = ?;
+
+-- The email is checked, so a verification of an email the user changed since doesn't count.
+-- name: VerifyUserEmail :one
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'),
+    email_verified_at = COALESCE(email_verified_at, strftime('%Y-%m-%d %H:%M:%f', 'now'))
+WHERE id = ? AND email = ?
+RETURNING *;
+
+-- MarkVerificationSent returns 0 if the email is verified or the last verification email was sent after sent_before.
+-- name: MarkVerificationSent :execrows
+UPDATE users
+SET verification_sent_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = sqlc.arg('id') AND email_verified_at IS NULL
+AND (verification_sent_at IS NULL OR verification_sent_at < CAST(sqlc.arg('sent_before') AS TEXT));
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), hashed_password = sqlc.arg('hashed_password')
+WHERE id = sqlc.arg('id');
@@ -0,0 +1,51 @@
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (id, created_at, updated_at, endpoint_id, event, payload, status, attempts, next_attempt_at)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?, 'pending', 0,
+    CAST(sqlc.arg('next_attempt_at') AS TEXT)
+)
+RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = ?;
+
+-- ClaimWebhookDeliveries leases the due deliveries until lease_until, so no other instance sends them meanwhile.
+-- SQLite has a single writer, it needs no row locks.
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), next_attempt_at = CAST(sqlc.arg('lease_until') AS TEXT)
+WHERE id IN (
+    SELECT d.id FROM webhook_deliveries d
+    WHERE d.status = 'pending' AND d.next_attempt_at <= CAST(sqlc.arg('now') AS TEXT)
+    ORDER BY d.next_attempt_at
+    LIMIT sqlc.arg('limit')
+)
+RETURNING *;
+
+-- name: UpdateWebhookDeliveryAttempt :one
+UPDATE webhook_deliveries
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = sqlc.arg('status'), attempts = attempts + 1,
+    next_attempt_at = CAST(sqlc.arg('next_attempt_at') AS TEXT), last_attempt_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = sqlc.arg('id')
+RETURNING *;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = sqlc.arg('endpoint_id')
+AND (CAST(sqlc.narg('before_created_at') AS TEXT) IS NULL
+    OR (created_at, id) < (CAST(sqlc.narg('before_created_at') AS TEXT), CAST(sqlc.narg('before_id') AS TEXT)))
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg('limit');
+
+-- name: CreateWebhookDeliveryAttempt :one
+INSERT INTO webhook_delivery_attempts (id, created_at, delivery_id, attempt, status_code, error, duration_ms)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: ListWebhookDeliveryAttempts :many
+SELECT * FROM webhook_delivery_attempts
+WHERE delivery_id = ?
+ORDER BY attempt;
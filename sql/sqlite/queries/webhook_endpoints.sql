@@ -0,0 +1,24 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, events)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?, ?
+)
+RETURNING *;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = ?;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE user_id IS CAST(sqlc.narg('user_id') AS TEXT)
+ORDER BY created_at, id;
+
+-- name: ListWebhookEndpointsForUser :many
+SELECT * FROM webhook_endpoints
+WHERE user_id IS NULL OR user_id = ?
+ORDER BY created_at, id;
+
+-- name: DeleteWebhookEndpoint :exec
+DELETE FROM webhook_endpoints
+WHERE id = ?;
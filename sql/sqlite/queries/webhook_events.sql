@@ -0,0 +1,34 @@
+-- name: CreateWebhookEvent :one
+INSERT INTO webhook_events (id, created_at, updated_at, event_id, event, payload, status, attempts)
+VALUES (
+    ?, strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), ?, ?, ?, 'pending', 0
+)
+ON CONFLICT (event_id) DO NOTHING
+RETURNING *;
+
+-- name: GetWebhookEvent :one
+SELECT * FROM webhook_events
+WHERE id = ?;
+
+-- name: GetWebhookEventByEventID :one
+SELECT * FROM webhook_events
+WHERE event_id = ?;
+
+-- name: MarkWebhookEventProcessed :execrows
+UPDATE webhook_events
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'processed', attempts = attempts + 1, last_error = NULL,
+    processed_at = strftime('%Y-%m-%d %H:%M:%f', 'now')
+WHERE id = ? AND status <> 'processed';
+
+-- name: MarkWebhookEventFailed :exec
+UPDATE webhook_events
+SET updated_at = strftime('%Y-%m-%d %H:%M:%f', 'now'), status = 'failed', attempts = attempts + 1, last_error = sqlc.arg('last_error')
+WHERE id = sqlc.arg('id') AND status <> 'processed';
+
+-- name: ListWebhookEvents :many
+SELECT * FROM webhook_events
+WHERE status = sqlc.arg('status')
+AND (CAST(sqlc.narg('after_created_at') AS TEXT) IS NULL
+    OR (created_at, id) > (CAST(sqlc.narg('after_created_at') AS TEXT), CAST(sqlc.narg('after_id') AS TEXT)))
+ORDER BY created_at, id
+LIMIT sqlc.arg('limit');
@@ -0,0 +1,64 @@
+-- The SQLite schema starts at the state of sql/schema/011_refresh_tokens.sql. Ids are UUID strings and timestamps are
+-- UTC text in the format 'YYYY-MM-DD HH:MM:SS.SSS', so they sort and compare as strings.
+-- +goose Up
+CREATE TABLE users (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL DEFAULT '',
+    is_chirpy_red BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE chirps (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    body TEXT NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    in_reply_to UUID DEFAULT NULL REFERENCES chirps(id) ON DELETE SET NULL,
+    deleted_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX chirps_created_at_id_idx ON chirps (created_at, id);
+CREATE INDEX chirps_user_id_created_at_id_idx ON chirps (user_id, created_at, id);
+CREATE INDEX chirps_in_reply_to_idx ON chirps (in_reply_to);
+
+CREATE TABLE chirp_revisions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    chirp_id UUID NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+    body TEXT NOT NULL
+);
+
+CREATE INDEX chirp_revisions_chirp_id_created_at_idx ON chirp_revisions (chirp_id, created_at);
+
+CREATE TABLE follows (
+    follower_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    followee_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (follower_id, followee_id),
+    CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX follows_follower_id_created_at_idx ON follows (follower_id, created_at, followee_id);
+CREATE INDEX follows_followee_id_created_at_idx ON follows (followee_id, created_at, follower_id);
+
+CREATE TABLE refresh_tokens (
+    token_hash TEXT NOT NULL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP DEFAULT NULL,
+    family_id UUID NOT NULL
+);
+
+CREATE INDEX refresh_tokens_family_id_idx ON refresh_tokens (family_id);
+
+-- +goose Down
+DROP TABLE refresh_tokens;
+DROP TABLE follows;
+DROP TABLE chirp_revisions;
+DROP TABLE chirps;
+DROP TABLE users;
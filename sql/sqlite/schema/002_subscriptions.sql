@@ -0,0 +1,29 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL CHECK (status IN ('active', 'past_due', 'canceled', 'expired')),
+    current_period_start TIMESTAMP NOT NULL,
+    current_period_end TIMESTAMP NOT NULL,
+    ended_at TIMESTAMP DEFAULT NULL
+);
+
+-- A user has at most one open subscription, canceled and expired ones are kept as history.
+CREATE UNIQUE INDEX subscriptions_user_id_open_idx ON subscriptions (user_id) WHERE status IN ('active', 'past_due');
+CREATE INDEX subscriptions_current_period_end_open_idx ON subscriptions (current_period_end) WHERE status IN ('active', 'past_due');
+CREATE INDEX subscriptions_user_id_created_at_idx ON subscriptions (user_id, created_at);
+
+-- Existing Chirpy Red members get a subscription, their first period starts now.
+INSERT INTO subscriptions (id, created_at, updated_at, user_id, status, current_period_start, current_period_end)
+SELECT
+    lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-'
+        || substr('89ab', 1 + (abs(random()) % 4), 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+    strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now'), id, 'active',
+    strftime('%Y-%m-%d %H:%M:%f', 'now'), strftime('%Y-%m-%d %H:%M:%f', 'now', '+30 days')
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscriptions;
@@ -0,0 +1,7 @@
+-- +goose Up
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP DEFAULT NULL;
+ALTER TABLE users ADD COLUMN verification_sent_at TIMESTAMP DEFAULT NULL;
+
+-- +goose Down
+ALTER TABLE users DROP COLUMN verification_sent_at;
+ALTER TABLE users DROP COLUMN email_verified_at;
@@ -0,0 +1,28 @@
+-- +goose Up
+-- A user has TOTP two-factor authentication once enabled_at is set, before that the secret waits for the first code.
+CREATE TABLE totp_secrets (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    secret TEXT NOT NULL,
+    enabled_at TIMESTAMP DEFAULT NULL,
+    -- last_used_step is the time step of the last accepted code, a code can't be used twice.
+    last_used_step BIGINT DEFAULT NULL,
+    -- failed_attempts counts wrong codes in a row, too many lock the second factor until locked_until.
+    failed_attempts INTEGER NOT NULL DEFAULT 0,
+    locked_until TIMESTAMP DEFAULT NULL
+);
+
+-- Recovery codes replace a TOTP code once each, only their SHA-256 digest is stored.
+CREATE TABLE recovery_codes (
+    code_hash TEXT NOT NULL PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    used_at TIMESTAMP DEFAULT NULL
+);
+
+CREATE INDEX recovery_codes_user_id_idx ON recovery_codes (user_id);
+
+-- +goose Down
+DROP TABLE recovery_codes;
+DROP TABLE totp_secrets;
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	// redPeriod is how long one payment keeps a user Chirpy Red.
+	redPeriod = 30 * 24 * time.Hour
+	// redGracePeriod is how long after the end of a period a user stays Chirpy Red while Polka retries a failed
+	// payment or sends a late renewal.
+	redGracePeriod = 7 * 24 * time.Hour
+	// subscriptionSweepInterval is how often expireSubscriptions runs.
+	subscriptionSweepInterval = time.Hour
+)
+
+// Polka events about Chirpy Red, every other event is ignored.
+const (
+	eventUserUpgraded      = "user.upgraded"
+	eventUserRenewed       = "user.renewed"
+	eventUserPaymentFailed = "user.payment_failed"
+	eventUserDowngraded    = "user.downgraded"
+)
+
+var errUnknownUser = errors.New("user doesn't exist")
+
+// Subscription is a Chirpy Red subscription. Its status is active or past_due while it is open, then canceled or
+// expired.
+type Subscription struct {
+	ID                 uuid.UUID  `json:"id"`
+	CreatedAt          time.Time  `json:"created_at"`
+	UpdatedAt          time.Time  `json:"updated_at"`
+	Status             string     `json:"status"`
+	CurrentPeriodStart time.Time  `json:"current_period_start"`
+	CurrentPeriodEnd   time.Time  `json:"current_period_end"`
+	GracePeriodEnd     time.Time  `json:"grace_period_end"`
+	EndedAt            *time.Time `json:"ended_at"`
+}
+
+func newSubscription(s database.Subscription) Subscription {
+	subscription := Subscription{
+		ID:                 s.ID,
+		CreatedAt:          s.CreatedAt,
+		UpdatedAt:          s.UpdatedAt,
+		Status:             s.Status,
+		CurrentPeriodStart: s.CurrentPeriodStart,
+		CurrentPeriodEnd:   s.CurrentPeriodEnd,
+		GracePeriodEnd:     s.CurrentPeriodEnd.Add(redGracePeriod),
+	}
+	if s.EndedAt.Valid {
+		subscription.EndedAt = &s.EndedAt.Time
+	}
+	return subscription
+}
+
+func isSubscriptionEvent(event string) bool {
+	switch event {
+	case eventUserUpgraded, eventUserRenewed, eventUserPaymentFailed, eventUserDowngraded:
+		return true
+	}
+	return false
+}
+
+// applySubscriptionEvent moves the subscription of the user through its lifecycle and keeps users.is_chirpy_red in
+// sync with it:
+// - user.upgraded starts a subscription unless one is open already.
+// - user.renewed adds a period to the open subscription, or starts one if the old one expired in the meantime.
+// - user.payment_failed marks the open subscription past due. The user stays Chirpy Red until the grace period after
+// the current period ends, expireSubscriptions takes it away then.
+// - user.downgraded cancels the open subscription and the user loses Chirpy Red at once.
+// q has to be a transaction, see processWebhookEvent.
+func applySubscriptionEvent(ctx context.Context, q database.Querier, event string, userId uuid.UUID, now time.Time) error {
+	now = now.UTC()
+
+	_, err := q.GetUserById(ctx, userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errUnknownUser
+	}
+	if err != nil {
+		return err
+	}
+
+	open, err := q.GetOpenSubscription(ctx, userId)
+	hasOpen := err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	isChirpyRed := true
+	switch {
+	case event == eventUserUpgraded && hasOpen:
+	case event == eventUserRenewed && hasOpen:
+		_, err = q.RenewSubscription(ctx, database.RenewSubscriptionParams{
+			ID:                 open.ID,
+			CurrentPeriodStart: open.CurrentPeriodEnd,
+			CurrentPeriodEnd:   open.CurrentPeriodEnd.Add(redPeriod),
+		})
+	case event == eventUserUpgraded || event == eventUserRenewed:
+		_, err = q.CreateSubscription(ctx, database.CreateSubscriptionParams{
+			UserID:             userId,
+			CurrentPeriodStart: now,
+			CurrentPeriodEnd:   now.Add(redPeriod),
+		})
+	case event == eventUserPaymentFailed:
+		if !hasOpen {
+			return nil
+		}
+		_, err = q.MarkSubscriptionPastDue(ctx, open.ID)
+	case event == eventUserDowngraded:
+		isChirpyRed = false
+		if hasOpen {
+			_, err = q.CancelSubscription(ctx, open.ID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = q.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{ID: userId, IsChirpyRed: isChirpyRed})
+	return err
+}
+
+// expireSubscriptions ends the open subscriptions whose grace period is over and takes Chirpy Red away from their
+// users. It returns how many expired.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context, now time.Time) (int, error) {
+	expired := []database.Subscription{}
+	err := cfg.store.InTx(ctx, func(q database.Querier) error {
+		var err error
+		expired, err = q.ExpireSubscriptions(ctx, now.UTC().Add(-redGracePeriod))
+		if err != nil {
+			return err
+		}
+		for _, s := range expired {
+			_, err = q.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{ID: s.UserID, IsChirpyRed: false})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
+
+// sweepSubscriptions runs expireSubscriptions every interval until ctx is cancelled.
+func (cfg *apiConfig) sweepSubscriptions(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		expired, err := cfg.expireSubscriptions(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Could not expire subscriptions", "error", err)
+		} else if expired > 0 {
+			slog.Info("Expired subscriptions", "count", expired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GET /api/users/me/subscription returns the open subscription of the user, or the last one that ended.
+func (cfg *apiConfig) getSubscription(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	subscription, err := cfg.store.GetOpenSubscription(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		subscription, err = cfg.store.GetLatestSubscription(r.Context(), userId)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemSubscriptionNotFound, "User never subscribed to Chirpy Red", nil)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get subscription", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, newSubscription(subscription))
+}
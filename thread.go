@@ -0,0 +1,119 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultThreadDepth = 5
+	maxThreadDepth     = 20
+	maxThreadReplies   = 500
+)
+
+type ThreadChirp struct {
+	Chirp
+	Replies []ThreadChirp `json:"replies"`
+}
+
+type chirpThread struct {
+	Ancestors []Chirp     `json:"ancestors"`
+	Chirp     ThreadChirp `json:"chirp"`
+}
+
+// GET /api/chirps/{chirpID}/thread?depth=...
+// Returns the chain of chirps the chirp replies to (root first) and the tree of replies below it, at most depth levels deep.
+// Deleted chirps are kept in the thread as tombstones.
+func (cfg *apiConfig) getChirpThread(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid chirp UUID", err, fieldError{Field: "chirpID", Message: "isn't a UUID"})
+		return
+	}
+
+	depth := defaultThreadDepth
+	if d := r.URL.Query().Get("depth"); d != "" {
+		depth, err = strconv.Atoi(d)
+		if err != nil || depth < 0 || depth > maxThreadDepth {
+			respondWithProblem(w, r, problemInvalidParameter, "Invalid depth, use a number between 0 and "+strconv.Itoa(maxThreadDepth), err, fieldError{Field: "depth", Message: "has to be a number between 0 and " + strconv.Itoa(maxThreadDepth)})
+			return
+		}
+	}
+
+	descendants, err := cfg.store.ListChirpDescendants(r.Context(), database.ListChirpDescendantsParams{
+		ID:       id,
+		MaxRows:  maxThreadReplies,
+		MaxDepth: int32(depth),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list chirp replies.", err)
+		return
+	}
+	if len(descendants) == 0 {
+		respondWithProblem(w, r, problemChirpNotFound, "Could not get chirp", nil)
+		return
+	}
+
+	ancestors, err := cfg.store.ListChirpAncestors(r.Context(), id)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list chirp ancestors.", err)
+		return
+	}
+
+	payload := chirpThread{
+		Ancestors: []Chirp{},
+	}
+
+	for _, a := range ancestors {
+		payload.Ancestors = append(payload.Ancestors, newChirp(database.Chirp{
+			ID:        a.ID,
+			CreatedAt: a.CreatedAt,
+			UpdatedAt: a.UpdatedAt,
+			Body:      a.Body,
+			UserID:    a.UserID,
+			InReplyTo: a.InReplyTo,
+			DeletedAt: a.DeletedAt,
+		}))
+	}
+
+	// Rows come ordered by depth and creation time, so grouping them by parent keeps the replies of every chirp in order.
+	replies := make(map[uuid.UUID][]database.Chirp)
+	for _, d := range descendants[1:] {
+		replies[d.InReplyTo.UUID] = append(replies[d.InReplyTo.UUID], database.Chirp{
+			ID:        d.ID,
+			CreatedAt: d.CreatedAt,
+			UpdatedAt: d.UpdatedAt,
+			Body:      d.Body,
+			UserID:    d.UserID,
+			InReplyTo: d.InReplyTo,
+			DeletedAt: d.DeletedAt,
+		})
+	}
+
+	root := descendants[0]
+	payload.Chirp = buildThread(database.Chirp{
+		ID:        root.ID,
+		CreatedAt: root.CreatedAt,
+		UpdatedAt: root.UpdatedAt,
+		Body:      root.Body,
+		UserID:    root.UserID,
+		InReplyTo: root.InReplyTo,
+		DeletedAt: root.DeletedAt,
+	}, replies)
+
+	respondWithJson(w, http.StatusOK, payload)
+}
+
+func buildThread(chirp database.Chirp, replies map[uuid.UUID][]database.Chirp) ThreadChirp {
+	node := ThreadChirp{
+		Chirp:   newChirp(chirp),
+		Replies: []ThreadChirp{},
+	}
+	for _, reply := range replies[chirp.ID] {
+		node.Replies = append(node.Replies, buildThread(reply, replies))
+	}
+	return node
+}
@@ -1,21 +1,33 @@
 package main
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/PavelVaavra/http-server/internal/auth"
 	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/store"
 	"github.com/google/uuid"
 )
 
 type User struct {
-	ID          uuid.UUID `json:"id"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
-	Email       string    `json:"email"`
-	IsChirpyRed bool      `json:"is_chirpy_red"`
+	ID            uuid.UUID `json:"id"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Email         string    `json:"email"`
+	EmailVerified bool      `json:"email_verified"`
+	IsChirpyRed   bool      `json:"is_chirpy_red"`
+}
+
+func newUser(user database.User) User {
+	return User{
+		ID:            user.ID,
+		CreatedAt:     user.CreatedAt,
+		UpdatedAt:     user.UpdatedAt,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt.Valid,
+		IsChirpyRed:   user.IsChirpyRed,
+	}
 }
 
 type userParams struct {
@@ -23,37 +35,40 @@ type userParams struct {
 	Email    string `json:"email"`
 }
 
+func (p userParams) validate() []fieldError {
+	return fieldErrors(
+		fieldError{Field: "email", Message: validateEmail(p.Email)},
+		fieldError{Field: "password", Message: validatePassword(p.Password)},
+	)
+}
+
 func (cfg *apiConfig) createUsers(w http.ResponseWriter, r *http.Request) {
-	decoder := json.NewDecoder(r.Body)
 	params := userParams{}
-	err := decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not decode JSON", err)
+	if !decodeJSON(w, r, &params) {
 		return
 	}
 
 	hash, err := auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not hash password", err)
+		respondWithProblem(w, r, problemInternal, "Could not hash password", err)
 		return
 	}
 
-	user, err := cfg.dbQueries.CreateUser(r.Context(), database.CreateUserParams{
+	user, err := cfg.store.CreateUser(r.Context(), database.CreateUserParams{
 		Email:          params.Email,
 		HashedPassword: hash,
 	})
+	if store.IsUniqueViolation(err) {
+		respondWithProblem(w, r, problemEmailTaken, "Email is used by another user", err, fieldError{Field: "email", Message: "is taken"})
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not create user", err)
+		respondWithProblem(w, r, problemInternal, "Could not create user", err)
 		return
 	}
 
-	respondWithJson(w, http.StatusCreated, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-	})
+	cfg.sendVerificationEmail(r, user)
+	respondWithJson(w, http.StatusCreated, newUser(user))
 }
 
 // 1. Add a PUT /api/users endpoint so that users can update their own (but not others') email and password. It requires:
@@ -63,101 +78,44 @@ func (cfg *apiConfig) createUsers(w http.ResponseWriter, r *http.Request) {
 // successful and the newly updated User resource (omitting the password of course).
 // 3. If the access token is malformed or missing, respond with a 401 status code.
 func (cfg *apiConfig) updateUsers(w http.ResponseWriter, r *http.Request) {
-	jwtToken, err := auth.GetBearerToken(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User isn't logged in, no JWT token available", err)
-		return
-	}
-	userId, err := auth.ValidateJWT(jwtToken, cfg.tokenSecret)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "User isn't logged in, JWT isn't validated", err)
-		return
-	}
+	userId, _ := userIdFromContext(r.Context())
 
-	decoder := json.NewDecoder(r.Body)
 	params := userParams{}
-	err = decoder.Decode(&params)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not decode JSON", err)
+	if !decodeJSON(w, r, &params) {
 		return
 	}
 
 	hash, err := auth.HashPassword(params.Password)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not hash password", err)
-		return
-	}
-
-	user, err := cfg.dbQueries.UpdateUser(r.Context(), database.UpdateUserParams{
-		Email:          params.Email,
-		HashedPassword: hash,
-		ID:             userId,
-	})
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not update user", err)
+		respondWithProblem(w, r, problemInternal, "Could not hash password", err)
 		return
 	}
 
-	respondWithJson(w, http.StatusOK, User{
-		ID:          user.ID,
-		CreatedAt:   user.CreatedAt,
-		UpdatedAt:   user.UpdatedAt,
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
+	var user database.User
+	err = cfg.store.InTx(r.Context(), func(q database.Querier) error {
+		user, err = q.UpdateUser(r.Context(), database.UpdateUserParams{
+			Email:          params.Email,
+			HashedPassword: hash,
+			ID:             userId,
+		})
+		if err != nil {
+			return err
+		}
+		return queueEvent(r.Context(), q, eventUserUpdated, user.ID, newUser(user))
 	})
-}
-
-// - Add a POST /api/polka/webhooks endpoint. It should accept a request of this shape:
-// {
-//   "event": "user.upgraded",
-//   "data": {
-//     "user_id": "3311741c-680c-4546-99f3-fc9efac2036c"
-//   }
-// }
-
-// - If the event is anything other than user.upgraded, the endpoint should immediately respond with a 204 status code - we don't care about any
-// other events.
-// - If the event is user.upgraded, then it should update the user in the database, and mark that they are a Chirpy Red member.
-// - If the user is upgraded successfully, the endpoint should respond with a 204 status code and an empty response body. If the user can't be found,
-// the endpoint should respond with a 404 status code.
-func (cfg *apiConfig) webhooks(w http.ResponseWriter, r *http.Request) {
-	apiKey, err := auth.GetAPIKey(r.Header)
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Error getting API key", err)
+	if store.IsUniqueViolation(err) {
+		respondWithProblem(w, r, problemEmailTaken, "Email is used by another user", err, fieldError{Field: "email", Message: "is taken"})
 		return
 	}
-	if apiKey != cfg.polkaKey {
-		respondWithError(w, http.StatusUnauthorized, "Header ApiKey != Polka ApiKey", err)
-		return
-	}
-
-	type data struct {
-		UserId uuid.UUID `json:"user_id"`
-	}
-
-	type webhooksParams struct {
-		Event string `json:"event"`
-		Data  data   `json:"data"`
-	}
-
-	decoder := json.NewDecoder(r.Body)
-	params := webhooksParams{}
-	err = decoder.Decode(&params)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Could not decode JSON", err)
+		respondWithProblem(w, r, problemInternal, "Could not update user", err)
 		return
 	}
 
-	if params.Event != "user.upgraded" {
-		w.WriteHeader(http.StatusNoContent)
-		return
-	}
-
-	err = cfg.dbQueries.UpdateUserChirpyRed(r.Context(), params.Data.UserId)
-	if err != nil {
-		respondWithError(w, http.StatusNotFound, "User not found", err)
-		return
+	// UpdateUser clears the verification if the email changed.
+	if !user.EmailVerifiedAt.Valid && !user.VerificationSentAt.Valid {
+		cfg.sendVerificationEmail(r, user)
 	}
 
-	w.WriteHeader(http.StatusNoContent)
+	respondWithJson(w, http.StatusOK, newUser(user))
 }
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/mailer"
+	"github.com/google/uuid"
+)
+
+const (
+	// verificationTokenTTL is how long the token of a verification email is valid.
+	verificationTokenTTL = 24 * time.Hour
+	// verificationResendInterval is how long a user waits before another verification email, so the resend
+	// endpoint can't flood an inbox.
+	verificationResendInterval = time.Minute
+)
+
+// sendVerificationEmail emails a verification token to a new or changed email. The user exists already and can
+// ask for another email, so a failure is only logged.
+func (cfg *apiConfig) sendVerificationEmail(r *http.Request, user database.User) {
+	_, err := cfg.mailVerification(r.Context(), user)
+	if err != nil {
+		requestLogger(r).Error("Could not send verification email", "user_id", user.ID, "error", err)
+	}
+}
+
+// mailVerification sends the verification email unless the user is verified or got one within
+// verificationResendInterval, then sent is false.
+func (cfg *apiConfig) mailVerification(ctx context.Context, user database.User) (sent bool, err error) {
+	now := time.Now()
+	marked, err := cfg.store.MarkVerificationSent(ctx, database.MarkVerificationSentParams{
+		ID:         user.ID,
+		SentBefore: now.UTC().Add(-verificationResendInterval),
+	})
+	if err != nil || marked == 0 {
+		return false, err
+	}
+
+	token := auth.MakeVerificationToken(cfg.tokenSecret, user.ID, user.Email, now.Add(verificationTokenTTL))
+	err = cfg.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your Chirpy email",
+		Body: "Welcome to Chirpy!\n\n" +
+			"Confirm that this is your email by sending this token to POST /api/users/verify within 24 hours:\n\n" +
+			token + "\n\n" +
+			"If you didn't sign up for Chirpy, ignore this email.",
+	})
+	return err == nil, err
+}
+
+type verifyEmailParams struct {
+	Token string `json:"token"`
+}
+
+func (p verifyEmailParams) validate() []fieldError {
+	if p.Token == "" {
+		return []fieldError{{Field: "token", Message: "is required"}}
+	}
+	return nil
+}
+
+// POST /api/users/verify marks the email of the user verified with the token of a verification email. It needs no
+// access token, the verification token identifies the user.
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	params := verifyEmailParams{}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+
+	userId, err := auth.VerificationTokenUser(params.Token)
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidVerificationToken, "Verification token is malformed", err)
+		return
+	}
+	user, err := cfg.store.GetUserById(r.Context(), userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemInvalidVerificationToken, "Verification token belongs to no user", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get user", err)
+		return
+	}
+	err = auth.ValidateVerificationToken(cfg.tokenSecret, params.Token, user.Email, time.Now())
+	if errors.Is(err, auth.ErrVerificationTokenExpired) {
+		respondWithProblem(w, r, problemInvalidVerificationToken, "Verification token expired, ask for a new one", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidVerificationToken, "Verification token is wrong or the email changed since it was sent", err)
+		return
+	}
+
+	user, err = cfg.store.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{ID: user.ID, Email: user.Email})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemInvalidVerificationToken, "Email changed since the token was sent", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not verify email", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, newUser(user))
+}
+
+// POST /api/users/verify/resend sends the logged in user another verification email.
+func (cfg *apiConfig) resendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userId, _ := userIdFromContext(r.Context())
+
+	user, err := cfg.store.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get user", err)
+		return
+	}
+	if user.EmailVerifiedAt.Valid {
+		respondWithProblem(w, r, problemEmailAlreadyVerified, "Email is verified already", nil)
+		return
+	}
+
+	sent, err := cfg.mailVerification(r.Context(), user)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not send verification email", err)
+		return
+	}
+	if !sent {
+		w.Header().Set("Retry-After", strconv.Itoa(int(verificationResendInterval.Seconds())))
+		respondWithProblem(w, r, problemVerificationThrottled, "A verification email was sent less than a minute ago", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireVerifiedEmail checks the user verified their email if the config asks for it. If not, the error response is
+// already written and ok is false.
+func (cfg *apiConfig) requireVerifiedEmail(w http.ResponseWriter, r *http.Request, userId uuid.UUID) (ok bool) {
+	if !cfg.requireVerified {
+		return true
+	}
+	user, err := cfg.store.GetUserById(r.Context(), userId)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get user", err)
+		return false
+	}
+	if !user.EmailVerifiedAt.Valid {
+		respondWithProblem(w, r, problemEmailNotVerified, "Verify your email before chirping", nil)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/google/uuid"
+)
+
+// Events Chirpy sends to webhook endpoints.
+const (
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	eventUserUpdated  = "user.updated"
+)
+
+var outboundEvents = []string{eventChirpCreated, eventChirpDeleted, eventUserUpdated}
+
+// Statuses of a webhook delivery. A pending delivery is retried until it succeeds or runs out of attempts, then it
+// is dead and only shows up in the delivery log.
+const (
+	webhookDeliveryPending   = "pending"
+	webhookDeliverySucceeded = "succeeded"
+	webhookDeliveryDead      = "dead"
+)
+
+const (
+	chirpySignatureHeader = "Chirpy-Signature"
+	chirpyEventHeader     = "Chirpy-Event"
+	chirpyDeliveryHeader  = "Chirpy-Delivery"
+
+	// webhookMaxAttempts is how many times a delivery is sent before it is dead, which spreads the attempts over about
+	// a day and a half with the backoff below.
+	webhookMaxAttempts = 15
+	// webhookRetryBase is the wait after the first failed attempt, it doubles after every further one up to
+	// webhookRetryMax.
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = 6 * time.Hour
+	// webhookDeliveryTimeout limits one attempt, webhookDeliveryLease has to be longer so a claimed delivery isn't
+	// claimed again while it is being sent.
+	webhookDeliveryTimeout = 10 * time.Second
+	webhookDeliveryLease   = time.Minute
+	// webhookDispatchInterval is how often deliverWebhooks runs, webhookDispatchBatch how many deliveries it sends.
+	webhookDispatchInterval = 5 * time.Second
+	webhookDispatchBatch    = 50
+	// webhookResponseLimit is how much of the receiver's response is read, so the connection can be reused. The
+	// response isn't kept, the owner of the endpoint only sees the status.
+	webhookResponseLimit = 1 << 10
+)
+
+// outboundEvent is the body of every webhook Chirpy sends. id is the same for every endpoint that receives the
+// event, so receivers can drop duplicates.
+type outboundEvent struct {
+	ID        uuid.UUID `json:"id"`
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+var errWebhookAddressBlocked = errors.New("webhook endpoint resolves to an address which isn't public")
+
+// nonPublicPrefixes are the IANA special-purpose ranges, which are loopback, private, shared (CGNAT), link-local,
+// reserved, documentation, multicast or translate to IPv4 addresses of their own (NAT64, 6to4, Teredo). A webhook
+// must not reach any of them.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("10.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("127.0.0.0/8"),
+	netip.MustParsePrefix("169.254.0.0/16"),
+	netip.MustParsePrefix("172.16.0.0/12"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("192.88.99.0/24"),
+	netip.MustParsePrefix("192.168.0.0/16"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("224.0.0.0/4"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("::/96"),
+	netip.MustParsePrefix("::ffff:0:0/96"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+	netip.MustParsePrefix("fc00::/7"),
+	netip.MustParsePrefix("fe80::/10"),
+	netip.MustParsePrefix("fec0::/10"),
+	netip.MustParsePrefix("ff00::/8"),
+}
+
+// newWebhookClient doesn't follow redirects, a redirect counts as a failed attempt. Unless allowPrivate is set (the
+// dev platform), it refuses to connect to addresses which aren't public, so an endpoint can't reach into the network
+// Chirpy runs in. The address is checked when dialing, after DNS resolution, so DNS rebinding doesn't get around it.
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookDeliveryTimeout}
+	if !allowPrivate {
+		dialer.Control = func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil || !isPublicIP(ip) {
+				return errWebhookAddressBlocked
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: webhookDeliveryTimeout,
+		// No proxy, the dialer has to see the address of the receiver.
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			ForceAttemptHTTP2:   true,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+			TLSHandshakeTimeout: webhookDeliveryTimeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// isPublicIP reports whether ip is outside nonPublicPrefixes. IPv4-mapped IPv6 addresses are checked as the IPv4
+// address they are.
+func isPublicIP(ip netip.Addr) bool {
+	ip = ip.Unmap().WithZone("")
+	if !ip.IsValid() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookBackoff returns how long to wait after the attempt-th failed attempt.
+func webhookBackoff(attempt int32) time.Duration {
+	backoff := webhookRetryBase
+	for i := int32(1); i < attempt && backoff < webhookRetryMax; i++ {
+		backoff *= 2
+	}
+	return min(backoff, webhookRetryMax)
+}
+
+// queueEvent queues a delivery of event for every endpoint subscribed to it, the endpoints of the user the event is
+// about and those of admins. The deliveries are sent by deliverWebhooks, so the request doesn't wait for receivers.
+// q is the transaction of the change the event is about, so the event is queued if and only if the change is
+// committed.
+func queueEvent(ctx context.Context, q database.Querier, event string, userId uuid.UUID, data any) error {
+	now := time.Now().UTC()
+	payload, err := json.Marshal(outboundEvent{
+		ID:        uuid.New(),
+		Event:     event,
+		CreatedAt: now,
+		Data:      data,
+	})
+	if err != nil {
+		return err
+	}
+
+	endpoints, err := q.ListWebhookEndpointsForUser(ctx, uuid.NullUUID{UUID: userId, Valid: true})
+	if err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		if !isSubscribed(endpoint, event) {
+			continue
+		}
+		_, err = q.CreateWebhookDelivery(ctx, database.CreateWebhookDeliveryParams{
+			EndpointID:    endpoint.ID,
+			Event:         event,
+			Payload:       string(payload),
+			NextAttemptAt: now,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isSubscribed(endpoint database.WebhookEndpoint, event string) bool {
+	for _, e := range strings.Split(endpoint.Events, ",") {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// deliverWebhooks sends the deliveries which are due at now, concurrently, and records an attempt for each. It
+// returns how many it sent. Claiming leases the deliveries, so several instances can run it at once, and a
+// delivery whose instance died is claimed again after the lease.
+func (cfg *apiConfig) deliverWebhooks(ctx context.Context, now time.Time) (int, error) {
+	now = now.UTC()
+	deliveries, err := cfg.store.ClaimWebhookDeliveries(ctx, database.ClaimWebhookDeliveriesParams{
+		Now:        now,
+		LeaseUntil: now.Add(webhookDeliveryLease),
+		Limit:      webhookDispatchBatch,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	wg := sync.WaitGroup{}
+	errs := make([]error, len(deliveries))
+	for i, delivery := range deliveries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// A claimed delivery is finished on shutdown too, otherwise it is sent again when its lease runs out
+			// without its attempt recorded. The webhook client's timeout bounds how long that takes.
+			errs[i] = cfg.deliverWebhook(context.WithoutCancel(ctx), delivery, now)
+		}()
+	}
+	wg.Wait()
+	return len(deliveries), errors.Join(errs...)
+}
+
+// deliverWebhook sends one attempt of delivery and records it. A 2XX response is a success, anything else is
+// retried after webhookBackoff until the delivery runs out of attempts.
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, delivery database.WebhookDelivery, now time.Time) error {
+	endpoint, err := cfg.store.GetWebhookEndpoint(ctx, delivery.EndpointID)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	statusCode, attemptErr := cfg.sendWebhook(ctx, endpoint, delivery)
+	duration := time.Since(start)
+
+	attempt := delivery.Attempts + 1
+	status := webhookDeliverySucceeded
+	nextAttemptAt := now
+	result := webhookDeliverySucceeded
+	lastError := sql.NullString{}
+	if attemptErr != nil {
+		lastError = sql.NullString{String: attemptErr.Error(), Valid: true}
+		if attempt >= webhookMaxAttempts {
+			status = webhookDeliveryDead
+			result = webhookDeliveryDead
+		} else {
+			status = webhookDeliveryPending
+			nextAttemptAt = now.Add(webhookBackoff(attempt))
+			result = "retried"
+		}
+	}
+
+	err = cfg.store.InTx(ctx, func(q database.Querier) error {
+		_, err := q.CreateWebhookDeliveryAttempt(ctx, database.CreateWebhookDeliveryAttemptParams{
+			DeliveryID: delivery.ID,
+			Attempt:    attempt,
+			StatusCode: statusCode,
+			Error:      lastError,
+			DurationMs: int32(duration.Milliseconds()),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = q.UpdateWebhookDeliveryAttempt(ctx, database.UpdateWebhookDeliveryAttemptParams{
+			ID:            delivery.ID,
+			Status:        status,
+			NextAttemptAt: nextAttemptAt,
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	cfg.metrics.WebhookDeliveries.WithLabelValues(result).Inc()
+	if status == webhookDeliveryDead {
+		slog.Warn("Webhook delivery is dead", "delivery_id", delivery.ID, "endpoint_id", endpoint.ID, "error", attemptErr)
+	}
+	return nil
+}
+
+// sendWebhook posts the payload of delivery to endpoint, signed with the secret of the endpoint. It returns the
+// status code of the response, if there was one, and why the attempt failed.
+func (cfg *apiConfig) sendWebhook(ctx context.Context, endpoint database.WebhookEndpoint, delivery database.WebhookDelivery) (sql.NullInt32, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.Url, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return sql.NullInt32{}, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	req.Header.Set(chirpyEventHeader, delivery.Event)
+	req.Header.Set(chirpyDeliveryHeader, delivery.ID.String())
+	req.Header.Set(chirpySignatureHeader, auth.SignWebhook(endpoint.Secret, time.Now(), body))
+
+	resp, err := cfg.webhookClient.Do(req)
+	if err != nil {
+		return sql.NullInt32{}, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, webhookResponseLimit))
+	statusCode := sql.NullInt32{Int32: int32(resp.StatusCode), Valid: true}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return statusCode, fmt.Errorf("receiver responded with %v", resp.Status)
+	}
+	return statusCode, nil
+}
+
+// dispatchWebhooks runs deliverWebhooks every interval until ctx is cancelled.
+func (cfg *apiConfig) dispatchWebhooks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, err := cfg.deliverWebhooks(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			slog.Error("Could not deliver webhooks", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/auth"
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// Users register webhook endpoints under /api/webhooks for the events about themselves, admins under
+// /admin/webhooks for the events about every user. The handlers are shared, webhookOwner tells them apart.
+
+type WebhookEndpoint struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Url       string    `json:"url"`
+	Events    []string  `json:"events"`
+	// Secret signs the Chirpy-Signature header, see auth.VerifyWebhook. It is only shown when the endpoint is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+func newWebhookEndpoint(e database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		Url:       e.Url,
+		Events:    strings.Split(e.Events, ","),
+	}
+}
+
+type WebhookDelivery struct {
+	ID            uuid.UUID                `json:"id"`
+	CreatedAt     time.Time                `json:"created_at"`
+	UpdatedAt     time.Time                `json:"updated_at"`
+	EndpointID    uuid.UUID                `json:"endpoint_id"`
+	Event         string                   `json:"event"`
+	Status        string                   `json:"status"`
+	Attempts      int32                    `json:"attempts"`
+	NextAttemptAt *time.Time               `json:"next_attempt_at"`
+	LastAttemptAt *time.Time               `json:"last_attempt_at"`
+	Payload       json.RawMessage          `json:"payload,omitempty"`
+	AttemptLog    []WebhookDeliveryAttempt `json:"attempt_log,omitempty"`
+}
+
+func newWebhookDelivery(d database.WebhookDelivery) WebhookDelivery {
+	delivery := WebhookDelivery{
+		ID:         d.ID,
+		CreatedAt:  d.CreatedAt,
+		UpdatedAt:  d.UpdatedAt,
+		EndpointID: d.EndpointID,
+		Event:      d.Event,
+		Status:     d.Status,
+		Attempts:   d.Attempts,
+	}
+	if d.Status == webhookDeliveryPending {
+		delivery.NextAttemptAt = &d.NextAttemptAt
+	}
+	if d.LastAttemptAt.Valid {
+		delivery.LastAttemptAt = &d.LastAttemptAt.Time
+	}
+	return delivery
+}
+
+type WebhookDeliveryAttempt struct {
+	Attempt    int32     `json:"attempt"`
+	CreatedAt  time.Time `json:"created_at"`
+	StatusCode *int32    `json:"status_code"`
+	Error      *string   `json:"error"`
+	DurationMs int32     `json:"duration_ms"`
+}
+
+func newWebhookDeliveryAttempt(a database.WebhookDeliveryAttempt) WebhookDeliveryAttempt {
+	attempt := WebhookDeliveryAttempt{
+		Attempt:    a.Attempt,
+		CreatedAt:  a.CreatedAt,
+		DurationMs: a.DurationMs,
+	}
+	if a.StatusCode.Valid {
+		attempt.StatusCode = &a.StatusCode.Int32
+	}
+	if a.Error.Valid {
+		attempt.Error = &a.Error.String
+	}
+	return attempt
+}
+
+type webhookDeliveriesPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type webhookEndpointParams struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+	// dev is set on the dev platform, so endpoints can be http and point at a local receiver.
+	dev bool
+}
+
+func (p webhookEndpointParams) validate() []fieldError {
+	errs := fieldErrors()
+	u, err := url.Parse(p.Url)
+	switch {
+	case p.Url == "":
+		errs = append(errs, fieldError{Field: "url", Message: "is required"})
+	case err != nil || u.Host == "" || (u.Scheme != "https" && !(p.dev && u.Scheme == "http")):
+		errs = append(errs, fieldError{Field: "url", Message: "has to be an absolute https URL"})
+	case u.User != nil:
+		errs = append(errs, fieldError{Field: "url", Message: "can't contain credentials"})
+	case !p.dev && isLocalHost(u.Hostname()):
+		errs = append(errs, fieldError{Field: "url", Message: "can't point at a loopback, private or link-local address"})
+	}
+	if len(p.Events) == 0 {
+		errs = append(errs, fieldError{Field: "events", Message: "is required"})
+	}
+	for _, event := range p.Events {
+		if !slices.Contains(outboundEvents, event) {
+			errs = append(errs, fieldError{Field: "events", Message: "has to contain only " + strings.Join(outboundEvents, ", ")})
+			break
+		}
+	}
+	return errs
+}
+
+// isLocalHost catches the obvious internal hosts when an endpoint is registered. Host names can resolve to anything,
+// the webhook client checks the resolved address again when it sends.
+func isLocalHost(host string) bool {
+	if ip, err := netip.ParseAddr(host); err == nil {
+		return !isPublicIP(ip)
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	return host == "localhost" || strings.HasSuffix(host, ".localhost")
+}
+
+// webhookOwner returns the user whose endpoints the request manages, or no user for the admin routes.
+func webhookOwner(r *http.Request) uuid.NullUUID {
+	userId, ok := userIdFromContext(r.Context())
+	return uuid.NullUUID{UUID: userId, Valid: ok}
+}
+
+// POST /api/webhooks/endpoints and POST /admin/webhooks/endpoints register an endpoint for a list of events and
+// return it with the secret its deliveries are signed with.
+func (cfg *apiConfig) createWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	params := webhookEndpointParams{dev: cfg.platform == "dev"}
+	if !decodeJSON(w, r, &params) {
+		return
+	}
+	slices.Sort(params.Events)
+	params.Events = slices.Compact(params.Events)
+
+	secret := auth.MakeWebhookSecret()
+	endpoint, err := cfg.store.CreateWebhookEndpoint(r.Context(), database.CreateWebhookEndpointParams{
+		UserID: webhookOwner(r),
+		Url:    params.Url,
+		Secret: secret,
+		Events: strings.Join(params.Events, ","),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not create webhook endpoint", err)
+		return
+	}
+
+	payload := newWebhookEndpoint(endpoint)
+	payload.Secret = secret
+	respondWithJson(w, http.StatusCreated, payload)
+}
+
+// GET /api/webhooks/endpoints lists the endpoints of the user, GET /admin/webhooks/endpoints those of admins.
+func (cfg *apiConfig) getWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	endpoints, err := cfg.store.ListWebhookEndpoints(r.Context(), webhookOwner(r))
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list webhook endpoints", err)
+		return
+	}
+
+	payload := []WebhookEndpoint{}
+	for _, endpoint := range endpoints {
+		payload = append(payload, newWebhookEndpoint(endpoint))
+	}
+	respondWithJson(w, http.StatusOK, payload)
+}
+
+// DELETE /api/webhooks/endpoints/{endpointID} removes the endpoint with its deliveries.
+func (cfg *apiConfig) deleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.getOwnedWebhookEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.store.DeleteWebhookEndpoint(r.Context(), endpoint.ID)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not delete webhook endpoint", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /api/webhooks/endpoints/{endpointID}/deliveries?limit=...&cursor=... lists the deliveries to the endpoint,
+// newest first.
+func (cfg *apiConfig) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	endpoint, ok := cfg.getOwnedWebhookEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	deliveries, err := cfg.store.ListWebhookDeliveries(r.Context(), database.ListWebhookDeliveriesParams{
+		EndpointID:      endpoint.ID,
+		Limit:           p.fetchLimit(),
+		BeforeCreatedAt: p.cursorCreatedAt(),
+		BeforeID:        p.cursorID(),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list webhook deliveries", err)
+		return
+	}
+
+	payload := webhookDeliveriesPage{
+		Deliveries: []WebhookDelivery{},
+	}
+	if len(deliveries) > p.limit {
+		deliveries = deliveries[:p.limit]
+		last := deliveries[len(deliveries)-1]
+		payload.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+		setNextLink(w, r, payload.NextCursor, p.limit)
+	}
+	for _, delivery := range deliveries {
+		payload.Deliveries = append(payload.Deliveries, newWebhookDelivery(delivery))
+	}
+
+	respondWithJson(w, http.StatusOK, payload)
+}
+
+// GET /api/webhooks/deliveries/{deliveryID} returns a delivery with its payload and the log of every attempt.
+func (cfg *apiConfig) getWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("deliveryID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid delivery UUID", err, fieldError{Field: "deliveryID", Message: "isn't a UUID"})
+		return
+	}
+
+	delivery, err := cfg.store.GetWebhookDelivery(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemWebhookDeliveryNotFound, "Webhook delivery not found", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get webhook delivery", err)
+		return
+	}
+	endpoint, err := cfg.store.GetWebhookEndpoint(r.Context(), delivery.EndpointID)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get webhook endpoint", err)
+		return
+	}
+	if !ownsWebhookEndpoint(r, endpoint) {
+		respondWithProblem(w, r, problemWebhookDeliveryNotFound, "Webhook delivery not found", nil)
+		return
+	}
+
+	attempts, err := cfg.store.ListWebhookDeliveryAttempts(r.Context(), delivery.ID)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list webhook delivery attempts", err)
+		return
+	}
+
+	payload := newWebhookDelivery(delivery)
+	payload.Payload = json.RawMessage(delivery.Payload)
+	payload.AttemptLog = []WebhookDeliveryAttempt{}
+	for _, attempt := range attempts {
+		payload.AttemptLog = append(payload.AttemptLog, newWebhookDeliveryAttempt(attempt))
+	}
+	respondWithJson(w, http.StatusOK, payload)
+}
+
+// ownsWebhookEndpoint lets users reach their own endpoints and admins every endpoint.
+func ownsWebhookEndpoint(r *http.Request, endpoint database.WebhookEndpoint) bool {
+	owner := webhookOwner(r)
+	return !owner.Valid || endpoint.UserID == owner
+}
+
+// getOwnedWebhookEndpoint loads the endpoint from the {endpointID} path value and checks that the request may manage
+// it. Endpoints of other users are reported as not found. If anything fails, the error response is already written
+// and ok is false.
+func (cfg *apiConfig) getOwnedWebhookEndpoint(w http.ResponseWriter, r *http.Request) (endpoint database.WebhookEndpoint, ok bool) {
+	id, err := uuid.Parse(r.PathValue("endpointID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid endpoint UUID", err, fieldError{Field: "endpointID", Message: "isn't a UUID"})
+		return database.WebhookEndpoint{}, false
+	}
+
+	endpoint, err = cfg.store.GetWebhookEndpoint(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !ownsWebhookEndpoint(r, endpoint)) {
+		respondWithProblem(w, r, problemWebhookEndpointNotFound, "Webhook endpoint not found", err)
+		return database.WebhookEndpoint{}, false
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get webhook endpoint", err)
+		return database.WebhookEndpoint{}, false
+	}
+
+	return endpoint, true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/PavelVaavra/http-server/internal/database"
+	"github.com/PavelVaavra/http-server/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// Statuses of the webhook_events inbox. An event is pending until the first attempt to process it.
+const (
+	webhookEventPending   = "pending"
+	webhookEventProcessed = "processed"
+	webhookEventFailed    = "failed"
+)
+
+type WebhookEvent struct {
+	ID          uuid.UUID       `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+	EventID     string          `json:"event_id"`
+	Event       string          `json:"event"`
+	Status      string          `json:"status"`
+	Attempts    int32           `json:"attempts"`
+	LastError   *string         `json:"last_error"`
+	ProcessedAt *time.Time      `json:"processed_at"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+func newWebhookEvent(e database.WebhookEvent) WebhookEvent {
+	event := WebhookEvent{
+		ID:        e.ID,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+		EventID:   e.EventID,
+		Event:     e.Event,
+		Status:    e.Status,
+		Attempts:  e.Attempts,
+		Payload:   json.RawMessage(e.Payload),
+	}
+	if e.LastError.Valid {
+		event.LastError = &e.LastError.String
+	}
+	if e.ProcessedAt.Valid {
+		event.ProcessedAt = &e.ProcessedAt.Time
+	}
+	return event
+}
+
+type webhookEventsPage struct {
+	Events     []WebhookEvent `json:"events"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// GET /admin/webhooks/events?status=...&limit=...&cursor=... lists the events of the webhook inbox with the status,
+// failed by default, oldest first.
+func (cfg *apiConfig) getWebhookEvents(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = webhookEventFailed
+	case webhookEventPending, webhookEventProcessed, webhookEventFailed:
+	default:
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid status", nil, fieldError{Field: "status", Message: "has to be pending, processed or failed"})
+		return
+	}
+
+	p, ok := parsePage(w, r)
+	if !ok {
+		return
+	}
+
+	events, err := cfg.store.ListWebhookEvents(r.Context(), database.ListWebhookEventsParams{
+		Status:         status,
+		Limit:          p.fetchLimit(),
+		AfterCreatedAt: p.cursorCreatedAt(),
+		AfterID:        p.cursorID(),
+	})
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not list webhook events", err)
+		return
+	}
+
+	payload := webhookEventsPage{
+		Events: []WebhookEvent{},
+	}
+	if len(events) > p.limit {
+		events = events[:p.limit]
+		last := events[len(events)-1]
+		payload.NextCursor = pagination.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}.Encode()
+		setNextLink(w, r, payload.NextCursor, p.limit)
+	}
+	for _, event := range events {
+		payload.Events = append(payload.Events, newWebhookEvent(event))
+	}
+
+	respondWithJson(w, http.StatusOK, payload)
+}
+
+// POST /admin/webhooks/events/{eventID}/replay processes a pending or failed event of the inbox again and returns it
+// with the outcome. eventID is the id of the inbox row, not the id Polka gave the event.
+func (cfg *apiConfig) replayWebhookEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("eventID"))
+	if err != nil {
+		respondWithProblem(w, r, problemInvalidParameter, "Invalid event UUID", err, fieldError{Field: "eventID", Message: "isn't a UUID"})
+		return
+	}
+
+	event, err := cfg.store.GetWebhookEvent(r.Context(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithProblem(w, r, problemWebhookEventNotFound, "Webhook event not found", err)
+		return
+	}
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get webhook event", err)
+		return
+	}
+	if event.Status == webhookEventProcessed {
+		respondWithProblem(w, r, problemWebhookEventProcessed, "Webhook event was processed already", nil)
+		return
+	}
+
+	// A failure is recorded in the event, which is the response either way.
+	err = cfg.processWebhookEvent(r.Context(), event)
+	if err != nil {
+		requestLogger(r).Warn("Replayed webhook event failed", "event_id", event.EventID, "error", err)
+	}
+	event, err = cfg.store.GetWebhookEvent(r.Context(), id)
+	if err != nil {
+		respondWithProblem(w, r, problemInternal, "Could not get webhook event", err)
+		return
+	}
+
+	respondWithJson(w, http.StatusOK, newWebhookEvent(event))
+}